@@ -0,0 +1,328 @@
+package slogdispatch
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+// Async Handler
+
+var (
+	// Returned by AsyncHandler.Handle if a record is dropped because the queue
+	// is full and the overflow policy is OverflowDropNewest.
+	ErrQueueFull = errors.New("slogdispatch: async queue full, record dropped")
+
+	// Returned by AsyncHandler.Handle if a record is logged after the handler
+	// has been closed or drained.
+	ErrClosed = errors.New("slogdispatch: handler is closed")
+)
+
+// Determines what an AsyncHandler does when a record is handled while its
+// queue is full.
+type OverflowPolicy int
+
+const (
+	// Block until there is space in the queue.
+	OverflowBlock OverflowPolicy = iota
+
+	// Drop the oldest record in the queue to make space for the new record.
+	OverflowDropOldest
+
+	// Drop the new record and return ErrQueueFull.
+	OverflowDropNewest
+)
+
+// Options for NewAsyncHandler.
+type AsyncHandlerOptions struct {
+	// The maximum number of records which can be queued. If zero, a default
+	// of 1024 is used.
+	QueueSize int
+
+	// Determines what happens when a record is handled while the queue is
+	// full.
+	Overflow OverflowPolicy
+
+	// If non-nil, called on the background goroutine when the underlying
+	// handler returns an error, since the error cannot be returned from
+	// Handle.
+	OnError func(err error, r slog.Record)
+}
+
+// The default value of AsyncHandlerOptions.QueueSize.
+const defaultAsyncQueueSize = 1024
+
+// An item in an async queue.
+type asyncItem struct {
+	h     slog.Handler
+	ctx   context.Context
+	r     slog.Record
+	flush chan struct{} // if non-nil, closed when all earlier items are handled
+}
+
+// Carries the values of a context but not its deadline or cancellation, so
+// that a queued record can still be handled after the context passed to
+// Handle has been cancelled.
+type detachedContext struct{ parent context.Context }
+
+func (detachedContext) Deadline() (time.Time, bool)         { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}               { return nil }
+func (detachedContext) Err() error                          { return nil }
+func (c detachedContext) Value(key interface{}) interface{} { return c.parent.Value(key) }
+
+// A bounded queue of records handled by a background goroutine. It is shared
+// between an AsyncHandler and all handlers derived from it.
+type asyncQueue struct {
+	opts AsyncHandlerOptions
+	done chan struct{}
+
+	mu       sync.Mutex
+	cond     *sync.Cond  // signalled when items are added or removed, or on close
+	items    []asyncItem // including flush markers
+	nRecords int         // number of items which are records
+	closed   bool
+	dropped  uint64
+}
+
+func newAsyncQueue(opts AsyncHandlerOptions) *asyncQueue {
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = defaultAsyncQueueSize
+	}
+	q := &asyncQueue{
+		opts: opts,
+		done: make(chan struct{}),
+	}
+	q.cond = sync.NewCond(&q.mu)
+	go q.loop()
+	return q
+}
+
+func (q *asyncQueue) loop() {
+	defer close(q.done)
+	for {
+		q.mu.Lock()
+		for len(q.items) == 0 && !q.closed {
+			q.cond.Wait()
+		}
+		if len(q.items) == 0 {
+			q.mu.Unlock()
+			return
+		}
+		item := q.items[0]
+		q.items[0] = asyncItem{}
+		q.items = q.items[1:]
+		if item.flush == nil {
+			q.nRecords--
+		}
+		q.cond.Broadcast()
+		q.mu.Unlock()
+
+		if item.flush != nil {
+			close(item.flush)
+			continue
+		}
+		if err := item.h.Handle(item.ctx, item.r); err != nil && q.opts.OnError != nil {
+			q.opts.OnError(err, item.r)
+		}
+	}
+}
+
+func (q *asyncQueue) send(item asyncItem) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for item.flush == nil && q.nRecords >= q.opts.QueueSize && !q.closed {
+		switch q.opts.Overflow {
+		case OverflowDropNewest:
+			q.dropped++
+			return ErrQueueFull
+		case OverflowDropOldest:
+			q.dropOldest()
+		default:
+			q.cond.Wait()
+		}
+	}
+	if q.closed {
+		return ErrClosed
+	}
+
+	q.items = append(q.items, item)
+	if item.flush == nil {
+		q.nRecords++
+	}
+	q.cond.Broadcast()
+	return nil
+}
+
+// Removes the oldest record from the queue. Flush markers are retained so that
+// flushes still complete. Must be called with mu held.
+func (q *asyncQueue) dropOldest() {
+	for i := range q.items {
+		if q.items[i].flush == nil {
+			q.items = append(q.items[:i], q.items[i+1:]...)
+			q.nRecords--
+			q.dropped++
+			return
+		}
+	}
+}
+
+func (q *asyncQueue) flush() error {
+	ch := make(chan struct{})
+	if err := q.send(asyncItem{flush: ch}); err != nil {
+		return err
+	}
+	<-ch
+	return nil
+}
+
+func (q *asyncQueue) close() error {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return ErrClosed
+	}
+	q.closed = true
+	q.cond.Broadcast()
+	q.mu.Unlock()
+	<-q.done
+	return nil
+}
+
+// Closes the queue, waiting until the queued records have been handled or ctx
+// is done. In the latter case, the remaining records are discarded, and their
+// number is returned.
+func (q *asyncQueue) drain(ctx context.Context) (uint64, error) {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return 0, nil
+	}
+	q.closed = true
+	q.cond.Broadcast()
+	q.mu.Unlock()
+
+	select {
+	case <-q.done:
+		return 0, nil
+	case <-ctx.Done():
+	}
+
+	q.mu.Lock()
+	n := uint64(q.nRecords)
+	for _, item := range q.items {
+		if item.flush != nil {
+			close(item.flush)
+		}
+	}
+	q.items = nil
+	q.nRecords = 0
+	q.dropped += n
+	q.mu.Unlock()
+
+	if n == 0 {
+		return 0, nil
+	}
+	return n, ctx.Err()
+}
+
+func (q *asyncQueue) getDropped() uint64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.dropped
+}
+
+// A slog.Handler which queues records and passes them to another handler on a
+// background goroutine, so that logging does not block on slow handlers.
+type AsyncHandler struct {
+	h slog.Handler
+	q *asyncQueue
+}
+
+// Creates an AsyncHandler which passes records to h. If opts is nil, the
+// default options are used. The handler must be closed using Close when it is
+// no longer needed to stop the background goroutine.
+//
+// The context passed to h carries the values of the context passed to Handle,
+// but not its deadline or cancellation, since the record is usually handled
+// after Handle has returned.
+func NewAsyncHandler(h slog.Handler, opts *AsyncHandlerOptions) *AsyncHandler {
+	var o AsyncHandlerOptions
+	if opts != nil {
+		o = *opts
+	}
+	return &AsyncHandler{
+		h: h,
+		q: newAsyncQueue(o),
+	}
+}
+
+var _ slog.Handler = &AsyncHandler{}
+
+func (ah *AsyncHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return ah.h.Enabled(ctx, level)
+}
+
+// Queues the record for handling by the underlying handler. Errors returned by
+// the underlying handler are passed to OnError, if set.
+func (ah *AsyncHandler) Handle(ctx context.Context, r slog.Record) error {
+	return ah.q.send(asyncItem{
+		h:   ah.h,
+		ctx: detachedContext{ctx},
+		r:   r.Clone(),
+	})
+}
+
+func (ah *AsyncHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &AsyncHandler{
+		h: ah.h.WithAttrs(attrs),
+		q: ah.q,
+	}
+}
+
+func (ah *AsyncHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return ah
+	}
+
+	return &AsyncHandler{
+		h: ah.h.WithGroup(name),
+		q: ah.q,
+	}
+}
+
+// Implements Parent.
+func (ah *AsyncHandler) Children() []slog.Handler {
+	return []slog.Handler{ah.h}
+}
+
+// Blocks until all records queued before the call have been handled.
+func (ah *AsyncHandler) Flush() error {
+	return ah.q.flush()
+}
+
+// Handles any queued records and stops the background goroutine. Records
+// handled after Close are discarded with ErrClosed. This affects the handler
+// and all handlers derived from it.
+func (ah *AsyncHandler) Close() error {
+	return ah.q.close()
+}
+
+// Implements Drainer. Stops accepting records, so that Handle returns
+// ErrClosed, and waits until the queued records have been handled or ctx is
+// done, in which case the remaining records are discarded. Returns the number
+// of records discarded and, if any were, the error of ctx. Like Close, this
+// affects the handler and all handlers derived from it.
+func (ah *AsyncHandler) Drain(ctx context.Context) (dropped uint64, err error) {
+	return ah.q.drain(ctx)
+}
+
+// Returns the number of records dropped because the queue was full, or
+// discarded by Drain. The count includes records handled by the handler and
+// all handlers derived from it.
+func (ah *AsyncHandler) Dropped() uint64 {
+	return ah.q.getDropped()
+}
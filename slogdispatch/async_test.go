@@ -0,0 +1,350 @@
+package slogdispatch_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hlandau/slogkit/slogdispatch"
+	"golang.org/x/exp/slog"
+)
+
+// A handler which records the messages of the records it handles. If block
+// is non-nil, Handle signals started and then waits for block to be closed.
+type recordingHandler struct {
+	mu      sync.Mutex
+	msgs    []string
+	recs    []slog.Record
+	err     error
+	level   slog.Level
+	block   chan struct{}
+	started chan struct{}
+}
+
+func newBlockingHandler() *recordingHandler {
+	return &recordingHandler{
+		level:   slog.LevelDebug,
+		block:   make(chan struct{}),
+		started: make(chan struct{}, 100),
+	}
+}
+
+func (h *recordingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.level
+}
+
+func (h *recordingHandler) Handle(ctx context.Context, r slog.Record) error {
+	if h.block != nil {
+		h.started <- struct{}{}
+		<-h.block
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.msgs = append(h.msgs, r.Message)
+	h.recs = append(h.recs, r.Clone())
+	return h.err
+}
+
+func (h *recordingHandler) WithAttrs(attrs []slog.Attr) slog.Handler { return h }
+func (h *recordingHandler) WithGroup(name string) slog.Handler       { return h }
+
+func (h *recordingHandler) messages() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]string(nil), h.msgs...)
+}
+
+func (h *recordingHandler) records() []slog.Record {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]slog.Record(nil), h.recs...)
+}
+
+// Returns the value of the attribute of r with the given key, or the zero
+// value.
+func recordAttr(r slog.Record, key string) slog.Value {
+	var v slog.Value
+	r.Attrs(func(a slog.Attr) bool {
+		if a.Key == key {
+			v = a.Value
+		}
+		return true
+	})
+	return v
+}
+
+func handleMsg(h slog.Handler, msg string) error {
+	return h.Handle(context.Background(), slog.NewRecord(time.Time{}, slog.LevelInfo, msg, 0))
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Handles a record and waits until the background goroutine has started
+// handling it, so that it no longer occupies the queue.
+func handleStarted(t *testing.T, ah *slogdispatch.AsyncHandler, h *recordingHandler, msg string) {
+	t.Helper()
+	if err := handleMsg(ah, msg); err != nil {
+		t.Fatalf("cannot handle: %v", err)
+	}
+	<-h.started
+}
+
+func TestAsyncHandlerBlock(t *testing.T) {
+	h := newBlockingHandler()
+	ah := slogdispatch.NewAsyncHandler(h, &slogdispatch.AsyncHandlerOptions{QueueSize: 1})
+
+	handleStarted(t, ah, h, "1")
+	if err := handleMsg(ah, "2"); err != nil {
+		t.Fatalf("cannot handle: %v", err)
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- handleMsg(ah, "3")
+	}()
+	select {
+	case err := <-done:
+		t.Fatalf("expected Handle to block while the queue is full, got %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(h.block)
+	if err := <-done; err != nil {
+		t.Errorf("cannot handle: %v", err)
+	}
+	if err := ah.Close(); err != nil {
+		t.Errorf("cannot close: %v", err)
+	}
+	if got := h.messages(); !equalStrings(got, []string{"1", "2", "3"}) {
+		t.Errorf("unexpected records handled: %q", got)
+	}
+	if n := ah.Dropped(); n != 0 {
+		t.Errorf("expected none dropped, got %d", n)
+	}
+}
+
+func TestAsyncHandlerDropNewest(t *testing.T) {
+	h := newBlockingHandler()
+	ah := slogdispatch.NewAsyncHandler(h, &slogdispatch.AsyncHandlerOptions{
+		QueueSize: 1,
+		Overflow:  slogdispatch.OverflowDropNewest,
+	})
+
+	handleStarted(t, ah, h, "1")
+	if err := handleMsg(ah, "2"); err != nil {
+		t.Fatalf("cannot handle: %v", err)
+	}
+	if err := handleMsg(ah, "3"); err != slogdispatch.ErrQueueFull {
+		t.Errorf("expected ErrQueueFull, got %v", err)
+	}
+
+	close(h.block)
+	ah.Close()
+	if got := h.messages(); !equalStrings(got, []string{"1", "2"}) {
+		t.Errorf("unexpected records handled: %q", got)
+	}
+	if n := ah.Dropped(); n != 1 {
+		t.Errorf("expected 1 dropped, got %d", n)
+	}
+}
+
+func TestAsyncHandlerDropOldestFlush(t *testing.T) {
+	h := newBlockingHandler()
+	ah := slogdispatch.NewAsyncHandler(h, &slogdispatch.AsyncHandlerOptions{
+		QueueSize: 2,
+		Overflow:  slogdispatch.OverflowDropOldest,
+	})
+
+	handleStarted(t, ah, h, "1")
+	if err := handleMsg(ah, "2"); err != nil {
+		t.Fatalf("cannot handle: %v", err)
+	}
+
+	// The flush marker follows record 2, which is then dropped to make space
+	// for record 4. The flush must still complete once record 1 has been
+	// handled.
+	flushed := make(chan []string)
+	go func() {
+		if err := ah.Flush(); err != nil {
+			t.Errorf("cannot flush: %v", err)
+		}
+		flushed <- h.messages()
+	}()
+	time.Sleep(50 * time.Millisecond)
+	for _, msg := range []string{"3", "4"} {
+		if err := handleMsg(ah, msg); err != nil {
+			t.Fatalf("cannot handle: %v", err)
+		}
+	}
+	if n := ah.Dropped(); n != 1 {
+		t.Errorf("expected 1 dropped, got %d", n)
+	}
+
+	select {
+	case <-flushed:
+		t.Fatalf("flush completed before earlier records were handled")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(h.block)
+	select {
+	case got := <-flushed:
+		if len(got) == 0 || got[0] != "1" {
+			t.Errorf("expected record 1 to be handled before the flush completed, got %q", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("flush did not complete")
+	}
+
+	ah.Close()
+	if got := h.messages(); !equalStrings(got, []string{"1", "3", "4"}) {
+		t.Errorf("unexpected records handled: %q", got)
+	}
+}
+
+func TestAsyncHandlerDrain(t *testing.T) {
+	// All queued records are handled if ctx is not done.
+	h := &recordingHandler{}
+	ah := slogdispatch.NewAsyncHandler(h, nil)
+	for _, msg := range []string{"1", "2", "3"} {
+		if err := handleMsg(ah, msg); err != nil {
+			t.Fatalf("cannot handle: %v", err)
+		}
+	}
+	if n, err := ah.Drain(context.Background()); n != 0 || err != nil {
+		t.Errorf("expected 0, nil, got %d, %v", n, err)
+	}
+	if got := h.messages(); !equalStrings(got, []string{"1", "2", "3"}) {
+		t.Errorf("unexpected records handled: %q", got)
+	}
+
+	// Otherwise, the records not yet handled are discarded.
+	h = newBlockingHandler()
+	ah = slogdispatch.NewAsyncHandler(h, nil)
+	handleStarted(t, ah, h, "1")
+	for _, msg := range []string{"2", "3"} {
+		if err := handleMsg(ah, msg); err != nil {
+			t.Fatalf("cannot handle: %v", err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if n, err := ah.Drain(ctx); n != 2 || err != context.Canceled {
+		t.Errorf("expected 2, context.Canceled, got %d, %v", n, err)
+	}
+	if n := ah.Dropped(); n != 2 {
+		t.Errorf("expected 2 dropped, got %d", n)
+	}
+	if err := handleMsg(ah, "4"); err != slogdispatch.ErrClosed {
+		t.Errorf("expected ErrClosed, got %v", err)
+	}
+
+	// Draining or closing again has no effect.
+	if n, err := ah.Drain(ctx); n != 0 || err != nil {
+		t.Errorf("expected 0, nil from second Drain, got %d, %v", n, err)
+	}
+	if err := ah.Close(); err != slogdispatch.ErrClosed {
+		t.Errorf("expected ErrClosed from Close after Drain, got %v", err)
+	}
+	if err := ah.Flush(); err != slogdispatch.ErrClosed {
+		t.Errorf("expected ErrClosed from Flush after Drain, got %v", err)
+	}
+
+	close(h.block)
+}
+
+func TestAsyncHandlerClose(t *testing.T) {
+	errFailed := errors.New("failed")
+	h := &recordingHandler{err: errFailed}
+	var mu sync.Mutex
+	var errs []error
+	ah := slogdispatch.NewAsyncHandler(h, &slogdispatch.AsyncHandlerOptions{
+		OnError: func(err error, r slog.Record) {
+			mu.Lock()
+			defer mu.Unlock()
+			errs = append(errs, err)
+		},
+	})
+
+	// Records handled by derived handlers share the queue.
+	if err := handleMsg(ah, "1"); err != nil {
+		t.Fatalf("cannot handle: %v", err)
+	}
+	if err := handleMsg(ah.WithAttrs([]slog.Attr{slog.Int("a", 1)}), "2"); err != nil {
+		t.Fatalf("cannot handle: %v", err)
+	}
+	if err := ah.Close(); err != nil {
+		t.Errorf("cannot close: %v", err)
+	}
+	if got := h.messages(); !equalStrings(got, []string{"1", "2"}) {
+		t.Errorf("unexpected records handled: %q", got)
+	}
+	if len(errs) != 2 || errs[0] != errFailed {
+		t.Errorf("expected OnError to be called twice, got %v", errs)
+	}
+
+	if err := handleMsg(ah, "3"); err != slogdispatch.ErrClosed {
+		t.Errorf("expected ErrClosed, got %v", err)
+	}
+	if err := ah.Close(); err != slogdispatch.ErrClosed {
+		t.Errorf("expected ErrClosed from second Close, got %v", err)
+	}
+}
+
+// A handler which fails if its context has been cancelled, as a handler
+// bounding a network write by the context would. Handle first waits for
+// release to be closed.
+type ctxHandler struct {
+	recordingHandler
+	release chan struct{}
+}
+
+type ctxKey struct{}
+
+func (h *ctxHandler) Handle(ctx context.Context, r slog.Record) error {
+	<-h.release
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if ctx.Value(ctxKey{}) != "v" {
+		return errors.New("context value missing")
+	}
+	return h.recordingHandler.Handle(ctx, r)
+}
+
+func TestAsyncHandlerDetachedContext(t *testing.T) {
+	h := &ctxHandler{release: make(chan struct{})}
+	var errs []error
+	ah := slogdispatch.NewAsyncHandler(h, &slogdispatch.AsyncHandlerOptions{
+		OnError: func(err error, r slog.Record) { errs = append(errs, err) },
+	})
+
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), ctxKey{}, "v"))
+	if err := ah.Handle(ctx, slog.NewRecord(time.Time{}, slog.LevelInfo, "1", 0)); err != nil {
+		t.Fatalf("cannot handle: %v", err)
+	}
+	cancel()
+	close(h.release)
+	if err := ah.Close(); err != nil {
+		t.Errorf("cannot close: %v", err)
+	}
+	if len(errs) != 0 {
+		t.Errorf("unexpected errors: %v", errs)
+	}
+	if got := h.messages(); !equalStrings(got, []string{"1"}) {
+		t.Errorf("unexpected records handled: %q", got)
+	}
+}
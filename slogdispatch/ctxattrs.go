@@ -0,0 +1,85 @@
+package slogdispatch
+
+import (
+	"context"
+
+	"golang.org/x/exp/slog"
+)
+
+// Context Attrs Handler
+
+// A function which returns attributes to be added to a record based on the
+// context it is logged with, such as a request ID or trace ID. It may return
+// nil.
+type ContextExtractor func(ctx context.Context) []slog.Attr
+
+// Returns a ContextExtractor which returns an attribute with the given key
+// whose value is ctx.Value(ctxKey), if it is non-nil.
+func ContextValue(key string, ctxKey any) ContextExtractor {
+	return func(ctx context.Context) []slog.Attr {
+		v := ctx.Value(ctxKey)
+		if v == nil {
+			return nil
+		}
+		return []slog.Attr{slog.Any(key, v)}
+	}
+}
+
+type contextAttrsHandler struct {
+	h          slog.Handler
+	extractors []ContextExtractor
+}
+
+// Creates a slog.Handler which adds the attributes returned by each of the
+// extractors to each record before passing it to h. The attributes are added
+// after the attributes of the record, and so are inside any groups started
+// using WithGroup.
+func NewContextAttrsHandler(h slog.Handler, extractors ...ContextExtractor) slog.Handler {
+	return &contextAttrsHandler{
+		h:          h,
+		extractors: extractors,
+	}
+}
+
+var _ slog.Handler = &contextAttrsHandler{}
+
+func (ch *contextAttrsHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return ch.h.Enabled(ctx, level)
+}
+
+func (ch *contextAttrsHandler) Handle(ctx context.Context, record slog.Record) error {
+	var attrs []slog.Attr
+	for _, f := range ch.extractors {
+		attrs = append(attrs, f(ctx)...)
+	}
+
+	if len(attrs) > 0 {
+		record = record.Clone()
+		record.AddAttrs(attrs...)
+	}
+
+	return ch.h.Handle(ctx, record)
+}
+
+func (ch *contextAttrsHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextAttrsHandler{
+		h:          ch.h.WithAttrs(attrs),
+		extractors: ch.extractors,
+	}
+}
+
+func (ch *contextAttrsHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return ch
+	}
+
+	return &contextAttrsHandler{
+		h:          ch.h.WithGroup(name),
+		extractors: ch.extractors,
+	}
+}
+
+// Implements Parent.
+func (ch *contextAttrsHandler) Children() []slog.Handler {
+	return []slog.Handler{ch.h}
+}
@@ -0,0 +1,171 @@
+package slogdispatch
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+// Dedup Handler
+
+// Options for NewDedupHandler.
+type DedupHandlerOptions struct {
+	// The length of time after a record is passed on during which identical
+	// records are suppressed. If zero, ten seconds is used.
+	Window time.Duration
+
+	// The keys of the record attributes which are compared when determining
+	// whether records are identical, in addition to the level and message. If
+	// nil, all attributes of the record are compared. Attributes added using
+	// WithAttrs are not compared, but records logged using different derived
+	// handlers are never considered identical.
+	Keys []string
+}
+
+// The key of the attribute containing the number of times a record was
+// repeated.
+const repeatedKey = "repeated"
+
+type dedupEntry struct {
+	h     slog.Handler
+	last  slog.Record // most recent suppressed record
+	count uint64      // number of records suppressed
+}
+
+type dedupKey struct {
+	h           *dedupHandler
+	fingerprint string
+}
+
+// State shared between a dedup handler and all handlers derived from it.
+type dedupState struct {
+	opts DedupHandlerOptions
+	keys map[string]struct{} // nil if all keys are compared
+
+	mu      sync.Mutex
+	entries map[dedupKey]*dedupEntry
+}
+
+type dedupHandler struct {
+	s *dedupState
+	h slog.Handler
+}
+
+// Creates a slog.Handler which passes records on to h, but suppresses records
+// identical to one already passed on within the last opts.Window. When the
+// window closes, if any records were suppressed, the most recent suppressed
+// record is passed on with an attribute "repeated" giving the number of records
+// suppressed. Records are considered identical if they have the same level,
+// message and attributes (see DedupHandlerOptions.Keys).
+//
+// If opts is nil, the default options are used.
+func NewDedupHandler(h slog.Handler, opts *DedupHandlerOptions) slog.Handler {
+	s := &dedupState{
+		entries: map[dedupKey]*dedupEntry{},
+	}
+	if opts != nil {
+		s.opts = *opts
+	}
+	if s.opts.Window <= 0 {
+		s.opts.Window = 10 * time.Second
+	}
+	if s.opts.Keys != nil {
+		s.keys = make(map[string]struct{}, len(s.opts.Keys))
+		for _, k := range s.opts.Keys {
+			s.keys[k] = struct{}{}
+		}
+	}
+	return &dedupHandler{
+		s: s,
+		h: h,
+	}
+}
+
+var _ slog.Handler = &dedupHandler{}
+
+func (dh *dedupHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return dh.h.Enabled(ctx, level)
+}
+
+// Returns a string identifying records considered identical.
+func (s *dedupState) fingerprint(record slog.Record) string {
+	var b strings.Builder
+	b.WriteString(record.Level.String())
+	b.WriteByte(0)
+	b.WriteString(record.Message)
+	record.Attrs(func(a slog.Attr) bool {
+		if s.keys != nil {
+			if _, ok := s.keys[a.Key]; !ok {
+				return true
+			}
+		}
+		b.WriteByte(0)
+		b.WriteString(a.Key)
+		b.WriteByte('=')
+		b.WriteString(a.Value.Resolve().String())
+		return true
+	})
+	return b.String()
+}
+
+func (dh *dedupHandler) Handle(ctx context.Context, record slog.Record) error {
+	k := dedupKey{dh, dh.s.fingerprint(record)}
+
+	dh.s.mu.Lock()
+	if e, ok := dh.s.entries[k]; ok {
+		e.last = record.Clone()
+		e.count++
+		dh.s.mu.Unlock()
+		return nil
+	}
+	dh.s.entries[k] = &dedupEntry{h: dh.h}
+	dh.s.mu.Unlock()
+
+	time.AfterFunc(dh.s.opts.Window, func() {
+		dh.s.closeWindow(k)
+	})
+
+	return dh.h.Handle(ctx, record)
+}
+
+// Removes the entry for k, passing on the most recent suppressed record if
+// there is one.
+func (s *dedupState) closeWindow(k dedupKey) {
+	s.mu.Lock()
+	e := s.entries[k]
+	delete(s.entries, k)
+	s.mu.Unlock()
+
+	if e == nil || e.count == 0 {
+		return
+	}
+
+	e.last.AddAttrs(slog.Uint64(repeatedKey, e.count))
+	e.h.Handle(context.Background(), e.last)
+}
+
+func (dh *dedupHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &dedupHandler{
+		s: dh.s,
+		h: dh.h.WithAttrs(attrs),
+	}
+}
+
+func (dh *dedupHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return dh
+	}
+
+	return &dedupHandler{
+		s: dh.s,
+		h: dh.h.WithGroup(name),
+	}
+}
+
+// Implements Parent.
+func (dh *dedupHandler) Children() []slog.Handler {
+	return []slog.Handler{dh.h}
+}
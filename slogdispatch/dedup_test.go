@@ -0,0 +1,56 @@
+package slogdispatch_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hlandau/slogkit/slogdispatch"
+	"golang.org/x/exp/slog"
+)
+
+func TestDedupHandler(t *testing.T) {
+	h := &recordingHandler{}
+	dh := slogdispatch.NewDedupHandler(h, &slogdispatch.DedupHandlerOptions{
+		Window: 50 * time.Millisecond,
+		Keys:   []string{"id"},
+	})
+
+	handle := func(msg string, id, other int) {
+		r := slog.NewRecord(time.Time{}, slog.LevelInfo, msg, 0)
+		r.AddAttrs(slog.Int("id", id), slog.Int("other", other))
+		if err := dh.Handle(context.Background(), r); err != nil {
+			t.Fatalf("cannot handle: %v", err)
+		}
+	}
+
+	// Attributes other than the keys are not compared.
+	handle("a", 1, 1)
+	handle("a", 1, 2)
+	handle("a", 1, 3)
+	handle("a", 2, 1)
+	handle("b", 1, 1)
+	if got := h.messages(); !equalStrings(got, []string{"a", "a", "b"}) {
+		t.Errorf("unexpected records passed on: %q", got)
+	}
+
+	// When the window closes, the last suppressed record is passed on with a
+	// count.
+	deadline := time.Now().Add(5 * time.Second)
+	for len(h.records()) < 4 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	recs := h.records()
+	if len(recs) != 4 {
+		t.Fatalf("expected 4 records, got %d", len(recs))
+	}
+	if r := recs[3]; r.Message != "a" || recordAttr(r, "other").Int64() != 3 || recordAttr(r, "repeated").Uint64() != 2 {
+		t.Errorf("unexpected repeat record: %q other=%v repeated=%v", r.Message, recordAttr(r, "other"), recordAttr(r, "repeated"))
+	}
+
+	// Once the window has closed, the record is passed on again.
+	handle("a", 1, 4)
+	if got := h.messages(); len(got) != 5 {
+		t.Errorf("expected record to be passed on after the window, got %q", got)
+	}
+}
@@ -0,0 +1,195 @@
+package slogdispatch
+
+import (
+	"context"
+	"sync"
+
+	"golang.org/x/exp/slog"
+)
+
+// Dynamic Multi Handler
+
+type multiMember struct {
+	id uint64
+	h  slog.Handler
+}
+
+// The members of a dynamic multi handler, shared between it and all handlers
+// derived from it.
+type multiMemberSet struct {
+	m       sync.RWMutex
+	members []multiMember // replaced, not modified, when the members change
+	gen     uint64        // incremented when the members change
+	nextID  uint64
+}
+
+func (ms *multiMemberSet) get() ([]multiMember, uint64) {
+	ms.m.RLock()
+	defer ms.m.RUnlock()
+	return ms.members, ms.gen
+}
+
+// A slog.Handler which dispatches to a set of handlers which can be changed at
+// runtime. See NewDynamicMultiHandler.
+type DynamicMultiHandler struct {
+	set       *multiMemberSet
+	opts      MultiHandlerOptions
+	parent    *DynamicMultiHandler
+	attrs     []slog.Attr
+	groupName string
+
+	m       sync.Mutex
+	gen     uint64                  // generation of members mh corresponds to
+	mh      *multiHandler           // dispatches to the derived members
+	derived map[uint64]slog.Handler // derived handlers by member ID
+}
+
+// Creates a handler which dispatches to each handler in the slice passed, like
+// a handler created using NewMultiHandlerWithOptions, but to which handlers can
+// be added and from which they can be removed at runtime. If opts is nil, the
+// default options are used.
+func NewDynamicMultiHandler(handlers []slog.Handler, opts *MultiHandlerOptions) *DynamicMultiHandler {
+	dh := &DynamicMultiHandler{
+		set: &multiMemberSet{gen: 1},
+	}
+	if opts != nil {
+		dh.opts = *opts
+	}
+	for _, h := range handlers {
+		dh.Add(h)
+	}
+	return dh
+}
+
+var _ slog.Handler = &DynamicMultiHandler{}
+
+// Adds a handler. The change affects the handler it is called on, the handler
+// it was derived from and all other handlers derived from it. The attributes
+// and groups added to each of those handlers using WithAttrs and WithGroup are
+// applied to h for records logged using that handler, just as for the
+// handlers passed to NewDynamicMultiHandler.
+//
+// Returns a function which removes the handler again.
+func (dh *DynamicMultiHandler) Add(h slog.Handler) (remove func()) {
+	ms := dh.set
+	ms.m.Lock()
+	defer ms.m.Unlock()
+
+	ms.nextID++
+	id := ms.nextID
+	ms.members = append(ms.members[:len(ms.members):len(ms.members)], multiMember{id, h})
+	ms.gen++
+
+	return func() {
+		ms.m.Lock()
+		defer ms.m.Unlock()
+
+		for i, m := range ms.members {
+			if m.id == id {
+				members := make([]multiMember, 0, len(ms.members)-1)
+				members = append(members, ms.members[:i]...)
+				ms.members = append(members, ms.members[i+1:]...)
+				ms.gen++
+				return
+			}
+		}
+	}
+}
+
+// Returns the handlers currently dispatched to, without any attributes or
+// groups added using WithAttrs or WithGroup.
+func (dh *DynamicMultiHandler) Handlers() []slog.Handler {
+	members, _ := dh.set.get()
+	handlers := make([]slog.Handler, len(members))
+	for i, m := range members {
+		handlers[i] = m.h
+	}
+	return handlers
+}
+
+// Derives a handler from base using the attributes and groups of dh and its
+// parents.
+func (dh *DynamicMultiHandler) deriveHandler(base slog.Handler) slog.Handler {
+	if dh.parent != nil {
+		base = dh.parent.deriveHandler(base)
+	}
+
+	if dh.attrs != nil {
+		attrs := make([]slog.Attr, len(dh.attrs))
+		copy(attrs, dh.attrs)
+		base = base.WithAttrs(attrs)
+	}
+
+	if dh.groupName != "" {
+		base = base.WithGroup(dh.groupName)
+	}
+
+	return base
+}
+
+// Returns a multiHandler dispatching to the current members, derived using the
+// attributes and groups of dh.
+func (dh *DynamicMultiHandler) current() *multiHandler {
+	members, gen := dh.set.get()
+
+	dh.m.Lock()
+	defer dh.m.Unlock()
+
+	if dh.mh != nil && dh.gen >= gen {
+		return dh.mh
+	}
+
+	derived := make(map[uint64]slog.Handler, len(members))
+	handlers := make([]slog.Handler, len(members))
+	for i, m := range members {
+		h, ok := dh.derived[m.id]
+		if !ok {
+			h = dh.deriveHandler(m.h)
+		}
+		derived[m.id] = h
+		handlers[i] = h
+	}
+
+	dh.gen = gen
+	dh.derived = derived
+	dh.mh = &multiHandler{
+		handlers: handlers,
+		opts:     dh.opts,
+	}
+	return dh.mh
+}
+
+func (dh *DynamicMultiHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return dh.current().Enabled(ctx, level)
+}
+
+func (dh *DynamicMultiHandler) Handle(ctx context.Context, record slog.Record) error {
+	return dh.current().Handle(ctx, record)
+}
+
+func (dh *DynamicMultiHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &DynamicMultiHandler{
+		set:    dh.set,
+		opts:   dh.opts,
+		parent: dh,
+		attrs:  attrs,
+	}
+}
+
+func (dh *DynamicMultiHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return dh
+	}
+
+	return &DynamicMultiHandler{
+		set:       dh.set,
+		opts:      dh.opts,
+		parent:    dh,
+		groupName: name,
+	}
+}
+
+// Implements Parent.
+func (dh *DynamicMultiHandler) Children() []slog.Handler {
+	return dh.current().handlers
+}
@@ -0,0 +1,482 @@
+package slogdispatch
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/exp/slog"
+)
+
+// Match Expressions
+
+// Compiles a match expression into a MatchFunc, so that routing rules can be
+// specified in configuration files. For example:
+//
+//	level >= WARN && attr("facility") =~ "^acme/db"
+//
+// An expression is one or more comparisons or function calls combined using
+// "&&", "||" and "!", and grouped using parentheses. The following can appear
+// on the left-hand side of a comparison:
+//
+//   - level: the level of the record, which can be compared with a level name
+//     such as DEBUG, INFO, WARN or ERROR, optionally followed by an offset
+//     (e.g. ERROR+4 or WARN - 2), or with a number.
+//   - msg: the message of the record, which can be compared with a string.
+//   - attr("key"): the value of the attribute of the record with the given key
+//     (see MatchFunc), which can be compared with a string or a number. When
+//     compared with a number, only numeric values match. If the record has no
+//     such attribute, the comparison is false, whatever the operator.
+//
+// The comparison operators are ==, !=, <, <=, > and >=, and =~ and !~, which
+// match a string against a regular expression given as a string literal.
+// Strings are enclosed in double quotes and use Go escape sequences.
+//
+// The function has("key") is true if the record has an attribute with the
+// given key, and true and false are also accepted.
+func ParseMatch(expr string) (MatchFunc, error) {
+	toks, err := lexMatch(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &matchParser{toks: toks}
+	f, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, p.errorf(t, "unexpected %q", t.text)
+	}
+	return f, nil
+}
+
+// Like ParseMatch, but panics if the expression cannot be parsed.
+func MustParseMatch(expr string) MatchFunc {
+	f, err := ParseMatch(expr)
+	if err != nil {
+		panic(err)
+	}
+	return f
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokString
+	tokNumber
+	tokOp
+)
+
+type token struct {
+	kind tokenKind
+	text string // for tokString, the unquoted string
+	pos  int
+}
+
+// Operators, with longer operators before their prefixes.
+var matchOps = []string{"&&", "||", "==", "!=", "<=", ">=", "=~", "!~", "<", ">", "!", "(", ")", "+", "-"}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func lexMatch(s string) ([]token, error) {
+	var toks []token
+	i := 0
+outer:
+	for i < len(s) {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+
+		case isIdentStart(c):
+			j := i + 1
+			for j < len(s) && (isIdentStart(s[j]) || isDigit(s[j])) {
+				j++
+			}
+			toks = append(toks, token{tokIdent, s[i:j], i})
+			i = j
+
+		case isDigit(c):
+			j := i + 1
+			for j < len(s) && (isDigit(s[j]) || s[j] == '.') {
+				j++
+			}
+			toks = append(toks, token{tokNumber, s[i:j], i})
+			i = j
+
+		case c == '"':
+			j := i + 1
+			for j < len(s) && s[j] != '"' {
+				if s[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(s) {
+				return nil, fmt.Errorf("slogdispatch: unterminated string at offset %d", i)
+			}
+			str, err := strconv.Unquote(s[i : j+1])
+			if err != nil {
+				return nil, fmt.Errorf("slogdispatch: invalid string at offset %d: %v", i, err)
+			}
+			toks = append(toks, token{tokString, str, i})
+			i = j + 1
+
+		default:
+			for _, op := range matchOps {
+				if strings.HasPrefix(s[i:], op) {
+					toks = append(toks, token{tokOp, op, i})
+					i += len(op)
+					continue outer
+				}
+			}
+			return nil, fmt.Errorf("slogdispatch: unexpected character %q at offset %d", c, i)
+		}
+	}
+	return append(toks, token{tokEOF, "end of expression", len(s)}), nil
+}
+
+type matchParser struct {
+	toks []token
+	i    int
+}
+
+func (p *matchParser) peek() token {
+	return p.toks[p.i]
+}
+
+func (p *matchParser) next() token {
+	t := p.toks[p.i]
+	if t.kind != tokEOF {
+		p.i++
+	}
+	return t
+}
+
+// Consumes the next token if it is the given operator.
+func (p *matchParser) accept(op string) bool {
+	if t := p.peek(); t.kind == tokOp && t.text == op {
+		p.i++
+		return true
+	}
+	return false
+}
+
+func (p *matchParser) expect(op string) error {
+	if !p.accept(op) {
+		t := p.peek()
+		return p.errorf(t, "expected %q, got %q", op, t.text)
+	}
+	return nil
+}
+
+func (p *matchParser) errorf(t token, format string, args ...any) error {
+	return fmt.Errorf("slogdispatch: "+format+" at offset %d", append(args, t.pos)...)
+}
+
+func (p *matchParser) parseOr() (MatchFunc, error) {
+	f, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	fs := []MatchFunc{f}
+	for p.accept("||") {
+		f, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		fs = append(fs, f)
+	}
+	if len(fs) == 1 {
+		return fs[0], nil
+	}
+	return Or(fs...), nil
+}
+
+func (p *matchParser) parseAnd() (MatchFunc, error) {
+	f, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	fs := []MatchFunc{f}
+	for p.accept("&&") {
+		f, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		fs = append(fs, f)
+	}
+	if len(fs) == 1 {
+		return fs[0], nil
+	}
+	return And(fs...), nil
+}
+
+func (p *matchParser) parseUnary() (MatchFunc, error) {
+	if p.accept("!") {
+		f, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return Not(f), nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *matchParser) parsePrimary() (MatchFunc, error) {
+	if p.accept("(") {
+		f, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return f, nil
+	}
+
+	t := p.peek()
+	if t.kind == tokIdent {
+		switch t.text {
+		case "true", "false":
+			p.next()
+			v := t.text == "true"
+			return func(ctx context.Context, args ResolveArgs) bool {
+				return v
+			}, nil
+		case "has":
+			p.next()
+			key, err := p.parseCallArg()
+			if err != nil {
+				return nil, err
+			}
+			return AttrPresent(key), nil
+		}
+	}
+
+	return p.parseComparison()
+}
+
+// Parses the parenthesised string argument of a function.
+func (p *matchParser) parseCallArg() (string, error) {
+	if err := p.expect("("); err != nil {
+		return "", err
+	}
+	t := p.next()
+	if t.kind != tokString {
+		return "", p.errorf(t, "expected string, got %q", t.text)
+	}
+	if err := p.expect(")"); err != nil {
+		return "", err
+	}
+	return t.text, nil
+}
+
+func isComparisonOp(op string) bool {
+	switch op {
+	case "==", "!=", "<", "<=", ">", ">=", "=~", "!~":
+		return true
+	default:
+		return false
+	}
+}
+
+func (p *matchParser) parseComparison() (MatchFunc, error) {
+	lhs := p.next()
+	if lhs.kind != tokIdent {
+		return nil, p.errorf(lhs, "expected level, msg, attr or has, got %q", lhs.text)
+	}
+	var key string
+	if lhs.text == "attr" {
+		var err error
+		if key, err = p.parseCallArg(); err != nil {
+			return nil, err
+		}
+	}
+
+	opTok := p.next()
+	if opTok.kind != tokOp || !isComparisonOp(opTok.text) {
+		return nil, p.errorf(opTok, "expected comparison operator, got %q", opTok.text)
+	}
+	op := opTok.text
+
+	rhs := p.nextOperand()
+	var re *regexp.Regexp
+	if op == "=~" || op == "!~" {
+		if rhs.kind != tokString {
+			return nil, p.errorf(rhs, "expected regular expression string, got %q", rhs.text)
+		}
+		var err error
+		if re, err = regexp.Compile(rhs.text); err != nil {
+			return nil, p.errorf(rhs, "invalid regular expression: %v", err)
+		}
+	}
+
+	switch lhs.text {
+	case "level":
+		if re != nil {
+			return nil, p.errorf(opTok, "cannot match level against regular expression")
+		}
+		level, err := p.parseLevel(rhs)
+		if err != nil {
+			return nil, err
+		}
+		return func(ctx context.Context, args ResolveArgs) bool {
+			return compareResult(op, compareFloat(float64(args.Level), float64(level)))
+		}, nil
+
+	case "msg":
+		if re == nil && rhs.kind != tokString {
+			return nil, p.errorf(rhs, "expected string, got %q", rhs.text)
+		}
+		return func(ctx context.Context, args ResolveArgs) bool {
+			return args.Record != nil && compareString(op, args.Record.Message, rhs.text, re)
+		}, nil
+
+	case "attr":
+		switch {
+		case re != nil || rhs.kind == tokString:
+			return func(ctx context.Context, args ResolveArgs) bool {
+				a, ok := findAttr(args.Record, key)
+				return ok && compareString(op, a.Value.Resolve().String(), rhs.text, re)
+			}, nil
+
+		case rhs.kind == tokNumber:
+			n, err := strconv.ParseFloat(rhs.text, 64)
+			if err != nil {
+				return nil, p.errorf(rhs, "invalid number %q", rhs.text)
+			}
+			return func(ctx context.Context, args ResolveArgs) bool {
+				a, ok := findAttr(args.Record, key)
+				if !ok {
+					return false
+				}
+				v, ok := numericValue(a.Value.Resolve())
+				return ok && compareResult(op, compareFloat(v, n))
+			}, nil
+
+		default:
+			return nil, p.errorf(rhs, "expected string or number, got %q", rhs.text)
+		}
+
+	default:
+		return nil, p.errorf(lhs, "unknown field %q", lhs.text)
+	}
+}
+
+// Consumes the right-hand operand of a comparison, combining a leading sign
+// with the number following it.
+func (p *matchParser) nextOperand() token {
+	t := p.next()
+	if t.kind == tokOp && (t.text == "-" || t.text == "+") && p.peek().kind == tokNumber {
+		n := p.next()
+		if t.text == "-" {
+			n.text = "-" + n.text
+		}
+		n.pos = t.pos
+		return n
+	}
+	return t
+}
+
+// Parses a level name or number. A level name may be followed by an offset,
+// such as ERROR+4 or WARN - 2.
+func (p *matchParser) parseLevel(t token) (slog.Level, error) {
+	switch t.kind {
+	case tokNumber:
+		n, err := strconv.Atoi(t.text)
+		if err != nil {
+			return 0, p.errorf(t, "invalid level %q", t.text)
+		}
+		return slog.Level(n), nil
+	case tokIdent:
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(t.text)); err != nil {
+			return 0, p.errorf(t, "invalid level %q", t.text)
+		}
+		if sign := p.peek(); sign.kind == tokOp && (sign.text == "+" || sign.text == "-") {
+			p.next()
+			n := p.next()
+			offset, err := strconv.Atoi(n.text)
+			if n.kind != tokNumber || err != nil {
+				return 0, p.errorf(n, "invalid level offset %q", n.text)
+			}
+			if sign.text == "-" {
+				offset = -offset
+			}
+			level += slog.Level(offset)
+		}
+		return level, nil
+	default:
+		return 0, p.errorf(t, "expected level, got %q", t.text)
+	}
+}
+
+// Returns the value of a numeric slog.Value as a float64.
+func numericValue(v slog.Value) (float64, bool) {
+	switch v.Kind() {
+	case slog.KindInt64:
+		return float64(v.Int64()), true
+	case slog.KindUint64:
+		return float64(v.Uint64()), true
+	case slog.KindFloat64:
+		return v.Float64(), true
+	default:
+		return 0, false
+	}
+}
+
+func compareFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// Compares s against t using op, or matches s against re if it is non-nil.
+func compareString(op, s, t string, re *regexp.Regexp) bool {
+	switch op {
+	case "=~":
+		return re.MatchString(s)
+	case "!~":
+		return !re.MatchString(s)
+	default:
+		return compareResult(op, strings.Compare(s, t))
+	}
+}
+
+// Returns the result of a comparison operator given the result of comparing
+// its operands.
+func compareResult(op string, c int) bool {
+	switch op {
+	case "==":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	default:
+		return false
+	}
+}
@@ -0,0 +1,163 @@
+package slogdispatch_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hlandau/slogkit/slogdispatch"
+	"golang.org/x/exp/slog"
+)
+
+func newRecord(level slog.Level, msg string, attrs ...slog.Attr) *slog.Record {
+	r := slog.NewRecord(time.Time{}, level, msg, 0)
+	r.AddAttrs(attrs...)
+	return &r
+}
+
+var (
+	recDebug = newRecord(slog.LevelDebug, "hello world")
+	recInfo  = newRecord(slog.LevelInfo, "hello world",
+		slog.Int("n", -3), slog.String("s", "abc"), slog.String("ns", "42"))
+	recWarn  = newRecord(slog.LevelWarn, "goodbye")
+	recError = newRecord(slog.LevelError+4, "failed", slog.Int("n", 42))
+)
+
+var parseMatchTests = []struct {
+	Expr    string
+	Matches []*slog.Record
+	Misses  []*slog.Record
+}{
+	{`level >= WARN`, []*slog.Record{recWarn, recError}, []*slog.Record{recDebug, recInfo}},
+	{`level >= WARN-4`, []*slog.Record{recInfo, recWarn}, []*slog.Record{recDebug}},
+	{`level >= WARN - 4`, []*slog.Record{recInfo, recWarn}, []*slog.Record{recDebug}},
+	{`level == ERROR+4`, []*slog.Record{recError}, []*slog.Record{recWarn}},
+	{`level == error + 4`, []*slog.Record{recError}, []*slog.Record{recWarn}},
+	{`level >= -4`, []*slog.Record{recDebug, recInfo}, []*slog.Record{newRecord(slog.LevelDebug-1, "")}},
+	{`level < 0`, []*slog.Record{recDebug}, []*slog.Record{recInfo}},
+
+	// && binds more tightly than ||.
+	{`true || false && false`, []*slog.Record{recInfo}, nil},
+	{`false && false || true`, []*slog.Record{recInfo}, nil},
+	{`(true || false) && false`, nil, []*slog.Record{recInfo}},
+	{`level == INFO || level == WARN && msg == "x"`, []*slog.Record{recInfo}, []*slog.Record{recWarn}},
+
+	{`!true`, nil, []*slog.Record{recInfo}},
+	{`!!true`, []*slog.Record{recInfo}, nil},
+	{`!(false || level == INFO)`, []*slog.Record{recWarn}, []*slog.Record{recInfo}},
+	{`!has("n") && level > DEBUG`, []*slog.Record{recWarn}, []*slog.Record{recDebug, recInfo}},
+
+	{`msg == "goodbye"`, []*slog.Record{recWarn}, []*slog.Record{recInfo}},
+	{`msg < "h"`, []*slog.Record{recWarn, recError}, []*slog.Record{recInfo}},
+	{`msg =~ "^hel+o"`, []*slog.Record{recInfo}, []*slog.Record{recWarn}},
+	{`msg !~ "^hel+o"`, []*slog.Record{recWarn}, []*slog.Record{recInfo}},
+	{"msg == \"hello\\u0020world\"", []*slog.Record{recInfo}, []*slog.Record{recWarn}},
+
+	{`attr("s") == "abc"`, []*slog.Record{recInfo}, []*slog.Record{recWarn}},
+	{`attr("s") =~ "b"`, []*slog.Record{recInfo}, []*slog.Record{recWarn}},
+	{`attr("n") > -5`, []*slog.Record{recInfo, recError}, []*slog.Record{recWarn}},
+	{`attr("n") < - 2.5`, []*slog.Record{recInfo}, []*slog.Record{recError}},
+	{`attr("n") == 42`, []*slog.Record{recError}, []*slog.Record{recInfo}},
+	{`attr("n") == +42`, []*slog.Record{recError}, []*slog.Record{recInfo}},
+
+	// A non-numeric value never matches a number.
+	{`attr("ns") == 42 || attr("ns") != 42`, nil, []*slog.Record{recInfo}},
+
+	// If the attribute is missing, every comparison is false.
+	{`attr("missing") == "x"`, nil, []*slog.Record{recInfo}},
+	{`attr("missing") != "x"`, nil, []*slog.Record{recInfo}},
+	{`attr("missing") !~ "x"`, nil, []*slog.Record{recInfo}},
+	{`attr("missing") < 5`, nil, []*slog.Record{recInfo}},
+	{`attr("missing") != 5`, nil, []*slog.Record{recInfo}},
+
+	{`has("s")`, []*slog.Record{recInfo}, []*slog.Record{recWarn}},
+	{`has("missing")`, nil, []*slog.Record{recInfo}},
+}
+
+func TestParseMatch(t *testing.T) {
+	for _, test := range parseMatchTests {
+		f, err := slogdispatch.ParseMatch(test.Expr)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.Expr, err)
+			continue
+		}
+
+		for _, r := range test.Matches {
+			if !f(context.Background(), slogdispatch.ResolveArgs{Level: r.Level, Record: r}) {
+				t.Errorf("%s: expected match for %v %q", test.Expr, r.Level, r.Message)
+			}
+		}
+		for _, r := range test.Misses {
+			if f(context.Background(), slogdispatch.ResolveArgs{Level: r.Level, Record: r}) {
+				t.Errorf("%s: expected no match for %v %q", test.Expr, r.Level, r.Message)
+			}
+		}
+	}
+}
+
+var parseMatchErrorTests = []struct {
+	Expr   string
+	Error  string
+	Offset int
+}{
+	{``, "expected level, msg, attr or has", 0},
+	{`level >=`, "expected level", 8},
+	{`level >= BOGUS`, "invalid level", 9},
+	{`level >= WARN +`, "invalid level offset", 15},
+	{`level >= WARN + x`, "invalid level offset", 16},
+	{`level =~ "x"`, "cannot match level against regular expression", 6},
+	{`level WARN`, "expected comparison operator", 6},
+	{`msg == 5`, "expected string", 7},
+	{`msg =~ "["`, "invalid regular expression", 7},
+	{`msg =~ 5`, "expected regular expression string", 7},
+	{`attr("a") == level`, "expected string or number", 13},
+	{`attr(a) == 1`, "expected string", 5},
+	{`attr("a" == 1`, `expected ")"`, 9},
+	{`attr("a") > 1.2.3`, "invalid number", 12},
+	{`has("a"`, `expected ")"`, 7},
+	{`foo == 1`, "unknown field", 0},
+	{`(true`, `expected ")"`, 5},
+	{`true)`, "unexpected", 4},
+	{`true &&`, "expected level, msg, attr or has", 7},
+	{`true || !`, "expected level, msg, attr or has", 9},
+	{`@`, "unexpected character", 0},
+	{`msg == "abc`, "unterminated string", 7},
+	{`msg == "\q"`, "invalid string", 7},
+}
+
+func TestParseMatchErrors(t *testing.T) {
+	for _, test := range parseMatchErrorTests {
+		_, err := slogdispatch.ParseMatch(test.Expr)
+		if err == nil {
+			t.Errorf("%s: expected error", test.Expr)
+			continue
+		}
+
+		msg := err.Error()
+		if !strings.Contains(msg, test.Error) || !strings.Contains(msg, fmt.Sprintf("offset %d", test.Offset)) {
+			t.Errorf("%s: expected error containing %q at offset %d, got %q", test.Expr, test.Error, test.Offset, msg)
+		}
+	}
+}
+
+func FuzzParseMatch(f *testing.F) {
+	for _, test := range parseMatchTests {
+		f.Add(test.Expr)
+	}
+	for _, test := range parseMatchErrorTests {
+		f.Add(test.Expr)
+	}
+
+	f.Fuzz(func(t *testing.T, expr string) {
+		m, err := slogdispatch.ParseMatch(expr)
+		if err != nil {
+			return
+		}
+		for _, r := range []*slog.Record{recDebug, recInfo, recWarn, recError} {
+			m(context.Background(), slogdispatch.ResolveArgs{Level: r.Level, Record: r})
+		}
+		m(context.Background(), slogdispatch.ResolveArgs{Level: slog.LevelInfo})
+	})
+}
@@ -0,0 +1,160 @@
+package slogdispatch
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"golang.org/x/exp/slog"
+)
+
+// Facility Router
+
+// Associates a handler with a facility and the facilities below it. See
+// NewFacilityRouter.
+type FacilityRoute struct {
+	// The facility name, for example "acme/db". The route matches records
+	// logged by this facility and the facilities below it, such as
+	// "acme/db/pool", but not "acme/dbx". An empty name matches all records.
+	Facility string
+
+	// The handler to dispatch to if this route matches.
+	Handler slog.Handler
+}
+
+type facilityRouter struct {
+	routes   []FacilityRoute // most specific first, ending with the default
+	handlers []slog.Handler  // handlers of routes, derived using WithAttrs and WithGroup
+	groups   []string
+
+	// The facility set using WithAttrs, if any.
+	facility    string
+	hasFacility bool
+}
+
+// Creates a handler which dispatches each record to the handler of the most
+// specific route matching the facility it was logged by, or to defaultHandler
+// if no route matches. If defaultHandler is nil, such records are discarded.
+// For example, to send everything logged by "acme/db" and the facilities below
+// it to a different handler:
+//
+//	h := NewFacilityRouter([]FacilityRoute{{"acme/db", slowQueryHandler}}, appHandler)
+//
+// The facility of a record is the value of its FacilityKey attribute, or
+// failing that, of the last FacilityKey attribute added to the handler using
+// WithAttrs. If there is neither, the names of the groups opened on the
+// handler using WithGroup, joined by '/', are used instead, so that routing
+// can also be performed by group. FacilityKey attributes inside a group are
+// not considered.
+func NewFacilityRouter(routes []FacilityRoute, defaultHandler slog.Handler) slog.Handler {
+	rs := make([]FacilityRoute, 0, len(routes)+1)
+	for _, r := range routes {
+		r.Facility = strings.TrimSuffix(r.Facility, "/")
+		rs = append(rs, r)
+	}
+	sort.SliceStable(rs, func(i, j int) bool {
+		return len(rs[i].Facility) > len(rs[j].Facility)
+	})
+	if defaultHandler != nil {
+		rs = append(rs, FacilityRoute{Handler: defaultHandler})
+	}
+
+	handlers := make([]slog.Handler, len(rs))
+	for i := range rs {
+		handlers[i] = rs[i].Handler
+	}
+
+	return &facilityRouter{
+		routes:   rs,
+		handlers: handlers,
+	}
+}
+
+// Returns the facility of the handler, not taking account of the attributes
+// of any particular record.
+func (fr *facilityRouter) handlerFacility() string {
+	if fr.hasFacility {
+		return fr.facility
+	}
+	return strings.Join(fr.groups, "/")
+}
+
+// Returns the handler of the route matching the given facility, or nil.
+func (fr *facilityRouter) route(facility string) slog.Handler {
+	for i := range fr.routes {
+		if hasPathPrefix(facility, fr.routes[i].Facility) {
+			return fr.handlers[i]
+		}
+	}
+	return nil
+}
+
+func (fr *facilityRouter) Enabled(ctx context.Context, level slog.Level) bool {
+	// The record may yet specify a different facility, unless it is being
+	// logged inside a group.
+	if len(fr.groups) > 0 {
+		h := fr.route(fr.handlerFacility())
+		return h != nil && h.Enabled(ctx, level)
+	}
+
+	for _, h := range fr.handlers {
+		if h.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (fr *facilityRouter) Handle(ctx context.Context, r slog.Record) error {
+	facility := fr.handlerFacility()
+	if len(fr.groups) == 0 {
+		if a, ok := findAttr(&r, FacilityKey); ok {
+			facility = a.Value.Resolve().String()
+		}
+	}
+
+	h := fr.route(facility)
+	if h == nil || !h.Enabled(ctx, r.Level) {
+		return nil
+	}
+	return h.Handle(ctx, r)
+}
+
+func (fr *facilityRouter) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return fr
+	}
+
+	nfr := *fr
+	nfr.handlers = specialiseAll(fr.handlers, attrs, "")
+	if len(fr.groups) == 0 {
+		for _, a := range attrs {
+			if a.Key == FacilityKey {
+				nfr.facility = a.Value.Resolve().String()
+				nfr.hasFacility = true
+			}
+		}
+	}
+	return &nfr
+}
+
+func (fr *facilityRouter) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return fr
+	}
+
+	nfr := *fr
+	nfr.handlers = specialiseAll(fr.handlers, nil, name)
+	nfr.groups = append(fr.groups[:len(fr.groups):len(fr.groups)], name)
+	return &nfr
+}
+
+// Implements Parent. Returns the handlers of the routes, most specific first,
+// followed by the default handler.
+func (fr *facilityRouter) Children() []slog.Handler {
+	handlers := make([]slog.Handler, len(fr.routes))
+	for i := range fr.routes {
+		handlers[i] = fr.routes[i].Handler
+	}
+	return handlers
+}
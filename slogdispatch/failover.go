@@ -0,0 +1,128 @@
+package slogdispatch
+
+import (
+	"context"
+
+	"golang.org/x/exp/slog"
+)
+
+// Failover Handler
+
+// Implemented by handlers which can report whether they are currently able to
+// handle records, for example because a network connection is up.
+type HealthReporter interface {
+	Healthy() bool
+}
+
+type failoverHandler struct {
+	handlers []slog.Handler
+}
+
+// Creates a slog.Handler which dispatches to the first handler in the slice
+// passed and, if its Handle method returns an error, to each subsequent handler
+// in turn until one succeeds. Handlers which implement HealthReporter and
+// report that they are unhealthy, or which wrap such handlers (see
+// CheckHealth), are skipped, unless they are the last handler. Handlers which
+// are not enabled for the level of a record are also skipped.
+//
+// If no handler succeeds, the error returned by the first handler tried is
+// returned.
+func NewFailoverHandler(handlers []slog.Handler) slog.Handler {
+	return &failoverHandler{
+		handlers: handlers,
+	}
+}
+
+var _ slog.Handler = &failoverHandler{}
+
+func (fh *failoverHandler) Enabled(ctx context.Context, lvl slog.Level) bool {
+	for _, subh := range fh.handlers {
+		if subh.Enabled(ctx, lvl) {
+			return true
+		}
+	}
+	return false
+}
+
+func (fh *failoverHandler) Handle(ctx context.Context, r slog.Record) error {
+	var firstErr error
+
+	for i, subh := range fh.handlers {
+		if !subh.Enabled(ctx, r.Level) {
+			continue
+		}
+
+		if i != len(fh.handlers)-1 && !isHealthy(subh) {
+			continue
+		}
+
+		err := subh.Handle(ctx, r)
+		if err == nil {
+			return nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+// Implements HealthReporter. The handler is healthy if any of its handlers
+// are healthy. Handlers which do not implement HealthReporter are assumed to
+// be healthy, unless they wrap handlers which are not (see CheckHealth).
+func (fh *failoverHandler) Healthy() bool {
+	for _, subh := range fh.handlers {
+		if isHealthy(subh) {
+			return true
+		}
+	}
+	return false
+}
+
+// Implements Pinger. Returns nil if any of its handlers are healthy, as for
+// CheckHealth, and otherwise the errors of all of them.
+func (fh *failoverHandler) Ping(ctx context.Context) error {
+	var errs HealthErrors
+	for _, subh := range fh.handlers {
+		err := CheckHealth(ctx, subh)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, err)
+	}
+
+	switch len(errs) {
+	case 0:
+		return ErrUnhealthy
+	case 1:
+		return errs[0]
+	default:
+		return errs
+	}
+}
+
+func (fh *failoverHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(fh.handlers) == 0 {
+		return fh
+	}
+
+	return &failoverHandler{
+		handlers: specialiseAll(fh.handlers, attrs, ""),
+	}
+}
+
+func (fh *failoverHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return fh
+	}
+
+	return &failoverHandler{
+		handlers: specialiseAll(fh.handlers, nil, name),
+	}
+}
+
+// Implements Parent.
+func (fh *failoverHandler) Children() []slog.Handler {
+	return fh.handlers
+}
@@ -0,0 +1,115 @@
+package slogdispatch
+
+import (
+	"bytes"
+	"context"
+	"runtime"
+	"strconv"
+	"sync"
+
+	"golang.org/x/exp/slog"
+)
+
+// Goroutine Handler Store
+
+// A contextual resolver which chooses a handler according to the goroutine
+// doing the logging, rather than the context. A handler is bound to the calling
+// goroutine using Bind, or to a new goroutine using Go. This is intended for
+// code which cannot pass a context.Context through every call but still wants
+// scoped log routing; where a context is available, SimpleResolver should be
+// preferred.
+//
+// Go does not expose goroutine identity, so the resolver determines the
+// calling goroutine by parsing the output of runtime.Stack. This costs on the
+// order of a microsecond per call to Resolve.
+type GoroutineResolver struct {
+	caches       sync.Map // goroutine ID -> *HandlerCache
+	defaultCache *HandlerCache
+}
+
+var _ ContextualResolver = &GoroutineResolver{}
+
+// Creates a new GoroutineResolver. Goroutines with no handler bound are
+// dispatched to defaultHandler. If defaultHandler is nil, Resolve returns nil
+// for such goroutines, so that the resolver can be used in a chain (see
+// NewResolverChain).
+func NewGoroutineResolver(defaultHandler slog.Handler) *GoroutineResolver {
+	gr := &GoroutineResolver{}
+	if defaultHandler != nil {
+		gr.defaultCache = NewHandlerCache(defaultHandler)
+	}
+	return gr
+}
+
+// Binds handler to the calling goroutine, returning a function which restores
+// the previous binding. Bindings therefore nest, and the function must be
+// called on the same goroutine, typically using defer:
+//
+//	defer gr.Bind(h)()
+//
+// A binding which is not released keeps its handler alive after the goroutine
+// exits, and may be inherited by a later goroutine with the same ID.
+func (gr *GoroutineResolver) Bind(handler slog.Handler) (release func()) {
+	id := goroutineID()
+	prev, hadPrev := gr.caches.Load(id)
+	gr.caches.Store(id, NewHandlerCache(handler))
+
+	return func() {
+		if hadPrev {
+			gr.caches.Store(id, prev)
+		} else {
+			gr.caches.Delete(id)
+		}
+	}
+}
+
+// Calls f on a new goroutine with handler bound to it, releasing the binding
+// when f returns.
+func (gr *GoroutineResolver) Go(handler slog.Handler, f func()) {
+	go func() {
+		defer gr.Bind(handler)()
+		f()
+	}()
+}
+
+// Returns the handler bound to the calling goroutine, if any.
+func (gr *GoroutineResolver) Handler() (slog.Handler, bool) {
+	v, ok := gr.caches.Load(goroutineID())
+	if !ok {
+		return nil, false
+	}
+	return v.(*HandlerCache).Handler(), true
+}
+
+// Implements ContextualResolver.
+func (gr *GoroutineResolver) Resolve(ctx context.Context, args ResolveArgs) *HandlerCache {
+	if v, ok := gr.caches.Load(goroutineID()); ok {
+		return v.(*HandlerCache)
+	}
+	return gr.defaultCache
+}
+
+// Implements Parent. Returns the default handler.
+func (gr *GoroutineResolver) Children() []slog.Handler {
+	if gr.defaultCache == nil {
+		return nil
+	}
+	return []slog.Handler{gr.defaultCache.Handler()}
+}
+
+var goroutinePrefix = []byte("goroutine ")
+
+// Returns the ID of the calling goroutine.
+func goroutineID() uint64 {
+	var buf [64]byte
+	b := buf[:runtime.Stack(buf[:], false)]
+	b = bytes.TrimPrefix(b, goroutinePrefix)
+	if i := bytes.IndexByte(b, ' '); i >= 0 {
+		b = b[:i]
+	}
+	id, err := strconv.ParseUint(string(b), 10, 64)
+	if err != nil {
+		panic("slogdispatch: cannot determine goroutine ID")
+	}
+	return id
+}
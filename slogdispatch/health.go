@@ -0,0 +1,113 @@
+package slogdispatch
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"golang.org/x/exp/slog"
+)
+
+// Health Checks
+
+// Implemented by handlers which can actively check whether they are able to
+// handle records, for example by testing a network connection. Ping returns
+// nil if the handler is healthy, and otherwise an error describing the
+// problem, such as "audit log sink unreachable".
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// Returned by CheckHealth for a handler which reports that it is unhealthy
+// using HealthReporter, but does not implement Pinger.
+var ErrUnhealthy = errors.New("slogdispatch: handler is unhealthy")
+
+// The errors of several handlers which are unhealthy, as returned by
+// CheckHealth.
+type HealthErrors []error
+
+func (e HealthErrors) Error() string {
+	s := make([]string, len(e))
+	for i, err := range e {
+		s[i] = err.Error()
+	}
+	return strings.Join(s, "; ")
+}
+
+// Returns the errors.
+func (e HealthErrors) Unwrap() []error {
+	return e
+}
+
+// Checks the health of h, returning nil if it is healthy, for example for use
+// in a readiness probe. If h implements Pinger, its Ping method is called.
+// Otherwise, if it implements HealthReporter, ErrUnhealthy is returned if it
+// reports that it is unhealthy. Otherwise, if it implements Parent, it is
+// healthy if all of its children are healthy, so that the health of a handler
+// wrapped by another handler, such as an AsyncHandler, is reflected by the
+// wrapper. Handlers which implement none of these interfaces are assumed to be
+// healthy.
+//
+// The multi, router and failover handlers aggregate the health of the
+// handlers they dispatch to. A multi or router handler is healthy if all of
+// its handlers are healthy; a failover handler is healthy if any of its
+// handlers are healthy.
+func CheckHealth(ctx context.Context, h slog.Handler) error {
+	switch h := h.(type) {
+	case Pinger:
+		return h.Ping(ctx)
+	case HealthReporter:
+		if !h.Healthy() {
+			return ErrUnhealthy
+		}
+		return nil
+	case Parent:
+		return checkAllHealth(ctx, h.Children())
+	default:
+		return nil
+	}
+}
+
+// Checks the health of each of the handlers, returning a HealthErrors
+// containing the error of each handler which is unhealthy, or nil if all are
+// healthy. A single error is returned as is.
+func checkAllHealth(ctx context.Context, handlers []slog.Handler) error {
+	var errs HealthErrors
+	for _, h := range handlers {
+		if err := CheckHealth(ctx, h); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	default:
+		return errs
+	}
+}
+
+// Like CheckHealth, but reports whether h is healthy without calling Ping,
+// which may be slow.
+func isHealthy(h slog.Handler) bool {
+	switch h := h.(type) {
+	case HealthReporter:
+		return h.Healthy()
+	case Parent:
+		return allHealthy(h.Children())
+	default:
+		return true
+	}
+}
+
+// Reports whether all of the handlers are healthy, according to isHealthy.
+func allHealthy(handlers []slog.Handler) bool {
+	for _, h := range handlers {
+		if !isHealthy(h) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,83 @@
+package slogdispatch
+
+import (
+	"context"
+
+	"golang.org/x/exp/slog"
+)
+
+// Level Filter Handler
+
+type levelFilterHandler struct {
+	h        slog.Handler
+	minLevel slog.Leveler
+	maxLevel slog.Leveler
+}
+
+// Creates a slog.Handler which passes records to h only if their level is at
+// least minLevel and, if maxLevel is non-nil, at most maxLevel. If minLevel is
+// nil, there is no minimum level. For example, to pass only records from WARN
+// to ERROR inclusive:
+//
+//	NewLevelFilterHandler(h, slog.LevelWarn, slog.LevelError)
+//
+// Since minLevel and maxLevel are slog.Levelers, a *slog.LevelVar can be used
+// to change the levels dynamically. Records are also subject to h's own level
+// filtering.
+func NewLevelFilterHandler(h slog.Handler, minLevel, maxLevel slog.Leveler) slog.Handler {
+	return &levelFilterHandler{
+		h:        h,
+		minLevel: minLevel,
+		maxLevel: maxLevel,
+	}
+}
+
+var _ slog.Handler = &levelFilterHandler{}
+
+// Reports whether level is within the band.
+func (lh *levelFilterHandler) inBand(level slog.Level) bool {
+	if lh.minLevel != nil && level < lh.minLevel.Level() {
+		return false
+	}
+	if lh.maxLevel != nil && level > lh.maxLevel.Level() {
+		return false
+	}
+	return true
+}
+
+func (lh *levelFilterHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return lh.inBand(level) && lh.h.Enabled(ctx, level)
+}
+
+func (lh *levelFilterHandler) Handle(ctx context.Context, record slog.Record) error {
+	if !lh.inBand(record.Level) {
+		return nil
+	}
+
+	return lh.h.Handle(ctx, record)
+}
+
+func (lh *levelFilterHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &levelFilterHandler{
+		h:        lh.h.WithAttrs(attrs),
+		minLevel: lh.minLevel,
+		maxLevel: lh.maxLevel,
+	}
+}
+
+func (lh *levelFilterHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return lh
+	}
+
+	return &levelFilterHandler{
+		h:        lh.h.WithGroup(name),
+		minLevel: lh.minLevel,
+		maxLevel: lh.maxLevel,
+	}
+}
+
+// Implements Parent.
+func (lh *levelFilterHandler) Children() []slog.Handler {
+	return []slog.Handler{lh.h}
+}
@@ -0,0 +1,90 @@
+package slogdispatch
+
+import (
+	"container/list"
+	"sync"
+
+	"golang.org/x/exp/slog"
+)
+
+// The default capacity of a handler cache created by NewHandlerCacheLRU.
+const defaultLRUCapacity = 256
+
+// Create a new handler cache for the given base handler which keeps at most
+// capacity derived handlers, discarding the least recently used handler when
+// full. Unlike the cache created by NewHandlerCache, its behaviour does not
+// depend on the garbage collector. If capacity is not positive, a default of
+// 256 is used.
+//
+// The capacity is divided evenly between the shards of the cache, each of
+// which discards its own least recently used handler when full, so the
+// eviction order is only approximately least recently used.
+func NewHandlerCacheLRU(handler slog.Handler, capacity int) *HandlerCache {
+	if capacity <= 0 {
+		capacity = defaultLRUCapacity
+	}
+
+	n := handlerCacheShards
+	if capacity < n {
+		n = capacity
+	}
+
+	shards := make(shardedHandlerStore, n)
+	for i := range shards {
+		shardCapacity := capacity / n
+		if i < capacity%n {
+			shardCapacity++
+		}
+		shards[i] = &lruHandlerStore{
+			capacity: shardCapacity,
+			ll:       list.New(),
+			items:    make(map[uint64]*list.Element, shardCapacity),
+		}
+	}
+	return &HandlerCache{
+		handler: handler,
+		cache:   shards,
+	}
+}
+
+type lruEntry struct {
+	id uint64
+	h  slog.Handler
+}
+
+type lruHandlerStore struct {
+	mu       sync.Mutex
+	capacity int
+	ll       *list.List // of lruEntry, most recently used first
+	items    map[uint64]*list.Element
+}
+
+func (s *lruHandlerStore) get(id uint64) slog.Handler {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.items[id]
+	if !ok {
+		return nil
+	}
+	s.ll.MoveToFront(e)
+	return e.Value.(lruEntry).h
+}
+
+func (s *lruHandlerStore) set(id uint64, h slog.Handler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.items[id]; ok {
+		e.Value = lruEntry{id, h}
+		s.ll.MoveToFront(e)
+		return
+	}
+
+	s.items[id] = s.ll.PushFront(lruEntry{id, h})
+	if s.ll.Len() > s.capacity {
+		oldest := s.ll.Back()
+		s.ll.Remove(oldest)
+		delete(s.items, oldest.Value.(lruEntry).id)
+	}
+}
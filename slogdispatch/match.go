@@ -0,0 +1,153 @@
+package slogdispatch
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"golang.org/x/exp/slog"
+)
+
+// Match Functions
+
+// A predicate used by RouterRule. The constructors below can be used to build
+// common predicates and combine them.
+//
+// Predicates which examine record attributes only see the attributes of the
+// record itself, not those added to a handler using WithAttrs, and only match
+// attributes which are not in a group. They never match if args.Record is nil.
+type MatchFunc func(ctx context.Context, args ResolveArgs) bool
+
+// The key of the attribute used by FacilityPrefix to determine the facility a
+// record was logged by.
+const FacilityKey = "facility"
+
+// Returns a MatchFunc which matches records with a level greater than or equal
+// to level.
+func LevelAtLeast(level slog.Leveler) MatchFunc {
+	return func(ctx context.Context, args ResolveArgs) bool {
+		return args.Level >= level.Level()
+	}
+}
+
+// Returns a MatchFunc which matches records with a level less than level.
+func LevelBelow(level slog.Leveler) MatchFunc {
+	return func(ctx context.Context, args ResolveArgs) bool {
+		return args.Level < level.Level()
+	}
+}
+
+// Returns a MatchFunc which matches records having an attribute with the given
+// key and a value equal to value.
+func AttrEquals(key string, value any) MatchFunc {
+	v := slog.AnyValue(value).Resolve()
+	return func(ctx context.Context, args ResolveArgs) bool {
+		a, ok := findAttr(args.Record, key)
+		return ok && a.Value.Resolve().Equal(v)
+	}
+}
+
+// Returns a MatchFunc which matches records having an attribute with the given
+// key.
+func AttrPresent(key string) MatchFunc {
+	return func(ctx context.Context, args ResolveArgs) bool {
+		_, ok := findAttr(args.Record, key)
+		return ok
+	}
+}
+
+// Returns a MatchFunc which matches records whose message matches re.
+func MessageMatches(re *regexp.Regexp) MatchFunc {
+	return func(ctx context.Context, args ResolveArgs) bool {
+		return args.Record != nil && re.MatchString(args.Record.Message)
+	}
+}
+
+// Returns a MatchFunc which matches records having a FacilityKey attribute
+// whose value is the given facility name or the name of a facility below it;
+// for example, "acme/db" matches "acme/db" and "acme/db/pool", but not
+// "acme/dbx".
+func FacilityPrefix(prefix string) MatchFunc {
+	prefix = strings.TrimSuffix(prefix, "/")
+	return func(ctx context.Context, args ResolveArgs) bool {
+		a, ok := findAttr(args.Record, FacilityKey)
+		return ok && hasPathPrefix(a.Value.Resolve().String(), prefix)
+	}
+}
+
+// Returns a MatchFunc which matches records logged through a handler whose
+// group path (see ResolveArgs.Groups) begins with the given groups; for
+// example, GroupPrefix("db") matches records logged in the groups "db" and
+// "db", "pool", but not "dbx". If no groups are given, all records are
+// matched.
+func GroupPrefix(groups ...string) MatchFunc {
+	return func(ctx context.Context, args ResolveArgs) bool {
+		if len(args.Groups) < len(groups) {
+			return false
+		}
+		for i, g := range groups {
+			if args.Groups[i] != g {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Reports whether name is prefix or a path below it, where components are
+// separated by '/'. An empty prefix matches everything.
+func hasPathPrefix(name, prefix string) bool {
+	if prefix == "" || name == prefix {
+		return true
+	}
+	return strings.HasPrefix(name, prefix) && name[len(prefix)] == '/'
+}
+
+// Returns a MatchFunc which matches records matched by all of the given
+// functions. If none are given, all records are matched.
+func And(fs ...MatchFunc) MatchFunc {
+	return func(ctx context.Context, args ResolveArgs) bool {
+		for _, f := range fs {
+			if !f(ctx, args) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Returns a MatchFunc which matches records matched by any of the given
+// functions. If none are given, no records are matched.
+func Or(fs ...MatchFunc) MatchFunc {
+	return func(ctx context.Context, args ResolveArgs) bool {
+		for _, f := range fs {
+			if f(ctx, args) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Returns a MatchFunc which matches records not matched by f.
+func Not(f MatchFunc) MatchFunc {
+	return func(ctx context.Context, args ResolveArgs) bool {
+		return !f(ctx, args)
+	}
+}
+
+// Returns the last attribute of the record with the given key which is not in
+// a group.
+func findAttr(r *slog.Record, key string) (attr slog.Attr, found bool) {
+	if r == nil {
+		return
+	}
+
+	r.Attrs(func(a slog.Attr) bool {
+		if a.Key == key {
+			attr, found = a, true
+		}
+		return true
+	})
+	return
+}
@@ -0,0 +1,108 @@
+package slogdispatch
+
+import (
+	"golang.org/x/exp/slog"
+)
+
+// Middleware
+
+// A function which wraps a slog.Handler in another handler, such as a filter
+// or transformer. The wrapper handlers provided by this package can be used as
+// middleware using the functions below.
+type Middleware func(h slog.Handler) slog.Handler
+
+// Wraps h in each of the given middleware. The first middleware is the
+// outermost, so it sees each record first. For example,
+//
+//	Chain(h, RecoverMiddleware(nil), LevelFilterMiddleware(slog.LevelInfo, nil))
+//
+// is equivalent to
+//
+//	NewRecoverHandler(NewLevelFilterHandler(h, slog.LevelInfo, nil), nil)
+func Chain(h slog.Handler, mws ...Middleware) slog.Handler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h
+}
+
+// Returns a Middleware which applies each of the given middleware, as for
+// Chain.
+func Compose(mws ...Middleware) Middleware {
+	return func(h slog.Handler) slog.Handler {
+		return Chain(h, mws...)
+	}
+}
+
+// Returns a Middleware which uses NewLevelFilterHandler.
+func LevelFilterMiddleware(minLevel, maxLevel slog.Leveler) Middleware {
+	return func(h slog.Handler) slog.Handler {
+		return NewLevelFilterHandler(h, minLevel, maxLevel)
+	}
+}
+
+// Returns a Middleware which uses NewMinLevelHandler.
+func MinLevelMiddleware(defaultLevel slog.Leveler) Middleware {
+	return func(h slog.Handler) slog.Handler {
+		return NewMinLevelHandler(h, defaultLevel)
+	}
+}
+
+// Returns a Middleware which uses NewTransformHandler.
+func TransformMiddleware(f TransformFunc) Middleware {
+	return func(h slog.Handler) slog.Handler {
+		return NewTransformHandler(h, f)
+	}
+}
+
+// Returns a Middleware which uses NewContextAttrsHandler.
+func ContextAttrsMiddleware(extractors ...ContextExtractor) Middleware {
+	return func(h slog.Handler) slog.Handler {
+		return NewContextAttrsHandler(h, extractors...)
+	}
+}
+
+// Returns a Middleware which uses NewSamplingHandler. Each handler wrapped
+// has its own counters.
+func SamplingMiddleware(opts *SamplingHandlerOptions) Middleware {
+	return func(h slog.Handler) slog.Handler {
+		return NewSamplingHandler(h, opts)
+	}
+}
+
+// Returns a Middleware which uses NewDedupHandler.
+func DedupMiddleware(opts *DedupHandlerOptions) Middleware {
+	return func(h slog.Handler) slog.Handler {
+		return NewDedupHandler(h, opts)
+	}
+}
+
+// Returns a Middleware which uses NewRateLimitHandler. Each handler wrapped
+// has its own limits.
+func RateLimitMiddleware(opts *RateLimitHandlerOptions) Middleware {
+	return func(h slog.Handler) slog.Handler {
+		return NewRateLimitHandler(h, opts)
+	}
+}
+
+// Returns a Middleware which uses NewTriggerHandler.
+func TriggerMiddleware(opts *TriggerHandlerOptions) Middleware {
+	return func(h slog.Handler) slog.Handler {
+		return NewTriggerHandler(h, opts)
+	}
+}
+
+// Returns a Middleware which uses NewRecoverHandler.
+func RecoverMiddleware(fallback slog.Handler) Middleware {
+	return func(h slog.Handler) slog.Handler {
+		return NewRecoverHandler(h, fallback)
+	}
+}
+
+// Returns a Middleware which uses NewAsyncHandler. The AsyncHandler created
+// must be closed when it is no longer needed, for example using CloseAll.
+func AsyncMiddleware(opts *AsyncHandlerOptions) Middleware {
+	return func(h slog.Handler) slog.Handler {
+		return NewAsyncHandler(h, opts)
+	}
+}
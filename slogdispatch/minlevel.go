@@ -0,0 +1,95 @@
+package slogdispatch
+
+import (
+	"context"
+
+	"golang.org/x/exp/slog"
+)
+
+// Context Min Level Handler
+
+type minLevelKeyType struct{}
+
+var minLevelKey minLevelKeyType
+
+// Creates a context derived from the given context which specifies the minimum
+// level of records to be logged with it, for use with NewMinLevelHandler. For
+// example, a request carrying a debug header can be given DEBUG logging while
+// the rest of the process logs at INFO.
+func WithMinLevel(ctx context.Context, level slog.Leveler) context.Context {
+	return context.WithValue(ctx, minLevelKey, level)
+}
+
+// Returns the minimum level specified for a context using WithMinLevel, if
+// any.
+func MinLevel(ctx context.Context) (slog.Level, bool) {
+	level, ok := ctx.Value(minLevelKey).(slog.Leveler)
+	if !ok {
+		return 0, false
+	}
+	return level.Level(), true
+}
+
+type minLevelHandler struct {
+	h            slog.Handler
+	defaultLevel slog.Leveler
+}
+
+// Creates a slog.Handler which passes records to h only if their level is at
+// least the level specified for their context using WithMinLevel, or
+// defaultLevel if none is specified. If defaultLevel is nil, slog.LevelInfo is
+// used.
+//
+// The Enabled method of h is not consulted, since that would prevent a context
+// from lowering the level, so h should be configured to handle records of all
+// levels which may be requested.
+func NewMinLevelHandler(h slog.Handler, defaultLevel slog.Leveler) slog.Handler {
+	if defaultLevel == nil {
+		defaultLevel = slog.LevelInfo
+	}
+	return &minLevelHandler{
+		h:            h,
+		defaultLevel: defaultLevel,
+	}
+}
+
+var _ slog.Handler = &minLevelHandler{}
+
+func (mh *minLevelHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	minLevel, ok := MinLevel(ctx)
+	if !ok {
+		minLevel = mh.defaultLevel.Level()
+	}
+	return level >= minLevel
+}
+
+func (mh *minLevelHandler) Handle(ctx context.Context, record slog.Record) error {
+	if !mh.Enabled(ctx, record.Level) {
+		return nil
+	}
+
+	return mh.h.Handle(ctx, record)
+}
+
+func (mh *minLevelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &minLevelHandler{
+		h:            mh.h.WithAttrs(attrs),
+		defaultLevel: mh.defaultLevel,
+	}
+}
+
+func (mh *minLevelHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return mh
+	}
+
+	return &minLevelHandler{
+		h:            mh.h.WithGroup(name),
+		defaultLevel: mh.defaultLevel,
+	}
+}
+
+// Implements Parent.
+func (mh *minLevelHandler) Children() []slog.Handler {
+	return []slog.Handler{mh.h}
+}
@@ -0,0 +1,202 @@
+package slogdispatch
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+// Rate Limit Handler
+
+// Options for NewRateLimitHandler.
+type RateLimitHandlerOptions struct {
+	// The maximum average number of records passed on per second. If zero,
+	// there is no overall limit.
+	Rate float64
+
+	// The maximum number of records which can be passed on in a burst, above
+	// the average rate. If zero, Rate is used (but at least one).
+	Burst int
+
+	// Limits on the average number of records of particular levels passed on
+	// per second, in addition to Rate. The burst size for each level is
+	// determined as for Burst.
+	LevelRates map[slog.Level]float64
+
+	// The minimum interval between summary records. If zero, ten seconds is
+	// used.
+	SummaryInterval time.Duration
+
+	// If set, no summary records are emitted.
+	OmitSummary bool
+}
+
+// The message of summary records emitted by a rate limit handler.
+const rateLimitSummaryMessage = "log records dropped by rate limiting"
+
+// A token bucket. Its zero value allows everything.
+type tokenBucket struct {
+	rate, burst, tokens float64
+	last                time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	b := float64(burst)
+	if b <= 0 {
+		b = rate
+	}
+	if b < 1 {
+		b = 1
+	}
+	return &tokenBucket{rate: rate, burst: b, tokens: b}
+}
+
+// Adds the tokens accumulated since the last call and reports whether a token
+// is available.
+func (b *tokenBucket) available(now time.Time) bool {
+	if b == nil || b.rate <= 0 {
+		return true
+	}
+	if !b.last.IsZero() {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+	}
+	b.last = now
+	return b.tokens >= 1
+}
+
+func (b *tokenBucket) take() {
+	if b != nil && b.rate > 0 {
+		b.tokens--
+	}
+}
+
+// State shared between a rate limit handler and all handlers derived from it.
+type rateLimitState struct {
+	opts RateLimitHandlerOptions
+	root slog.Handler
+
+	mu          sync.Mutex
+	global      *tokenBucket
+	levels      map[slog.Level]*tokenBucket
+	dropped     uint64 // total
+	unreported  uint64 // since the last summary
+	lastSummary time.Time
+}
+
+// A slog.Handler which limits the rate at which records are passed on to
+// another handler. See NewRateLimitHandler.
+type RateLimitHandler struct {
+	s *rateLimitState
+	h slog.Handler
+}
+
+// Creates a handler which passes records on to h, dropping records which would
+// exceed the rates given in opts. Handlers derived from the returned handler
+// share the same limits.
+//
+// Unless opts.OmitSummary is set, when records have been dropped, a summary
+// record at level WARN with an attribute "suppressed" giving the number of
+// records dropped is passed to h when the next record is handled at least
+// opts.SummaryInterval after the previous summary. Summary records are not
+// subject to the limits and do not include attributes or groups added using
+// WithAttrs or WithGroup.
+func NewRateLimitHandler(h slog.Handler, opts *RateLimitHandlerOptions) *RateLimitHandler {
+	s := &rateLimitState{
+		root:   h,
+		levels: map[slog.Level]*tokenBucket{},
+	}
+	if opts != nil {
+		s.opts = *opts
+	}
+	if s.opts.SummaryInterval <= 0 {
+		s.opts.SummaryInterval = 10 * time.Second
+	}
+	s.global = newTokenBucket(s.opts.Rate, s.opts.Burst)
+	for level, rate := range s.opts.LevelRates {
+		s.levels[level] = newTokenBucket(rate, s.opts.Burst)
+	}
+	return &RateLimitHandler{
+		s: s,
+		h: h,
+	}
+}
+
+var _ slog.Handler = &RateLimitHandler{}
+
+func (rh *RateLimitHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return rh.h.Enabled(ctx, level)
+}
+
+// Determines whether a record of the given level should be passed on, and
+// returns the number of records dropped since the last summary if a summary
+// is due.
+func (s *rateLimitState) allow(level slog.Level, now time.Time) (pass bool, summary uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lb := s.levels[level]
+	if s.global.available(now) && lb.available(now) {
+		s.global.take()
+		lb.take()
+		pass = true
+	} else {
+		s.dropped++
+		s.unreported++
+	}
+
+	if s.unreported > 0 && now.Sub(s.lastSummary) >= s.opts.SummaryInterval {
+		summary = s.unreported
+		s.unreported = 0
+		s.lastSummary = now
+	}
+	return
+}
+
+func (rh *RateLimitHandler) Handle(ctx context.Context, record slog.Record) error {
+	now := time.Now()
+	pass, summary := rh.s.allow(record.Level, now)
+	if summary > 0 && !rh.s.opts.OmitSummary {
+		emitSummary(ctx, rh.s.root, now, slog.LevelWarn, rateLimitSummaryMessage, summary)
+	}
+	if !pass {
+		return nil
+	}
+
+	return rh.h.Handle(ctx, record)
+}
+
+func (rh *RateLimitHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &RateLimitHandler{
+		s: rh.s,
+		h: rh.h.WithAttrs(attrs),
+	}
+}
+
+func (rh *RateLimitHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return rh
+	}
+
+	return &RateLimitHandler{
+		s: rh.s,
+		h: rh.h.WithGroup(name),
+	}
+}
+
+// Implements Parent.
+func (rh *RateLimitHandler) Children() []slog.Handler {
+	return []slog.Handler{rh.h}
+}
+
+// Returns the total number of records dropped by the handler and all handlers
+// derived from it.
+func (rh *RateLimitHandler) Dropped() uint64 {
+	rh.s.mu.Lock()
+	defer rh.s.mu.Unlock()
+	return rh.s.dropped
+}
@@ -0,0 +1,67 @@
+package slogdispatch_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hlandau/slogkit/slogdispatch"
+	"golang.org/x/exp/slog"
+)
+
+func TestRateLimitHandler(t *testing.T) {
+	h := &recordingHandler{}
+	rh := slogdispatch.NewRateLimitHandler(h, &slogdispatch.RateLimitHandlerOptions{
+		Rate:            0.001,
+		Burst:           3,
+		SummaryInterval: time.Hour,
+	})
+	derived := rh.WithAttrs([]slog.Attr{slog.Int("a", 1)})
+
+	// Derived handlers share the limit. The first record dropped causes a
+	// summary to be emitted, and the next summary is not due for an hour.
+	for i, msg := range []string{"1", "2", "3", "4", "5"} {
+		handler := slog.Handler(rh)
+		if i%2 == 1 {
+			handler = derived
+		}
+		if err := handleMsg(handler, msg); err != nil {
+			t.Fatalf("cannot handle: %v", err)
+		}
+	}
+	recs := h.records()
+	if got := h.messages(); len(got) != 4 || !equalStrings(got[:3], []string{"1", "2", "3"}) {
+		t.Fatalf("unexpected records passed on: %q", got)
+	}
+	if r := recs[3]; r.Level != slog.LevelWarn || recordAttr(r, "suppressed").Uint64() != 1 {
+		t.Errorf("unexpected summary record: %v %q", r.Level, r.Message)
+	}
+	if n := rh.Dropped(); n != 2 {
+		t.Errorf("expected 2 dropped, got %d", n)
+	}
+}
+
+func TestRateLimitHandlerLevelRates(t *testing.T) {
+	h := &recordingHandler{level: slog.LevelDebug}
+	rh := slogdispatch.NewRateLimitHandler(h, &slogdispatch.RateLimitHandlerOptions{
+		Burst:       2,
+		LevelRates:  map[slog.Level]float64{slog.LevelDebug: 0.001},
+		OmitSummary: true,
+	})
+
+	for i := 0; i < 3; i++ {
+		for _, level := range []slog.Level{slog.LevelDebug, slog.LevelInfo} {
+			if err := rh.Handle(context.Background(), slog.NewRecord(time.Time{}, level, level.String(), 0)); err != nil {
+				t.Fatalf("cannot handle: %v", err)
+			}
+		}
+	}
+
+	expected := []string{"DEBUG", "INFO", "DEBUG", "INFO", "INFO"}
+	if got := h.messages(); !equalStrings(got, expected) {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+	if n := rh.Dropped(); n != 1 {
+		t.Errorf("expected 1 dropped, got %d", n)
+	}
+}
@@ -0,0 +1,119 @@
+package slogdispatch
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+// Recover Handler
+
+// The error returned by the Handle method of a recover handler if the
+// underlying handler panics.
+type PanicError struct {
+	// The value passed to panic.
+	Value any
+
+	// The stack trace of the goroutine at the time of the panic.
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("slogdispatch: panic in handler: %v", e.Value)
+}
+
+type recoverHandler struct {
+	h        slog.Handler
+	fallback slog.Handler
+}
+
+// Creates a slog.Handler which passes calls to h, but recovers from any panic
+// in h's methods so that a faulty handler cannot crash the program. If Handle
+// panics, a *PanicError is returned. If Enabled panics, false is returned. If
+// WithAttrs or WithGroup panic, the attributes or group are discarded and a
+// handler equivalent to the receiver is returned.
+//
+// If fallback is non-nil, a record describing each panic is logged to it at
+// level ERROR.
+func NewRecoverHandler(h, fallback slog.Handler) slog.Handler {
+	return &recoverHandler{
+		h:        h,
+		fallback: fallback,
+	}
+}
+
+var _ slog.Handler = &recoverHandler{}
+
+// Must be deferred. Reports a panic to the fallback handler and stores it in
+// *errp if errp is non-nil.
+func (rh *recoverHandler) handlePanic(ctx context.Context, method string, record *slog.Record, errp *error) {
+	v := recover()
+	if v == nil {
+		return
+	}
+
+	perr := &PanicError{Value: v, Stack: debug.Stack()}
+	if errp != nil {
+		*errp = perr
+	}
+
+	if rh.fallback == nil || !rh.fallback.Enabled(ctx, slog.LevelError) {
+		return
+	}
+
+	r := slog.NewRecord(time.Now(), slog.LevelError, "panic in log handler", 0)
+	r.AddAttrs(slog.String("method", method), slog.Any("panic", v))
+	if record != nil {
+		r.AddAttrs(slog.String("record_msg", record.Message))
+	}
+	r.AddAttrs(slog.String("stack", string(perr.Stack)))
+	rh.fallback.Handle(ctx, r)
+}
+
+func (rh *recoverHandler) Enabled(ctx context.Context, level slog.Level) (enabled bool) {
+	defer rh.handlePanic(ctx, "Enabled", nil, nil)
+	return rh.h.Enabled(ctx, level)
+}
+
+func (rh *recoverHandler) Handle(ctx context.Context, record slog.Record) (err error) {
+	defer rh.handlePanic(ctx, "Handle", &record, &err)
+	return rh.h.Handle(ctx, record)
+}
+
+func (rh *recoverHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	h := rh.h
+	func() {
+		defer rh.handlePanic(context.Background(), "WithAttrs", nil, nil)
+		h = rh.h.WithAttrs(attrs)
+	}()
+
+	return &recoverHandler{
+		h:        h,
+		fallback: rh.fallback,
+	}
+}
+
+func (rh *recoverHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return rh
+	}
+
+	h := rh.h
+	func() {
+		defer rh.handlePanic(context.Background(), "WithGroup", nil, nil)
+		h = rh.h.WithGroup(name)
+	}()
+
+	return &recoverHandler{
+		h:        h,
+		fallback: rh.fallback,
+	}
+}
+
+// Implements Parent.
+func (rh *recoverHandler) Children() []slog.Handler {
+	return []slog.Handler{rh.h}
+}
@@ -0,0 +1,165 @@
+package slogdispatch_test
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/hlandau/slogkit/slogdispatch"
+	"golang.org/x/exp/slog"
+)
+
+func matchAll(ctx context.Context, args slogdispatch.ResolveArgs) bool {
+	return true
+}
+
+func TestRouterRuleChanges(t *testing.T) {
+	hWarn, hAll := &recordingHandler{}, &recordingHandler{}
+	rh := slogdispatch.NewRouterHandler([]slogdispatch.RouterRule{
+		{Name: "warn", MatchFunc: slogdispatch.LevelAtLeast(slog.LevelWarn), Handler: hWarn},
+	}, nil)
+	derived := rh.WithAttrs([]slog.Attr{slog.Int("a", 1)})
+
+	// Handling a record through the derived handler caches the handlers it
+	// derives from the rules, which must be discarded when the rules change.
+	handle := func(h slog.Handler, level slog.Level, msg string) {
+		t.Helper()
+		r := slog.NewRecord(time.Time{}, level, msg, 0)
+		if err := h.Handle(context.Background(), r); err != nil {
+			t.Fatalf("cannot handle: %v", err)
+		}
+	}
+	handle(derived, slog.LevelWarn, "1")
+	handle(derived, slog.LevelInfo, "2")
+
+	rh.AddRule(slogdispatch.RouterRule{Name: "all", MatchFunc: matchAll, Handler: hAll})
+	handle(derived, slog.LevelWarn, "3")
+	handle(derived, slog.LevelInfo, "4")
+
+	if n := rh.RemoveRule("warn"); n != 1 {
+		t.Errorf("expected 1 rule removed, got %d", n)
+	}
+	if n := rh.RemoveRule("warn"); n != 0 {
+		t.Errorf("expected no rules removed, got %d", n)
+	}
+	handle(derived, slog.LevelWarn, "5")
+	handle(rh, slog.LevelInfo, "6")
+
+	rh.ReplaceRules([]slogdispatch.RouterRule{{MatchFunc: matchAll, Handler: hWarn}})
+	handle(derived, slog.LevelInfo, "7")
+
+	if got := hWarn.messages(); !equalStrings(got, []string{"1", "3", "7"}) {
+		t.Errorf("unexpected records for first handler: %q", got)
+	}
+	if got := hAll.messages(); !equalStrings(got, []string{"4", "5", "6"}) {
+		t.Errorf("unexpected records for second handler: %q", got)
+	}
+
+	// Rules returns a copy.
+	rules := rh.Rules()
+	rules[0].Handler = hAll
+	if rh.Rules()[0].Handler != slog.Handler(hWarn) {
+		t.Errorf("modifying the result of Rules affected the router")
+	}
+}
+
+func TestRouterHandlerAuto(t *testing.T) {
+	hWarn := &recordingHandler{level: slog.LevelWarn}
+	hError := &recordingHandler{level: slog.LevelError}
+	rh := slogdispatch.NewRouterHandlerAuto([]slogdispatch.RouterRule{
+		{MatchFunc: matchAll, Handler: hWarn, Continue: true},
+		{MatchFunc: matchAll, Handler: hError},
+	})
+	derived := rh.WithGroup("g")
+
+	ctx := context.Background()
+	for _, h := range []slog.Handler{rh, derived} {
+		if h.Enabled(ctx, slog.LevelInfo) || !h.Enabled(ctx, slog.LevelWarn) || !h.Enabled(ctx, slog.LevelError) {
+			t.Errorf("unexpected initial Enabled results")
+		}
+	}
+
+	// The results are cached until invalidated.
+	hWarn.level = slog.LevelDebug
+	if rh.Enabled(ctx, slog.LevelInfo) {
+		t.Errorf("expected cached result")
+	}
+	rh.InvalidateEnabled()
+	if !derived.Enabled(ctx, slog.LevelInfo) {
+		t.Errorf("expected Enabled after InvalidateEnabled")
+	}
+
+	// Changing the rules also invalidates them.
+	rh.ReplaceRules([]slogdispatch.RouterRule{{MatchFunc: matchAll, Handler: hError}})
+	if rh.Enabled(ctx, slog.LevelWarn) || !rh.Enabled(ctx, slog.LevelError) {
+		t.Errorf("unexpected Enabled results after changing rules")
+	}
+	rh.AddRule(slogdispatch.RouterRule{MatchFunc: matchAll, Handler: hWarn})
+	if !rh.Enabled(ctx, slog.LevelDebug) {
+		t.Errorf("unexpected Enabled result after adding a rule")
+	}
+}
+
+func TestRouterHandlerAutoMinLevel(t *testing.T) {
+	h := &recordingHandler{level: slog.LevelDebug}
+	rh := slogdispatch.NewRouterHandlerAuto([]slogdispatch.RouterRule{
+		{MatchFunc: matchAll, Handler: slogdispatch.NewMinLevelHandler(h, slog.LevelInfo)},
+	})
+
+	ctx := context.Background()
+	debugCtx := slogdispatch.WithMinLevel(ctx, slog.LevelDebug)
+	for i := 0; i < 2; i++ {
+		if rh.Enabled(ctx, slog.LevelDebug) {
+			t.Errorf("expected DEBUG disabled without a minimum level")
+		}
+		if !rh.Enabled(debugCtx, slog.LevelDebug) {
+			t.Errorf("expected DEBUG enabled for a context with a minimum level")
+		}
+	}
+
+	for _, c := range []struct {
+		ctx context.Context
+		msg string
+	}{{ctx, "a"}, {debugCtx, "b"}} {
+		if rh.Enabled(c.ctx, slog.LevelDebug) {
+			rh.Handle(c.ctx, slog.NewRecord(time.Now(), slog.LevelDebug, c.msg, 0))
+		}
+	}
+	if msgs := h.messages(); !equalStrings(msgs, []string{"b"}) {
+		t.Errorf("unexpected messages: %v", msgs)
+	}
+}
+
+func TestRouterFraction(t *testing.T) {
+	for _, byHash := range []bool{false, true} {
+		hSample, hRest := &recordingHandler{}, &recordingHandler{}
+		rh := slogdispatch.NewRouterHandler([]slogdispatch.RouterRule{
+			{MatchFunc: matchAll, Handler: hSample, Fraction: 0.25, FractionByHash: byHash},
+			{MatchFunc: matchAll, Handler: hRest},
+		}, nil)
+
+		// Records not sampled fall through to the next rule.
+		const n = 2000
+		for i := 0; i < n; i++ {
+			if err := handleMsg(rh, strconv.Itoa(i)); err != nil {
+				t.Fatalf("cannot handle: %v", err)
+			}
+		}
+		sampled, rest := len(hSample.messages()), len(hRest.messages())
+		if sampled+rest != n || sampled < n/5 || sampled > n*3/10 {
+			t.Errorf("byHash=%v: expected about a quarter of %d records sampled, got %d and %d", byHash, n, sampled, rest)
+		}
+
+		if byHash {
+			// Identical records are treated alike.
+			for i := 0; i < 10; i++ {
+				handleMsg(rh, hSample.messages()[0])
+				handleMsg(rh, hRest.messages()[0])
+			}
+			if got := len(hSample.messages()); got != sampled+10 {
+				t.Errorf("expected identical records to be sampled alike, got %d sampled", got-sampled)
+			}
+		}
+	}
+}
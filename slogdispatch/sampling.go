@@ -0,0 +1,161 @@
+package slogdispatch
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+// Sampling Handler
+
+// Options for NewSamplingHandler.
+type SamplingHandlerOptions struct {
+	// The number of records of each level passed on in each interval before
+	// sampling starts.
+	First int
+
+	// Once First records of a level have been passed on in an interval, every
+	// Thereafter-th record of that level is passed on for the rest of the
+	// interval. If zero, all further records of that level are dropped.
+	Thereafter int
+
+	// The length of the sampling interval. If zero, one second is used.
+	Interval time.Duration
+
+	// If set, no summary records are emitted.
+	OmitSummary bool
+}
+
+// The message of summary records emitted by a sampling handler.
+const samplingSummaryMessage = "log records suppressed by sampling"
+
+// The key of the attribute containing the number of records suppressed in
+// summary records.
+const suppressedKey = "suppressed"
+
+type samplingCounter struct {
+	start      time.Time
+	n          int
+	suppressed uint64
+}
+
+// State shared between a sampling handler and all handlers derived from it.
+type samplingState struct {
+	opts SamplingHandlerOptions
+	root slog.Handler
+
+	mu     sync.Mutex
+	levels map[slog.Level]*samplingCounter
+}
+
+type samplingHandler struct {
+	s *samplingState
+	h slog.Handler
+}
+
+// Creates a slog.Handler which passes on the first opts.First records of each
+// level in each interval to h, and then every opts.Thereafter-th record, so
+// that bursts of log records do not overwhelm a sink. Handlers derived from the
+// returned handler share the same counters.
+//
+// Unless opts.OmitSummary is set, when a record of a level is handled after an
+// interval in which records of that level were suppressed, a summary record of
+// the same level is first passed to h, with an attribute "suppressed" giving
+// the number of records suppressed. The summary record does not include
+// attributes or groups added using WithAttrs or WithGroup.
+func NewSamplingHandler(h slog.Handler, opts *SamplingHandlerOptions) slog.Handler {
+	s := &samplingState{
+		root:   h,
+		levels: map[slog.Level]*samplingCounter{},
+	}
+	if opts != nil {
+		s.opts = *opts
+	}
+	if s.opts.Interval <= 0 {
+		s.opts.Interval = time.Second
+	}
+	return &samplingHandler{
+		s: s,
+		h: h,
+	}
+}
+
+var _ slog.Handler = &samplingHandler{}
+
+func (sh *samplingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return sh.h.Enabled(ctx, level)
+}
+
+// Determines whether a record of the given level should be passed on, and
+// returns the number of records suppressed in the previous interval if it has
+// just ended.
+func (s *samplingState) sample(level slog.Level, now time.Time) (pass bool, summary uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := s.levels[level]
+	if c == nil {
+		c = &samplingCounter{start: now}
+		s.levels[level] = c
+	} else if now.Sub(c.start) >= s.opts.Interval {
+		summary = c.suppressed
+		*c = samplingCounter{start: now}
+	}
+
+	c.n++
+	pass = c.n <= s.opts.First || (s.opts.Thereafter > 0 && (c.n-s.opts.First)%s.opts.Thereafter == 0)
+	if !pass {
+		c.suppressed++
+	}
+	return
+}
+
+func (sh *samplingHandler) Handle(ctx context.Context, record slog.Record) error {
+	now := time.Now()
+	pass, summary := sh.s.sample(record.Level, now)
+	if summary > 0 && !sh.s.opts.OmitSummary {
+		emitSummary(ctx, sh.s.root, now, record.Level, samplingSummaryMessage, summary)
+	}
+	if !pass {
+		return nil
+	}
+
+	return sh.h.Handle(ctx, record)
+}
+
+// Passes a record to h stating that n records were suppressed, if h is enabled
+// for the level.
+func emitSummary(ctx context.Context, h slog.Handler, t time.Time, level slog.Level, msg string, n uint64) {
+	if !h.Enabled(ctx, level) {
+		return
+	}
+
+	r := slog.NewRecord(t, level, msg, 0)
+	r.AddAttrs(slog.Uint64(suppressedKey, n))
+	h.Handle(ctx, r)
+}
+
+func (sh *samplingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &samplingHandler{
+		s: sh.s,
+		h: sh.h.WithAttrs(attrs),
+	}
+}
+
+func (sh *samplingHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return sh
+	}
+
+	return &samplingHandler{
+		s: sh.s,
+		h: sh.h.WithGroup(name),
+	}
+}
+
+// Implements Parent.
+func (sh *samplingHandler) Children() []slog.Handler {
+	return []slog.Handler{sh.h}
+}
@@ -0,0 +1,56 @@
+package slogdispatch_test
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/hlandau/slogkit/slogdispatch"
+	"golang.org/x/exp/slog"
+)
+
+func TestSamplingHandler(t *testing.T) {
+	h := &recordingHandler{}
+	sh := slogdispatch.NewSamplingHandler(h, &slogdispatch.SamplingHandlerOptions{
+		First:      2,
+		Thereafter: 3,
+		Interval:   100 * time.Millisecond,
+	})
+	derived := sh.WithAttrs([]slog.Attr{slog.Int("a", 1)})
+
+	// Derived handlers share the counters; levels are counted separately.
+	for i := 1; i <= 10; i++ {
+		handler := sh
+		if i%2 == 0 {
+			handler = derived
+		}
+		if err := handleMsg(handler, strconv.Itoa(i)); err != nil {
+			t.Fatalf("cannot handle: %v", err)
+		}
+	}
+	warn := slog.NewRecord(time.Time{}, slog.LevelWarn, "w", 0)
+	if err := sh.Handle(context.Background(), warn); err != nil {
+		t.Fatalf("cannot handle: %v", err)
+	}
+	if got := h.messages(); !equalStrings(got, []string{"1", "2", "5", "8", "w"}) {
+		t.Errorf("unexpected records passed on: %q", got)
+	}
+
+	// After the interval, a summary of the suppressed records is emitted
+	// before the next record of the level.
+	time.Sleep(150 * time.Millisecond)
+	if err := handleMsg(sh, "next"); err != nil {
+		t.Fatalf("cannot handle: %v", err)
+	}
+	recs := h.records()
+	if len(recs) != 7 {
+		t.Fatalf("expected 7 records, got %d", len(recs))
+	}
+	if r := recs[5]; r.Level != slog.LevelInfo || recordAttr(r, "suppressed").Uint64() != 6 {
+		t.Errorf("unexpected summary record: %v %q", r.Level, r.Message)
+	}
+	if recs[6].Message != "next" {
+		t.Errorf("expected next record after summary, got %q", recs[6].Message)
+	}
+}
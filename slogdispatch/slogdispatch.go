@@ -2,7 +2,95 @@
 //
 // # Multi Handler
 //
-// Dispatches a log message to multiple slog.Handlers.
+// Dispatches a log message to multiple slog.Handlers, optionally
+// concurrently. A dynamic variant allows handlers to be added and removed at
+// runtime.
+//
+// # Failover Handler
+//
+// Dispatches a log message to a primary slog.Handler, falling back to
+// secondary handlers if the primary handler fails or reports that it is
+// unhealthy.
+//
+// # Health Checks
+//
+// Handlers can report their health by implementing HealthReporter or Pinger,
+// and the health of a tree of handlers can be checked using CheckHealth, for
+// example to report that a log sink is unreachable in a readiness probe.
+//
+// # Async Handler
+//
+// Queues log messages and passes them to another slog.Handler on a background
+// goroutine, with a configurable policy for when the queue is full.
+//
+// # Sampling Handler
+//
+// Passes on only a sample of log messages once a given number have been logged
+// in an interval, emitting a summary of the number suppressed.
+//
+// # Dedup Handler
+//
+// Suppresses log messages identical to one logged recently, logging a single
+// message with a repeat count instead.
+//
+// # Level Filter Handler
+//
+// Passes on only log messages whose level lies within a given band.
+//
+// # Context Min Level Handler
+//
+// Passes on only log messages at or above a minimum level which can be
+// specified for each context, so that a single request can be given more
+// verbose logging than the rest of the process.
+//
+// # Trigger Handler
+//
+// Buffers low-severity log messages for each context, and only passes them on
+// if a high-severity message is subsequently logged with the same context.
+//
+// # Transform Handler
+//
+// Applies a function to each log message which can modify its attributes or
+// drop it before it is passed on.
+//
+// # Tee Handler
+//
+// Dispatches a log message to multiple slog.Handlers, applying a different
+// transform function for each handler, for example to redact log messages
+// written to one handler only.
+//
+// # Context Attrs Handler
+//
+// Adds attributes derived from the context.Context, such as a request ID, to
+// each log message.
+//
+// # Recover Handler
+//
+// Recovers from panics in another slog.Handler, converting them to errors and
+// reporting them to a fallback handler.
+//
+// # Rate Limit Handler
+//
+// Limits the rate at which log messages are passed on, overall and for each
+// level, emitting a summary of the number dropped.
+//
+// # Stats Handler
+//
+// Counts the log messages passed to another slog.Handler by level, for
+// monitoring.
+//
+// # Middleware
+//
+// Handlers which wrap another handler, such as filters, transformers and
+// samplers, can be composed into pipelines using Chain.
+//
+// # Walking Handler Trees
+//
+// Handlers which dispatch to other handlers implement Parent, so that a tree
+// of handlers can be traversed using Walk, for example to flush or close all
+// handlers at shutdown using FlushAll or CloseAll. Drain stops queueing
+// handlers from accepting records and waits for their queues to empty, within
+// a deadline, for graceful shutdown.
 //
 // # Contextual Handler
 //
@@ -10,6 +98,9 @@
 // dynamic and programmatic fashion based on the context.Context, or in other
 // arbitrary ways.
 //
+// Several resolvers can be consulted in turn, falling back to a default
+// handler, using NewResolverChain.
+//
 // # Simple Context Handler Store
 //
 // A simple contextual resolver implementation which can associate a single
@@ -17,38 +108,88 @@
 // or to a default handler if none is set. Helper functions are provided
 // to create modified contexts with slog attributes, groups, etc.
 //
+// # Goroutine Handler Store
+//
+// A contextual resolver which dispatches according to a handler bound to the
+// logging goroutine, for code which cannot pass a context.Context through
+// every call.
+//
+// # Store Resolver
+//
+// A contextual resolver which dispatches to handlers registered under names,
+// choosing a handler by the name associated with a context.
+//
 // # Router Handler
 //
 // Processes a sequence of predicate rules and dispatches to arbitrary
-// handlers accordingly.
+// handlers accordingly. Predicates for common conditions are provided and can
+// be combined using And, Or and Not, or compiled from expressions using
+// ParseMatch. The rules can be changed at runtime.
+//
+// # Facility Router
+//
+// Dispatches log messages according to the facility which logged them, or the
+// groups they were logged in, to the handler of the most specific matching
+// route.
 //
 // # Default Handler
 //
 // Forwards all calls to the slog.Default() handler. The only reason to use this
 // (rather than just using slog.Default() directly) is if you are configuring
 // something to use the default handler and want it to update automatically
-// if a program changes slog.Default().
+// if a program changes slog.Default(). A callback can be notified of such
+// changes using NewDefaultHandlerWithOptions.
 package slogdispatch
 
 import (
 	"context"
 	"github.com/KarpelesLab/weak"
 	"golang.org/x/exp/slog"
+	"hash/fnv"
+	"io"
+	"math/rand"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
 // Multi Handler
 
 type multiHandler struct {
 	handlers []slog.Handler
+	opts     MultiHandlerOptions
+}
+
+// Options for NewMultiHandlerWithOptions.
+type MultiHandlerOptions struct {
+	// If set, the Handle method of each handler is called in its own
+	// goroutine, so that a slow handler does not delay the others. Handle
+	// waits for all handlers to return, or for Timeout to elapse.
+	Concurrent bool
+
+	// If non-zero and Concurrent is set, the context passed to each handler
+	// has a deadline this far in the future, and Handle returns when the
+	// deadline passes even if some handlers have not yet returned. Those
+	// handlers continue to run in the background, and Handle returns
+	// context.DeadlineExceeded.
+	Timeout time.Duration
 }
 
 // Creates a slog.Handler which dispatches to each handler in the slice passed.
 func NewMultiHandler(handlers []slog.Handler) slog.Handler {
-	return &multiHandler{
+	return NewMultiHandlerWithOptions(handlers, nil)
+}
+
+// Like NewMultiHandler, but allows options to be specified. If opts is nil,
+// the default options are used.
+func NewMultiHandlerWithOptions(handlers []slog.Handler, opts *MultiHandlerOptions) slog.Handler {
+	mh := &multiHandler{
 		handlers: handlers,
 	}
+	if opts != nil {
+		mh.opts = *opts
+	}
+	return mh
 }
 
 func (mh *multiHandler) Enabled(ctx context.Context, lvl slog.Level) bool {
@@ -61,6 +202,10 @@ func (mh *multiHandler) Enabled(ctx context.Context, lvl slog.Level) bool {
 }
 
 func (mh *multiHandler) Handle(ctx context.Context, r slog.Record) error {
+	if mh.opts.Concurrent {
+		return mh.handleConcurrent(ctx, r)
+	}
+
 	var firstErr error
 
 	for _, subh := range mh.handlers {
@@ -77,11 +222,67 @@ func (mh *multiHandler) Handle(ctx context.Context, r slog.Record) error {
 	return firstErr
 }
 
-func (mh *multiHandler) specialise(attrs []slog.Attr, groupName string) slog.Handler {
-	newHandlers := make([]slog.Handler, len(mh.handlers))
+func (mh *multiHandler) handleConcurrent(ctx context.Context, r slog.Record) error {
+	if mh.opts.Timeout != 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, mh.opts.Timeout)
+		defer cancel()
+
+		// Handlers may still be running after we return.
+		r = r.Clone()
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(mh.handlers))
 	for i, subh := range mh.handlers {
+		if !subh.Enabled(ctx, r.Level) {
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, subh slog.Handler) {
+			defer wg.Done()
+			errs[i] = subh.Handle(ctx, r)
+		}(i, subh)
+	}
+
+	if mh.opts.Timeout == 0 {
+		wg.Wait()
+		return firstError(errs)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return firstError(errs)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Returns the first non-nil error in the slice, or nil.
+func firstError(errs []error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Derives a handler from each of the handlers passed using WithAttrs (if attrs
+// is non-empty) and WithGroup (if groupName is non-empty). Each handler
+// receives its own copy of attrs.
+func specialiseAll(handlers []slog.Handler, attrs []slog.Attr, groupName string) []slog.Handler {
+	newHandlers := make([]slog.Handler, len(handlers))
+	for i, subh := range handlers {
 		var nextAttrs []slog.Attr
-		if i != len(mh.handlers)-1 {
+		if i != len(handlers)-1 {
 			nextAttrs = make([]slog.Attr, len(attrs))
 			copy(nextAttrs, attrs)
 		}
@@ -96,8 +297,13 @@ func (mh *multiHandler) specialise(attrs []slog.Attr, groupName string) slog.Han
 		attrs = nextAttrs
 	}
 
+	return newHandlers
+}
+
+func (mh *multiHandler) specialise(attrs []slog.Attr, groupName string) slog.Handler {
 	return &multiHandler{
-		handlers: newHandlers,
+		handlers: specialiseAll(mh.handlers, attrs, groupName),
+		opts:     mh.opts,
 	}
 }
 
@@ -117,6 +323,23 @@ func (mh *multiHandler) WithGroup(name string) slog.Handler {
 	return mh.specialise(nil, name)
 }
 
+// Implements Parent.
+func (mh *multiHandler) Children() []slog.Handler {
+	return mh.handlers
+}
+
+// Implements HealthReporter. The handler is healthy if all of its handlers are
+// healthy.
+func (mh *multiHandler) Healthy() bool {
+	return allHealthy(mh.handlers)
+}
+
+// Implements Pinger. Returns the errors of the handlers which are unhealthy,
+// as for CheckHealth.
+func (mh *multiHandler) Ping(ctx context.Context) error {
+	return checkAllHealth(ctx, mh.handlers)
+}
+
 // Contextual Handler
 
 // A handler cache maps a slog.Handler (the base handler) to a set of derived
@@ -139,17 +362,50 @@ func (mh *multiHandler) WithGroup(name string) slog.Handler {
 // from the base actual handler.
 //
 // These derived handlers are constructed as needed internally and maintained
-// in a weak map to ensure they are freed if not needed anymore.
+// in a weak map to ensure they are freed if not needed anymore, or
+// alternatively in a size-bounded LRU cache (see NewHandlerCacheLRU).
+//
+// So that a HandlerCache can be used from many goroutines at once without
+// contention, its entries are divided between a number of independently
+// locked shards by the ID of the derived contextual handler. Moreover, each
+// derived contextual handler remembers the handler it most recently derived,
+// so that the common case of a single HandlerCache being used with a given
+// contextual handler does not need to consult the cache at all.
 type HandlerCache struct {
 	handler slog.Handler
-	cache   *weak.Map[uint64, slog.Handler]
+	cache   handlerStore
+}
+
+// Stores derived handlers by the ID of the contextual handler they were
+// derived for.
+type handlerStore interface {
+	get(id uint64) slog.Handler
+	set(id uint64, h slog.Handler)
+}
+
+// The number of shards a handler cache is divided into.
+const handlerCacheShards = 16
+
+// Divides entries between a number of stores by ID.
+type shardedHandlerStore []handlerStore
+
+func (s shardedHandlerStore) get(id uint64) slog.Handler {
+	return s[id%uint64(len(s))].get(id)
+}
+
+func (s shardedHandlerStore) set(id uint64, h slog.Handler) {
+	s[id%uint64(len(s))].set(id, h)
 }
 
 // Create a new handler cache for the given base handler.
 func NewHandlerCache(handler slog.Handler) *HandlerCache {
+	shards := make(shardedHandlerStore, handlerCacheShards)
+	for i := range shards {
+		shards[i] = weakHandlerStore{weak.NewMap[uint64, slog.Handler]()}
+	}
 	return &HandlerCache{
 		handler: handler,
-		cache:   weak.NewMap[uint64, slog.Handler](),
+		cache:   shards,
 	}
 }
 
@@ -159,7 +415,19 @@ func (hc *HandlerCache) Handler() slog.Handler {
 }
 
 func (hc *HandlerCache) get(id uint64) slog.Handler {
-	v := hc.cache.Get(id)
+	return hc.cache.get(id)
+}
+
+func (hc *HandlerCache) set(id uint64, h slog.Handler) {
+	hc.cache.set(id, h)
+}
+
+type weakHandlerStore struct {
+	m *weak.Map[uint64, slog.Handler]
+}
+
+func (s weakHandlerStore) get(id uint64) slog.Handler {
+	v := s.m.Get(id)
 	if v == nil {
 		return nil
 	}
@@ -167,18 +435,25 @@ func (hc *HandlerCache) get(id uint64) slog.Handler {
 	return *v
 }
 
-func (hc *HandlerCache) set(id uint64, h slog.Handler) {
-	hc.cache.Set(id, &h)
+func (s weakHandlerStore) set(id uint64, h slog.Handler) {
+	s.m.Set(id, &h)
 }
 
 type ResolveArgs struct {
 	Level  slog.Level
 	Record *slog.Record
+
+	// The names of the groups opened on the handler using WithGroup, outermost
+	// first. This is only set by RouterHandler.
+	Groups []string
 }
 
 // Used by a contextual handler to obtain the correct handler and associated
 // cache data in a context-dependent way. The user of this package must
 // implement this interface.
+//
+// A ContextualResolver may also implement Parent, returning the handlers it
+// can resolve to, so that Walk can find them.
 type ContextualResolver interface {
 	// This method must choose the desired slog.Handler based on the provided
 	// context, and then return a HandlerCache created from that slog.Handler by
@@ -187,6 +462,10 @@ type ContextualResolver interface {
 	//
 	// args.Record is nil if this is being called as part of an Enable call, and
 	// otherwise points to the record data about to be logged.
+	//
+	// Resolve may return nil if it cannot choose a handler for the context.
+	// When used with NewResolverChain, the next resolver is then consulted;
+	// when used directly by a contextual handler, the record is discarded.
 	Resolve(ctx context.Context, args ResolveArgs) *HandlerCache
 }
 
@@ -215,6 +494,15 @@ type contextualHandler struct {
 	attrs     []slog.Attr
 	groupName string
 	id        uint64
+
+	// The handler most recently derived by this handler, and the cache it was
+	// derived for.
+	last atomic.Pointer[cachedHandler]
+}
+
+type cachedHandler struct {
+	hc *HandlerCache
+	h  slog.Handler
 }
 
 // Creates a new contextual handler. A contextual handler is a slog.Handler
@@ -237,7 +525,7 @@ func (ch *contextualHandler) Enabled(ctx context.Context, level slog.Level) bool
 		Level:  level,
 		Record: nil,
 	})
-	return h.Enabled(ctx, level)
+	return h != nil && h.Enabled(ctx, level)
 }
 
 func (ch *contextualHandler) Handle(ctx context.Context, record slog.Record) error {
@@ -245,6 +533,9 @@ func (ch *contextualHandler) Handle(ctx context.Context, record slog.Record) err
 		Level:  record.Level,
 		Record: &record,
 	})
+	if h == nil {
+		return nil
+	}
 	return h.Handle(ctx, record)
 }
 
@@ -253,6 +544,10 @@ func (ch *contextualHandler) resolveUsingCache(hc *HandlerCache) slog.Handler {
 		return hc.Handler()
 	}
 
+	if last := ch.last.Load(); last != nil && last.hc == hc {
+		return last.h
+	}
+
 	if h := hc.get(ch.id); h != nil {
 		return h
 	}
@@ -271,29 +566,101 @@ func (ch *contextualHandler) resolveUsingCache(hc *HandlerCache) slog.Handler {
 	}
 
 	hc.set(ch.id, h)
+
+	// Only update the last handler when deriving a new one, so that
+	// alternating between several caches does not cause an allocation on
+	// every call.
+	ch.last.Store(&cachedHandler{hc, h})
 	return h
 }
 
 func (ch *contextualHandler) resolveHandler(ctx context.Context, args ResolveArgs) slog.Handler {
-	return ch.resolveUsingCache(ch.s.resolver.Resolve(ctx, args))
+	hc := ch.s.resolver.Resolve(ctx, args)
+	if hc == nil {
+		return nil
+	}
+	return ch.resolveUsingCache(hc)
 }
 
 func (ch *contextualHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
 	return &contextualHandler{
-		s:     ch.s,
-		attrs: attrs,
-		id:    ch.s.getNextID(),
+		s:      ch.s,
+		parent: ch,
+		attrs:  attrs,
+		id:     ch.s.getNextID(),
 	}
 }
 
 func (ch *contextualHandler) WithGroup(name string) slog.Handler {
 	return &contextualHandler{
 		s:         ch.s,
+		parent:    ch,
 		groupName: name,
 		id:        ch.s.getNextID(),
 	}
 }
 
+// Implements Parent.
+func (ch *contextualHandler) Children() []slog.Handler {
+	if p, ok := ch.s.resolver.(Parent); ok {
+		return p.Children()
+	}
+	return nil
+}
+
+// Resolver Chain
+
+type resolverChain struct {
+	resolvers    []ContextualResolver
+	defaultCache *HandlerCache
+}
+
+// Creates a ContextualResolver which consults each of the given resolvers in
+// turn, returning the first non-nil result, or a HandlerCache for
+// defaultHandler if all of them return nil. This allows layered resolution,
+// for example of a request-scoped handler, then a tenant-scoped handler, then
+// a default handler. If defaultHandler is nil, the chain returns nil if no
+// resolver resolves the context.
+func NewResolverChain(resolvers []ContextualResolver, defaultHandler slog.Handler) ContextualResolver {
+	rc := &resolverChain{
+		resolvers: resolvers,
+	}
+	if defaultHandler != nil {
+		rc.defaultCache = NewHandlerCache(defaultHandler)
+	}
+	return rc
+}
+
+// Implements ContextualResolver.
+func (rc *resolverChain) Resolve(ctx context.Context, args ResolveArgs) *HandlerCache {
+	for _, r := range rc.resolvers {
+		if hc := r.Resolve(ctx, args); hc != nil {
+			return hc
+		}
+	}
+	return rc.defaultCache
+}
+
+// Implements Parent. Returns the handlers returned by the resolvers which
+// implement Parent, and the default handler.
+func (rc *resolverChain) Children() []slog.Handler {
+	var handlers []slog.Handler
+	for _, r := range rc.resolvers {
+		if p, ok := r.(Parent); ok {
+			handlers = append(handlers, p.Children()...)
+		}
+	}
+	if rc.defaultCache != nil {
+		handlers = append(handlers, rc.defaultCache.Handler())
+	}
+	return handlers
+}
+
+// Creates a contextual handler using a resolver created by NewResolverChain.
+func NewContextualHandlerChain(resolvers []ContextualResolver, defaultHandler slog.Handler) slog.Handler {
+	return NewContextualHandler(NewResolverChain(resolvers, defaultHandler))
+}
+
 // Simple Context Handler Store
 type SimpleResolver struct {
 	defaultCache *HandlerCache
@@ -301,11 +668,14 @@ type SimpleResolver struct {
 
 // A simple resolver which obtains a HandlerCache by inspecting a context for
 // the key set via the WithHandler() function. If none is set, uses the default
-// handler given.
+// handler given. If defaultHandler is nil, Resolve returns nil if no handler is
+// set, so that the resolver can be used in a chain (see NewResolverChain).
 func NewSimpleResolver(defaultHandler slog.Handler) *SimpleResolver {
-	return &SimpleResolver{
-		defaultCache: NewHandlerCache(defaultHandler),
+	sr := &SimpleResolver{}
+	if defaultHandler != nil {
+		sr.defaultCache = NewHandlerCache(defaultHandler)
 	}
+	return sr
 }
 
 var _ ContextualResolver = &SimpleResolver{}
@@ -314,6 +684,14 @@ type contextKey string
 
 const key contextKey = "hc"
 
+// Implements Parent. Returns the default handler.
+func (sr *SimpleResolver) Children() []slog.Handler {
+	if sr.defaultCache == nil {
+		return nil
+	}
+	return []slog.Handler{sr.defaultCache.Handler()}
+}
+
 // Implements ContextualResolver.
 func (sr *SimpleResolver) Resolve(ctx context.Context, args ResolveArgs) *HandlerCache {
 	c, _ := ctx.Value(key).(*HandlerCache)
@@ -324,15 +702,63 @@ func (sr *SimpleResolver) Resolve(ctx context.Context, args ResolveArgs) *Handle
 }
 
 // Equivalent to creating a new handler using slog.Handler.WithArgs and then
-// creating a new derived context using that handler using WithHandler.
+// creating a new derived context using that handler using WithHandler. The
+// handler is derived from the handler set on the context, or the default
+// handler if there is none; it panics if there is neither.
+//
+// The arguments are interpreted as for slog.Logger.With: alternating keys and
+// values, slog.Attr values (including those created by slog.Group) and
+// []slog.Attr values. If a group has been opened on the handler using
+// WithGroup, the attributes are added inside that group.
 func (sr *SimpleResolver) WithAttrs(ctx context.Context, args ...any) context.Context {
-	return WithHandler(ctx, sr.Resolve(ctx, ResolveArgs{}).Handler().WithAttrs(argsToAttrSlice(args)))
+	ctx, ok := sr.TryWithAttrs(ctx, args...)
+	if !ok {
+		panic("used SimpleResolver.WithAttrs on context without existing slog handler or default handler")
+	}
+	return ctx
+}
+
+// Like WithAttrs, but returns the context unchanged and false instead of
+// panicking if there is no handler to derive from.
+func (sr *SimpleResolver) TryWithAttrs(ctx context.Context, args ...any) (context.Context, bool) {
+	hc := sr.Resolve(ctx, ResolveArgs{})
+	if hc == nil {
+		return ctx, false
+	}
+	return withAttrs(ctx, hc, args), true
 }
 
 // Equivalent to creating a new handler using slog.Handler.WithGroup and then
-// creating a new derived context using that handler using WithHandler.
+// creating a new derived context using that handler using WithHandler. It
+// panics if there is no handler to derive from, as for WithAttrs.
 func (sr *SimpleResolver) WithGroup(ctx context.Context, name string) context.Context {
-	return WithHandler(ctx, sr.Resolve(ctx, ResolveArgs{}).Handler().WithGroup(name))
+	ctx, ok := sr.TryWithGroup(ctx, name)
+	if !ok {
+		panic("used SimpleResolver.WithGroup on context without existing slog handler or default handler")
+	}
+	return ctx
+}
+
+// Like WithGroup, but returns the context unchanged and false instead of
+// panicking if there is no handler to derive from.
+func (sr *SimpleResolver) TryWithGroup(ctx context.Context, name string) (context.Context, bool) {
+	hc := sr.Resolve(ctx, ResolveArgs{})
+	if hc == nil {
+		return ctx, false
+	}
+	return WithHandler(ctx, hc.Handler().WithGroup(name)), true
+}
+
+// Equivalent to calling WithGroup and then WithAttrs, opening a group and
+// adding attributes inside it, but creates only a single derived context.
+// Attributes subsequently added to the context are also added inside the
+// group.
+func (sr *SimpleResolver) WithGroupAttrs(ctx context.Context, name string, args ...any) context.Context {
+	hc := sr.Resolve(ctx, ResolveArgs{})
+	if hc == nil {
+		panic("used SimpleResolver.WithGroupAttrs on context without existing slog handler or default handler")
+	}
+	return withGroupAttrs(ctx, hc, name, args)
 }
 
 // Creates a context derived from the given context but with the given
@@ -351,19 +777,51 @@ func WithHandler(ctx context.Context, handler slog.Handler) context.Context {
 // SimpleResolver. However, it panics if there is no existing handler set on
 // the context to derive from.
 func WithAttrs(ctx context.Context, args ...any) context.Context {
-	return WithHandler(ctx, cacheOrPanic(ctx).Handler().WithAttrs(argsToAttrSlice(args)))
+	return withAttrs(ctx, cacheOrPanic(ctx), args)
+}
+
+// Like WithAttrs, but returns the context unchanged and false instead of
+// panicking if there is no existing handler set on the context.
+func TryWithAttrs(ctx context.Context, args ...any) (context.Context, bool) {
+	hc, _ := ctx.Value(key).(*HandlerCache)
+	if hc == nil {
+		return ctx, false
+	}
+	return withAttrs(ctx, hc, args), true
 }
 
 // Similar to SimpleResolver.WithGroup, but does not need to be called on a
 // SimpleResolver. However, it panics if there is no existing handler set on
 // the context to derive from.
 func WithGroup(ctx context.Context, name string) context.Context {
-	c, _ := ctx.Value(key).(*HandlerCache)
-	if c == nil {
-		panic("")
+	return WithHandler(ctx, cacheOrPanic(ctx).Handler().WithGroup(name))
+}
+
+// Similar to SimpleResolver.WithGroupAttrs, but does not need to be called on
+// a SimpleResolver. However, it panics if there is no existing handler set on
+// the context to derive from.
+func WithGroupAttrs(ctx context.Context, name string, args ...any) context.Context {
+	return withGroupAttrs(ctx, cacheOrPanic(ctx), name, args)
+}
+
+// Derives a context whose handler is derived from the handler of hc using
+// WithAttrs. If there are no attributes, ctx is returned unchanged.
+func withAttrs(ctx context.Context, hc *HandlerCache, args []any) context.Context {
+	attrs := argsToAttrSlice(args)
+	if len(attrs) == 0 {
+		return ctx
 	}
+	return WithHandler(ctx, hc.Handler().WithAttrs(attrs))
+}
 
-	return WithHandler(ctx, cacheOrPanic(ctx).Handler().WithGroup(name))
+// Derives a context whose handler is derived from the handler of hc using
+// WithGroup and then WithAttrs.
+func withGroupAttrs(ctx context.Context, hc *HandlerCache, name string, args []any) context.Context {
+	h := hc.Handler().WithGroup(name)
+	if attrs := argsToAttrSlice(args); len(attrs) > 0 {
+		h = h.WithAttrs(attrs)
+	}
+	return WithHandler(ctx, h)
 }
 
 func cacheOrPanic(ctx context.Context) *HandlerCache {
@@ -383,6 +841,12 @@ func argsToAttrSlice(args []any) []slog.Attr {
 	)
 
 	for len(args) > 0 {
+		if x, ok := args[0].([]slog.Attr); ok {
+			attrs = append(attrs, x...)
+			args = args[1:]
+			continue
+		}
+
 		attr, args = argsToAttr(args)
 		attrs = append(attrs, attr)
 
@@ -412,14 +876,96 @@ func argsToAttr(args []any) (slog.Attr, []any) {
 	}
 }
 
-type routerHandler struct {
+// A router handler. See NewRouterHandler.
+type RouterHandler struct {
+	rs         *routerRuleSet
+	enableFunc func(ctx context.Context, level slog.Level) bool
+	attrs      []slog.Attr
+	groupName  string
+	groups     []string // groupName and the group names of the parents
+	parent     *RouterHandler
+
 	m               sync.RWMutex
-	enableFunc      func(ctx context.Context, level slog.Level) bool
-	rules           []RouterRule
-	derivedHandlers []slog.Handler
-	attrs           []slog.Attr
-	groupName       string
-	parent          *routerHandler
+	gen             uint64         // generation of rules derivedHandlers corresponds to
+	derivedHandlers []slog.Handler // handlers of rules derived using attrs and groupName
+}
+
+// The rules of a router handler, shared between it and all handlers derived
+// from it.
+type routerRuleSet struct {
+	m     sync.RWMutex
+	rules []RouterRule // replaced, not modified, when the rules change
+	gen   uint64       // incremented when the rules change
+
+	// If set, Enabled is computed from the handlers of the rules, and the
+	// result for each level is cached in enabled until the rules change or
+	// the cache is invalidated, when enabledGen is incremented.
+	auto       bool
+	enabled    map[slog.Level]bool
+	enabledGen uint64
+}
+
+// Returns the current rules and their generation.
+func (rs *routerRuleSet) get() ([]RouterRule, uint64) {
+	rs.m.RLock()
+	defer rs.m.RUnlock()
+	return rs.rules, rs.gen
+}
+
+// Replaces the rules with the result of f, which must not modify the slice it
+// is passed.
+func (rs *routerRuleSet) update(f func(rules []RouterRule) []RouterRule) {
+	rs.m.Lock()
+	defer rs.m.Unlock()
+	rs.rules = f(rs.rules)
+	rs.gen++
+	rs.invalidateEnabled()
+}
+
+func (rs *routerRuleSet) invalidateEnabled() {
+	rs.enabled = nil
+	rs.enabledGen++
+}
+
+// Reports whether any rule handler is enabled for the given level, using the
+// cached result if there is one. Results are neither cached nor used for a
+// context carrying a minimum level set using WithMinLevel, since handlers
+// created using NewMinLevelHandler depend on it.
+func (rs *routerRuleSet) anyEnabled(ctx context.Context, level slog.Level) bool {
+	if _, ok := MinLevel(ctx); ok {
+		rules, _ := rs.get()
+		return anyRuleEnabled(ctx, rules, level)
+	}
+
+	rs.m.RLock()
+	enabled, ok := rs.enabled[level]
+	rules, gen := rs.rules, rs.enabledGen
+	rs.m.RUnlock()
+	if ok {
+		return enabled
+	}
+
+	enabled = anyRuleEnabled(ctx, rules, level)
+
+	rs.m.Lock()
+	defer rs.m.Unlock()
+	if rs.enabledGen == gen {
+		if rs.enabled == nil {
+			rs.enabled = make(map[slog.Level]bool)
+		}
+		rs.enabled[level] = enabled
+	}
+	return enabled
+}
+
+// Reports whether the handler of any of the given rules is enabled.
+func anyRuleEnabled(ctx context.Context, rules []RouterRule, level slog.Level) bool {
+	for i := range rules {
+		if rules[i].Handler.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
 }
 
 // A routing rule which is processed in order.
@@ -430,12 +976,62 @@ type routerHandler struct {
 // handlers.
 type RouterRule struct {
 	// The predicate function which will be called to determine whether this
-	// rule matches.
-	MatchFunc func(ctx context.Context, args ResolveArgs) bool
+	// rule matches. See MatchFunc for helpers to construct predicates.
+	MatchFunc MatchFunc
 	// The handler to dispatch to if this rule matches.
 	Handler slog.Handler
 	// If not set, processing stops if this rule matches.
 	Continue bool
+	// An optional name for the rule, which can be used to remove it using
+	// RouterHandler.RemoveRule.
+	Name string
+	// If between 0 and 1 (exclusive), the rule only matches this fraction of
+	// the records for which MatchFunc returns true, and the remainder are
+	// treated as though it returned false. This can be used to send a sample
+	// of verbose logging to an expensive handler.
+	Fraction float64
+	// If set, whether a record falls within Fraction is determined by a hash
+	// of its message and attributes, so that identical records are always
+	// treated alike. Otherwise it is determined randomly.
+	FractionByHash bool
+}
+
+// Reports whether the rule matches a record.
+func (r *RouterRule) matches(ctx context.Context, args ResolveArgs) bool {
+	if !r.MatchFunc(ctx, args) {
+		return false
+	}
+	if r.Fraction <= 0 || r.Fraction >= 1 {
+		return true
+	}
+
+	var x float64
+	if r.FractionByHash && args.Record != nil {
+		x = hashFraction(args.Record)
+	} else {
+		x = rand.Float64()
+	}
+	return x < r.Fraction
+}
+
+// Maps a hash of the message and attributes of a record to [0, 1).
+func hashFraction(r *slog.Record) float64 {
+	h := fnv.New64a()
+	io.WriteString(h, r.Message)
+	r.Attrs(func(a slog.Attr) bool {
+		io.WriteString(h, "\x00"+a.Key+"=")
+		io.WriteString(h, a.Value.Resolve().String())
+		return true
+	})
+	// The high bits of FNV-1a are poorly distributed for short inputs, so the
+	// hash is mixed using the splitmix64 finalizer.
+	x := h.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return float64(x>>11) / (1 << 53)
 }
 
 // Creates a new router handler. This is a handler which will inspect the
@@ -444,36 +1040,64 @@ type RouterRule struct {
 //
 // The rules are processed in order (see RouterRule). If enableFunc is non-nil,
 // it will be used to provide the slog.Handler.Enabled function; otherwise
-// Enabled will always return true (which is less efficient).
-func NewRouterHandler(rules []RouterRule, enableFunc func(ctx context.Context, level slog.Level) bool) slog.Handler {
-	rh := &routerHandler{
-		rules:           rules,
-		enableFunc:      enableFunc,
-		derivedHandlers: make([]slog.Handler, len(rules)),
-	}
-
-	for i := range rules {
-		rh.derivedHandlers[i] = rules[i].Handler
+// Enabled will always return true (which is less efficient; see
+// NewRouterHandlerAuto).
+//
+// The rules can be changed at runtime using AddRule, RemoveRule and
+// ReplaceRules.
+func NewRouterHandler(rules []RouterRule, enableFunc func(ctx context.Context, level slog.Level) bool) *RouterHandler {
+	return &RouterHandler{
+		rs: &routerRuleSet{
+			rules: rules,
+			gen:   1,
+		},
+		enableFunc: enableFunc,
 	}
+}
 
+// Like NewRouterHandler, but Enabled reports whether the handler of any rule
+// is enabled for the level, so that records which no handler would log are
+// not constructed. The result for each level is cached until the rules are
+// changed; if the levels of the handlers of the rules can change at runtime,
+// call InvalidateEnabled after changing them.
+//
+// Since the cache is shared by all contexts, the Enabled methods of the
+// handlers must not depend on the context, with the exception of handlers
+// created using NewMinLevelHandler: the cache is bypassed for contexts which
+// carry a minimum level set using WithMinLevel. If other handlers depend on
+// the context, use NewRouterHandler with an enableFunc instead.
+func NewRouterHandlerAuto(rules []RouterRule) *RouterHandler {
+	rh := NewRouterHandler(rules, nil)
+	rh.rs.auto = true
 	return rh
 }
 
-var _ slog.Handler = &routerHandler{}
+var _ slog.Handler = &RouterHandler{}
 
-func (rh *routerHandler) Enabled(ctx context.Context, level slog.Level) bool {
+func (rh *RouterHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	if rh.rs.auto {
+		return rh.rs.anyEnabled(ctx, level)
+	}
 	if rh.enableFunc == nil {
 		return true
 	}
 	return rh.enableFunc(ctx, level)
 }
 
-func (rh *routerHandler) deriveHandler(i int) slog.Handler {
-	var base slog.Handler
+// Discards the results cached by Enabled for a router created using
+// NewRouterHandlerAuto, so that changes to the levels of the handlers of the
+// rules take effect. It has no effect on other routers.
+func (rh *RouterHandler) InvalidateEnabled() {
+	rh.rs.m.Lock()
+	defer rh.rs.m.Unlock()
+	rh.rs.invalidateEnabled()
+}
+
+// Derives a handler from base using the attributes and groups of rh and its
+// parents.
+func (rh *RouterHandler) deriveHandler(base slog.Handler) slog.Handler {
 	if rh.parent != nil {
-		base = rh.parent.deriveHandler(i)
-	} else {
-		base = rh.derivedHandlers[i]
+		base = rh.parent.deriveHandler(base)
 	}
 
 	if rh.attrs != nil {
@@ -489,28 +1113,43 @@ func (rh *routerHandler) deriveHandler(i int) slog.Handler {
 	return base
 }
 
-func (rh *routerHandler) Handle(ctx context.Context, record slog.Record) error {
+// Returns the derived handler for rule i of the given generation of rules,
+// deriving it and caching it if necessary.
+func (rh *RouterHandler) derivedHandler(rules []RouterRule, gen uint64, i int) slog.Handler {
+	rh.m.RLock()
+	if rh.gen == gen && rh.derivedHandlers[i] != nil {
+		subh := rh.derivedHandlers[i]
+		rh.m.RUnlock()
+		return subh
+	}
+	rh.m.RUnlock()
+
+	subh := rh.deriveHandler(rules[i].Handler)
+
+	rh.m.Lock()
+	defer rh.m.Unlock()
+	if rh.gen < gen {
+		rh.gen = gen
+		rh.derivedHandlers = make([]slog.Handler, len(rules))
+	}
+	if rh.gen == gen {
+		rh.derivedHandlers[i] = subh
+	}
+	return subh
+}
+
+func (rh *RouterHandler) Handle(ctx context.Context, record slog.Record) error {
 	var firstErr error
 
-	for i := range rh.rules {
-		r := &rh.rules[i]
-		if r.MatchFunc(ctx, ResolveArgs{
+	rules, gen := rh.rs.get()
+	for i := range rules {
+		r := &rules[i]
+		if r.matches(ctx, ResolveArgs{
 			Level:  record.Level,
 			Record: &record,
+			Groups: rh.groups,
 		}) {
-			rh.m.RLock()
-			subh := rh.derivedHandlers[i]
-			if subh == nil {
-				rh.m.RUnlock()
-				rh.m.Lock()
-				subh = rh.derivedHandlers[i]
-				if subh == nil {
-					subh = rh.deriveHandler(i)
-					rh.derivedHandlers[i] = subh
-				}
-				rh.m.Unlock()
-			}
-			rh.m.RUnlock()
+			subh := rh.derivedHandler(rules, gen, i)
 			err := subh.Handle(ctx, record)
 			if err != nil && firstErr == nil {
 				firstErr = err
@@ -524,28 +1163,96 @@ func (rh *routerHandler) Handle(ctx context.Context, record slog.Record) error {
 	return firstErr
 }
 
-func (rh *routerHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
-	return &routerHandler{
-		enableFunc:      rh.enableFunc,
-		rules:           rh.rules,
-		derivedHandlers: make([]slog.Handler, len(rh.rules)),
-		parent:          rh,
-		attrs:           attrs,
+func (rh *RouterHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &RouterHandler{
+		rs:         rh.rs,
+		enableFunc: rh.enableFunc,
+		parent:     rh,
+		attrs:      attrs,
+		groups:     rh.groups,
+	}
+}
+
+func (rh *RouterHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return rh
+	}
+	return &RouterHandler{
+		rs:         rh.rs,
+		enableFunc: rh.enableFunc,
+		parent:     rh,
+		groupName:  name,
+		groups:     append(rh.groups[:len(rh.groups):len(rh.groups)], name),
 	}
 }
 
-func (rh *routerHandler) WithGroup(name string) slog.Handler {
-	return &routerHandler{
-		enableFunc:      rh.enableFunc,
-		rules:           rh.rules,
-		derivedHandlers: make([]slog.Handler, len(rh.rules)),
-		parent:          rh,
-		groupName:       name,
+// Implements Parent. Returns the handlers of the current rules.
+func (rh *RouterHandler) Children() []slog.Handler {
+	rules, _ := rh.rs.get()
+	handlers := make([]slog.Handler, len(rules))
+	for i := range rules {
+		handlers[i] = rules[i].Handler
 	}
+	return handlers
+}
+
+// Implements HealthReporter. The handler is healthy if the handlers of all of
+// the current rules are healthy.
+func (rh *RouterHandler) Healthy() bool {
+	return allHealthy(rh.Children())
+}
+
+// Implements Pinger. Returns the errors of the handlers of the current rules
+// which are unhealthy, as for CheckHealth.
+func (rh *RouterHandler) Ping(ctx context.Context) error {
+	return checkAllHealth(ctx, rh.Children())
+}
+
+// Returns a copy of the current rules.
+func (rh *RouterHandler) Rules() []RouterRule {
+	rules, _ := rh.rs.get()
+	return append([]RouterRule(nil), rules...)
+}
+
+// Appends a rule to the rules of the router. The change affects the handler
+// it is called on, the handler it was derived from and all other handlers
+// derived from it, and takes effect for records handled after AddRule
+// returns.
+func (rh *RouterHandler) AddRule(rule RouterRule) {
+	rh.rs.update(func(rules []RouterRule) []RouterRule {
+		return append(rules[:len(rules):len(rules)], rule)
+	})
+}
+
+// Removes all rules with the given name, returning the number of rules
+// removed. The change takes effect as for AddRule.
+func (rh *RouterHandler) RemoveRule(name string) int {
+	n := 0
+	rh.rs.update(func(rules []RouterRule) []RouterRule {
+		newRules := make([]RouterRule, 0, len(rules))
+		for _, r := range rules {
+			if r.Name == name {
+				n++
+				continue
+			}
+			newRules = append(newRules, r)
+		}
+		return newRules
+	})
+	return n
+}
+
+// Replaces all rules of the router. The change takes effect as for AddRule.
+func (rh *RouterHandler) ReplaceRules(rules []RouterRule) {
+	rules = append([]RouterRule(nil), rules...)
+	rh.rs.update(func([]RouterRule) []RouterRule {
+		return rules
+	})
 }
 
 type defaultHandler struct {
 	m              sync.RWMutex
+	s              *defaultHandlerState
 	parent         *defaultHandler
 	attrs          []slog.Attr
 	groupName      string
@@ -553,11 +1260,58 @@ type defaultHandler struct {
 	h              slog.Handler
 }
 
+// State shared between a default handler and the handlers derived from it.
+type defaultHandlerState struct {
+	onChange func(old, current slog.Handler)
+
+	m      sync.Mutex
+	logger *slog.Logger // the default logger most recently observed
+}
+
+// Options for NewDefaultHandlerWithOptions.
+type DefaultHandlerOptions struct {
+	// If set, called when the handler (or a handler derived from it) observes
+	// that slog.Default() has changed, with the handlers of the previous and
+	// current default loggers. This allows an application to flush the
+	// previous handler, or to rebuild state which depends on it.
+	//
+	// Changes are observed lazily, the next time the handler is used after
+	// slog.SetDefault is called, and OnChange is called once per change
+	// however many derived handlers observe it. It is not called with any
+	// lock held, so it may itself log.
+	OnChange func(old, current slog.Handler)
+}
+
 var _ slog.Handler = &defaultHandler{}
 
 // Creates a handler which always routes to the handler used by slog.Default().
 func NewDefaultHandler() slog.Handler {
-	return &defaultHandler{}
+	return NewDefaultHandlerWithOptions(nil)
+}
+
+// Like NewDefaultHandler, but allows options to be specified. If opts is nil,
+// the default options are used.
+func NewDefaultHandlerWithOptions(opts *DefaultHandlerOptions) slog.Handler {
+	s := &defaultHandlerState{
+		logger: slog.Default(),
+	}
+	if opts != nil {
+		s.onChange = opts.OnChange
+	}
+	return &defaultHandler{s: s}
+}
+
+// Records that d is the current default logger, and calls the OnChange
+// callback if it has changed.
+func (s *defaultHandlerState) observe(d *slog.Logger) {
+	s.m.Lock()
+	old := s.logger
+	s.logger = d
+	s.m.Unlock()
+
+	if old != d && s.onChange != nil {
+		s.onChange(old.Handler(), d.Handler())
+	}
 }
 
 func (h *defaultHandler) update() slog.Handler {
@@ -572,7 +1326,6 @@ func (h *defaultHandler) update() slog.Handler {
 
 	h.m.RUnlock()
 	h.m.Lock()
-	defer h.m.Unlock()
 
 	var newh slog.Handler
 	if h.parent != nil {
@@ -593,6 +1346,11 @@ func (h *defaultHandler) update() slog.Handler {
 
 	h.h = newh
 	h.expectedLogger = d
+	h.m.Unlock()
+
+	if h.parent == nil {
+		h.s.observe(d)
+	}
 	return newh
 }
 
@@ -606,6 +1364,7 @@ func (h *defaultHandler) Handle(ctx context.Context, record slog.Record) error {
 
 func (h *defaultHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
 	return &defaultHandler{
+		s:      h.s,
 		parent: h,
 		attrs:  attrs,
 	}
@@ -613,7 +1372,13 @@ func (h *defaultHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
 
 func (h *defaultHandler) WithGroup(name string) slog.Handler {
 	return &defaultHandler{
+		s:         h.s,
 		parent:    h,
 		groupName: name,
 	}
 }
+
+// Implements Parent.
+func (h *defaultHandler) Children() []slog.Handler {
+	return []slog.Handler{h.update()}
+}
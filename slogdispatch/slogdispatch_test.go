@@ -0,0 +1,146 @@
+package slogdispatch_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hlandau/slogkit/slogdispatch"
+	"golang.org/x/exp/slog"
+)
+
+type discardHandler struct{}
+
+func (discardHandler) Enabled(ctx context.Context, level slog.Level) bool { return true }
+func (discardHandler) Handle(ctx context.Context, r slog.Record) error    { return nil }
+func (h discardHandler) WithAttrs(attrs []slog.Attr) slog.Handler         { return h }
+func (h discardHandler) WithGroup(name string) slog.Handler               { return h }
+
+// A handler which records the calls to WithAttrs and WithGroup used to derive
+// it, and the derivation of the handler which handled the last record.
+type derivationHandler struct {
+	path []string
+	last *[]string
+}
+
+func (h *derivationHandler) Enabled(ctx context.Context, level slog.Level) bool { return true }
+
+func (h *derivationHandler) Handle(ctx context.Context, r slog.Record) error {
+	*h.last = h.path
+	return nil
+}
+
+func (h *derivationHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	path := append([]string(nil), h.path...)
+	for _, a := range attrs {
+		path = append(path, a.String())
+	}
+	return &derivationHandler{path, h.last}
+}
+
+func (h *derivationHandler) WithGroup(name string) slog.Handler {
+	return &derivationHandler{append(append([]string(nil), h.path...), "group:"+name), h.last}
+}
+
+func TestContextualHandlerDerived(t *testing.T) {
+	var last []string
+	root := slogdispatch.NewContextualHandler(slogdispatch.NewSimpleResolver(&derivationHandler{last: &last}))
+	h1 := root.WithAttrs([]slog.Attr{slog.Int("a", 1)})
+	h2 := h1.WithGroup("g")
+	h3 := h2.WithAttrs([]slog.Attr{slog.Int("b", 2)})
+
+	for _, test := range []struct {
+		h        slog.Handler
+		expected []string
+	}{
+		{root, nil},
+		{h1, []string{"a=1"}},
+		{h2, []string{"a=1", "group:g"}},
+		{h3, []string{"a=1", "group:g", "b=2"}},
+		{h1, []string{"a=1"}},
+	} {
+		if err := test.h.Handle(context.Background(), slog.NewRecord(time.Time{}, slog.LevelInfo, "message", 0)); err != nil {
+			t.Fatalf("cannot handle: %v", err)
+		}
+		if !equalStrings(last, test.expected) {
+			t.Errorf("expected handler derived using %q, got %q", test.expected, last)
+		}
+	}
+}
+
+var benchmarkCaches = []struct {
+	name     string
+	newCache func(slog.Handler) *slogdispatch.HandlerCache
+}{
+	{"Weak", slogdispatch.NewHandlerCache},
+	{"LRU", func(h slog.Handler) *slogdispatch.HandlerCache {
+		return slogdispatch.NewHandlerCacheLRU(h, 0)
+	}},
+}
+
+// Logs from many goroutines at once, each calling pick to choose the handler
+// and context for its i-th record.
+func benchmarkParallel(b *testing.B, pick func(i int) (slog.Handler, context.Context)) {
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		r := slog.NewRecord(time.Time{}, slog.LevelInfo, "message", 0)
+		for i := 0; pb.Next(); i++ {
+			h, ctx := pick(i)
+			if err := h.Handle(ctx, r); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
+
+// Measures resolution of derived contextual handlers under concurrency. Run
+// with e.g. -cpu 1,2,4,8,16 to observe how it scales with the number of cores.
+func BenchmarkContextualHandler(b *testing.B) {
+	for _, c := range benchmarkCaches {
+		c := c
+
+		// A derived handler and a single handler cache shared by every
+		// goroutine.
+		b.Run(c.name+"/Shared", func(b *testing.B) {
+			hc := c.newCache(discardHandler{})
+			h := slogdispatch.NewContextualHandler(slogdispatch.ContextualResolverFunc(
+				func(ctx context.Context, args slogdispatch.ResolveArgs) *slogdispatch.HandlerCache {
+					return hc
+				})).WithAttrs([]slog.Attr{slog.String("a", "b")})
+			benchmarkParallel(b, func(i int) (slog.Handler, context.Context) {
+				return h, context.Background()
+			})
+		})
+
+		// A derived handler shared by every goroutine, with a handler cache
+		// for each of several contexts.
+		b.Run(c.name+"/PerContext", func(b *testing.B) {
+			h := slogdispatch.NewContextualHandler(slogdispatch.NewSimpleResolver(discardHandler{})).
+				WithAttrs([]slog.Attr{slog.String("a", "b")})
+			ctxs := make([]context.Context, 8)
+			for i := range ctxs {
+				ctxs[i] = slogdispatch.WithHandlerCache(context.Background(), c.newCache(discardHandler{}))
+			}
+			benchmarkParallel(b, func(i int) (slog.Handler, context.Context) {
+				return h, ctxs[i%len(ctxs)]
+			})
+		})
+
+		// Many derived handlers sharing a single handler cache.
+		b.Run(c.name+"/ManyDerived", func(b *testing.B) {
+			hc := c.newCache(discardHandler{})
+			root := slogdispatch.NewContextualHandler(slogdispatch.ContextualResolverFunc(
+				func(ctx context.Context, args slogdispatch.ResolveArgs) *slogdispatch.HandlerCache {
+					return hc
+				}))
+			hs := make([]slog.Handler, 64)
+			for i := range hs {
+				hs[i] = root.WithAttrs([]slog.Attr{slog.Int("i", i)})
+			}
+			benchmarkParallel(b, func(i int) (slog.Handler, context.Context) {
+				return hs[i%len(hs)], context.Background()
+			})
+		})
+	}
+}
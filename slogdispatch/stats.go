@@ -0,0 +1,122 @@
+package slogdispatch
+
+import (
+	"context"
+	"expvar"
+	"sync"
+	"sync/atomic"
+
+	"golang.org/x/exp/slog"
+)
+
+// Stats Handler
+
+// A snapshot of the counters of a StatsHandler.
+type Stats struct {
+	// The number of records handled at each level.
+	Levels map[slog.Level]uint64
+
+	// The total number of records handled.
+	Total uint64
+
+	// The number of records for which the wrapped handler returned an error.
+	Errors uint64
+}
+
+// Counters shared between a stats handler and all handlers derived from it.
+type statsState struct {
+	levels sync.Map // slog.Level -> *uint64
+	errors uint64   // atomic
+}
+
+// A slog.Handler which counts the records passed to another handler. See
+// NewStatsHandler.
+type StatsHandler struct {
+	s *statsState
+	h slog.Handler
+}
+
+// Creates a handler which passes records to h and counts them by level. The
+// counts include records handled by handlers derived from the returned
+// handler. Wrap each sink in its own StatsHandler to obtain counts for each
+// sink.
+func NewStatsHandler(h slog.Handler) *StatsHandler {
+	return &StatsHandler{
+		s: &statsState{},
+		h: h,
+	}
+}
+
+var _ slog.Handler = &StatsHandler{}
+
+func (sh *StatsHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return sh.h.Enabled(ctx, level)
+}
+
+func (sh *StatsHandler) Handle(ctx context.Context, record slog.Record) error {
+	p, ok := sh.s.levels.Load(record.Level)
+	if !ok {
+		p, _ = sh.s.levels.LoadOrStore(record.Level, new(uint64))
+	}
+	atomic.AddUint64(p.(*uint64), 1)
+
+	err := sh.h.Handle(ctx, record)
+	if err != nil {
+		atomic.AddUint64(&sh.s.errors, 1)
+	}
+	return err
+}
+
+func (sh *StatsHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &StatsHandler{
+		s: sh.s,
+		h: sh.h.WithAttrs(attrs),
+	}
+}
+
+func (sh *StatsHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return sh
+	}
+
+	return &StatsHandler{
+		s: sh.s,
+		h: sh.h.WithGroup(name),
+	}
+}
+
+// Implements Parent.
+func (sh *StatsHandler) Children() []slog.Handler {
+	return []slog.Handler{sh.h}
+}
+
+// Returns a snapshot of the counters.
+func (sh *StatsHandler) Stats() Stats {
+	st := Stats{
+		Levels: map[slog.Level]uint64{},
+		Errors: atomic.LoadUint64(&sh.s.errors),
+	}
+	sh.s.levels.Range(func(k, v any) bool {
+		n := atomic.LoadUint64(v.(*uint64))
+		st.Levels[k.(slog.Level)] = n
+		st.Total += n
+		return true
+	})
+	return st
+}
+
+// Returns an expvar.Var which reports the counters as a JSON object with a key
+// for each level (e.g. "INFO"), and "total" and "errors" keys. It can be
+// published using expvar.Publish.
+func (sh *StatsHandler) Var() expvar.Var {
+	return expvar.Func(func() any {
+		st := sh.Stats()
+		m := make(map[string]uint64, len(st.Levels)+2)
+		for level, n := range st.Levels {
+			m[level.String()] = n
+		}
+		m["total"] = st.Total
+		m["errors"] = st.Errors
+		return m
+	})
+}
@@ -0,0 +1,117 @@
+package slogdispatch
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"golang.org/x/exp/slog"
+)
+
+// Store Resolver
+
+// A contextual resolver which dispatches to handlers registered under string
+// names, choosing a handler by the name associated with a context using
+// WithHandlerName. This allows handlers to be referred to symbolically, for
+// example by name in a configuration file ("audit", "access", "app").
+//
+// Handlers may be registered and unregistered at any time, including while the
+// resolver is in use.
+type StoreResolver struct {
+	caches       sync.Map // string -> *HandlerCache
+	defaultCache *HandlerCache
+}
+
+var _ ContextualResolver = &StoreResolver{}
+
+// Creates a new StoreResolver with no registered handlers. Contexts which have
+// no handler name, or whose handler name is not registered, are dispatched to
+// defaultHandler. If defaultHandler is nil, Resolve returns nil for such
+// contexts, so that the resolver can be used in a chain (see NewResolverChain).
+func NewStoreResolver(defaultHandler slog.Handler) *StoreResolver {
+	sr := &StoreResolver{}
+	if defaultHandler != nil {
+		sr.defaultCache = NewHandlerCache(defaultHandler)
+	}
+	return sr
+}
+
+// Registers a handler under the given name, replacing any handler previously
+// registered under that name.
+func (sr *StoreResolver) Register(name string, handler slog.Handler) {
+	sr.caches.Store(name, NewHandlerCache(handler))
+}
+
+// Unregisters the handler registered under the given name, if any. Contexts
+// referring to that name are then dispatched to the default handler.
+func (sr *StoreResolver) Unregister(name string) {
+	sr.caches.Delete(name)
+}
+
+// Returns the handler registered under the given name, if any.
+func (sr *StoreResolver) Lookup(name string) (slog.Handler, bool) {
+	hc := sr.lookup(name)
+	if hc == nil {
+		return nil, false
+	}
+	return hc.Handler(), true
+}
+
+func (sr *StoreResolver) lookup(name string) *HandlerCache {
+	v, ok := sr.caches.Load(name)
+	if !ok {
+		return nil
+	}
+	return v.(*HandlerCache)
+}
+
+// Returns the names under which handlers are registered, in sorted order.
+func (sr *StoreResolver) Names() []string {
+	var names []string
+	sr.caches.Range(func(k, v any) bool {
+		names = append(names, k.(string))
+		return true
+	})
+	sort.Strings(names)
+	return names
+}
+
+// Implements ContextualResolver.
+func (sr *StoreResolver) Resolve(ctx context.Context, args ResolveArgs) *HandlerCache {
+	if name, ok := HandlerName(ctx); ok {
+		if hc := sr.lookup(name); hc != nil {
+			return hc
+		}
+	}
+	return sr.defaultCache
+}
+
+// Implements Parent. Returns the registered handlers, in order of name, and
+// the default handler.
+func (sr *StoreResolver) Children() []slog.Handler {
+	var handlers []slog.Handler
+	for _, name := range sr.Names() {
+		if hc := sr.lookup(name); hc != nil {
+			handlers = append(handlers, hc.Handler())
+		}
+	}
+	if sr.defaultCache != nil {
+		handlers = append(handlers, sr.defaultCache.Handler())
+	}
+	return handlers
+}
+
+const nameKey contextKey = "name"
+
+// Creates a context derived from the given context but with the given handler
+// name associated with it, for use with a StoreResolver.
+func WithHandlerName(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, nameKey, name)
+}
+
+// Returns the handler name associated with a context by WithHandlerName, if
+// any.
+func HandlerName(ctx context.Context) (string, bool) {
+	name, ok := ctx.Value(nameKey).(string)
+	return name, ok
+}
@@ -0,0 +1,112 @@
+package slogdispatch
+
+import (
+	"context"
+
+	"golang.org/x/exp/slog"
+)
+
+// Tee Handler
+
+// A branch of a tee handler. See NewTeeHandler.
+type TeeBranch struct {
+	// The handler to dispatch to.
+	Handler slog.Handler
+
+	// An optional function applied to each record before it is passed to
+	// Handler, as for NewTransformHandler. The function only affects this
+	// branch; other branches receive the record unchanged.
+	Transform TransformFunc
+}
+
+type teeHandler struct {
+	branches []TeeBranch
+}
+
+// Creates a slog.Handler which dispatches to each of the given branches, like
+// a multi handler, but applying the transform of each branch (if any) to the
+// record before it is passed to the handler of that branch. For example, a
+// record can be redacted before it is written to a file, and enriched before
+// it is sent over the network.
+//
+// As for NewTransformHandler, transforms only see the attributes of the
+// record itself, not those added to the handler using WithAttrs. Handle
+// returns the first error returned by a branch.
+func NewTeeHandler(branches ...TeeBranch) slog.Handler {
+	return &teeHandler{
+		branches: branches,
+	}
+}
+
+var _ slog.Handler = &teeHandler{}
+
+func (th *teeHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, b := range th.branches {
+		if b.Handler.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (th *teeHandler) Handle(ctx context.Context, record slog.Record) error {
+	var firstErr error
+
+	for _, b := range th.branches {
+		if !b.Handler.Enabled(ctx, record.Level) {
+			continue
+		}
+
+		r := record
+		if b.Transform != nil {
+			var ok bool
+			r, ok = b.Transform(ctx, record)
+			if !ok {
+				continue
+			}
+		}
+
+		err := b.Handler.Handle(ctx, r)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+func (th *teeHandler) specialise(attrs []slog.Attr, groupName string) *teeHandler {
+	handlers := specialiseAll(th.Children(), attrs, groupName)
+
+	branches := make([]TeeBranch, len(th.branches))
+	for i, b := range th.branches {
+		branches[i] = TeeBranch{
+			Handler:   handlers[i],
+			Transform: b.Transform,
+		}
+	}
+	return &teeHandler{
+		branches: branches,
+	}
+}
+
+func (th *teeHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return th.specialise(attrs, "")
+}
+
+func (th *teeHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return th
+	}
+
+	return th.specialise(nil, name)
+}
+
+// Implements Parent. Returns the handlers of the branches.
+func (th *teeHandler) Children() []slog.Handler {
+	handlers := make([]slog.Handler, len(th.branches))
+	for i, b := range th.branches {
+		handlers[i] = b.Handler
+	}
+	return handlers
+}
@@ -0,0 +1,89 @@
+package slogdispatch
+
+import (
+	"context"
+
+	"golang.org/x/exp/slog"
+)
+
+// Transform Handler
+
+// A function which transforms a record before it is handled. It returns the
+// transformed record, and false if the record should be dropped instead. It
+// must not modify the record passed to it other than by using the methods of
+// slog.Record on a copy made using Clone; see NewTransformHandler.
+type TransformFunc func(ctx context.Context, r slog.Record) (slog.Record, bool)
+
+type transformHandler struct {
+	h slog.Handler
+	f TransformFunc
+}
+
+// Creates a slog.Handler which applies f to each record before passing it to
+// h. f can be used to rename keys, drop attributes, add computed attributes or
+// drop the record entirely. Since a slog.Record shares its attributes with
+// the copies made by assignment, f should use Clone before adding attributes
+// to the record it is passed; TransformAttrs can be used to build a new
+// record from the attributes of an existing one.
+//
+// f only sees the attributes of the record itself, not those added to the
+// handler using WithAttrs, which are passed to h unchanged.
+func NewTransformHandler(h slog.Handler, f TransformFunc) slog.Handler {
+	return &transformHandler{
+		h: h,
+		f: f,
+	}
+}
+
+var _ slog.Handler = &transformHandler{}
+
+func (th *transformHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return th.h.Enabled(ctx, level)
+}
+
+func (th *transformHandler) Handle(ctx context.Context, record slog.Record) error {
+	record, ok := th.f(ctx, record)
+	if !ok {
+		return nil
+	}
+
+	return th.h.Handle(ctx, record)
+}
+
+func (th *transformHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &transformHandler{
+		h: th.h.WithAttrs(attrs),
+		f: th.f,
+	}
+}
+
+func (th *transformHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return th
+	}
+
+	return &transformHandler{
+		h: th.h.WithGroup(name),
+		f: th.f,
+	}
+}
+
+// Implements Parent.
+func (th *transformHandler) Children() []slog.Handler {
+	return []slog.Handler{th.h}
+}
+
+// Returns a copy of r whose attributes are the result of applying f to each
+// attribute of r. If f returns false, the attribute is dropped. f can return
+// an attribute with a different key or value. This is a convenience for
+// implementing a TransformFunc.
+func TransformAttrs(r slog.Record, f func(a slog.Attr) (slog.Attr, bool)) slog.Record {
+	r2 := slog.NewRecord(r.Time, r.Level, r.Message, r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		if a, ok := f(a); ok {
+			r2.AddAttrs(a)
+		}
+		return true
+	})
+	return r2
+}
@@ -0,0 +1,181 @@
+package slogdispatch
+
+import (
+	"context"
+	"sync"
+
+	"golang.org/x/exp/slog"
+)
+
+// Trigger Handler
+
+// Options for NewTriggerHandler.
+type TriggerHandlerOptions struct {
+	// Records with a level below this level are buffered. If nil,
+	// slog.LevelInfo is used, so that only debug records are buffered.
+	BufferLevel slog.Leveler
+
+	// Records with a level greater than or equal to this level cause buffered
+	// records to be passed on. If nil, slog.LevelError is used.
+	TriggerLevel slog.Leveler
+}
+
+// The default size of the buffer created by WithTriggerBuffer.
+const defaultTriggerBufferSize = 100
+
+type triggerItem struct {
+	h   slog.Handler
+	ctx context.Context
+	r   slog.Record
+}
+
+// A ring buffer of records, associated with a context.
+type triggerBuffer struct {
+	mu        sync.Mutex
+	items     []triggerItem // ring of at most cap(items) items
+	start     int           // index of the oldest item
+	triggered bool
+}
+
+func (tb *triggerBuffer) add(item triggerItem) {
+	if len(tb.items) < cap(tb.items) {
+		tb.items = append(tb.items, item)
+		return
+	}
+	tb.items[tb.start] = item
+	tb.start = (tb.start + 1) % len(tb.items)
+}
+
+// Returns the buffered items in order and empties the buffer.
+func (tb *triggerBuffer) take() []triggerItem {
+	items := make([]triggerItem, 0, len(tb.items))
+	items = append(items, tb.items[tb.start:]...)
+	items = append(items, tb.items[:tb.start]...)
+	for i := range tb.items {
+		tb.items[i] = triggerItem{}
+	}
+	tb.items = tb.items[:0]
+	tb.start = 0
+	return items
+}
+
+type triggerContextKey struct{}
+
+// Creates a context derived from the given context with a buffer for use by
+// trigger handlers, holding up to size records. If size is not positive, a
+// default of 100 is used. Typically, a new buffer is created for each request
+// handled by a server.
+func WithTriggerBuffer(ctx context.Context, size int) context.Context {
+	if size <= 0 {
+		size = defaultTriggerBufferSize
+	}
+	return context.WithValue(ctx, triggerContextKey{}, &triggerBuffer{
+		items: make([]triggerItem, 0, size),
+	})
+}
+
+func triggerBufferFromContext(ctx context.Context) *triggerBuffer {
+	tb, _ := ctx.Value(triggerContextKey{}).(*triggerBuffer)
+	return tb
+}
+
+type triggerHandler struct {
+	h            slog.Handler
+	bufferLevel  slog.Leveler
+	triggerLevel slog.Leveler
+}
+
+// Creates a slog.Handler which passes records to h, except that records below
+// opts.BufferLevel are held in the buffer associated with the context using
+// WithTriggerBuffer. If a record at or above opts.TriggerLevel is subsequently
+// handled with the same context, the buffered records are passed to h before
+// it, and later records below opts.BufferLevel are passed to h directly.
+// Otherwise, the buffered records are discarded when the buffer becomes full
+// or the context is no longer used. Records below opts.BufferLevel handled with
+// a context without a buffer are discarded.
+//
+// This allows debug records to be logged only for requests which fail. If opts
+// is nil, the default options are used.
+//
+// Buffered records are passed to h without checking whether it is enabled for
+// their level. All trigger handlers using a context share its buffer.
+func NewTriggerHandler(h slog.Handler, opts *TriggerHandlerOptions) slog.Handler {
+	th := &triggerHandler{
+		h:            h,
+		bufferLevel:  slog.LevelInfo,
+		triggerLevel: slog.LevelError,
+	}
+	if opts != nil {
+		if opts.BufferLevel != nil {
+			th.bufferLevel = opts.BufferLevel
+		}
+		if opts.TriggerLevel != nil {
+			th.triggerLevel = opts.TriggerLevel
+		}
+	}
+	return th
+}
+
+var _ slog.Handler = &triggerHandler{}
+
+func (th *triggerHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	if level >= th.bufferLevel.Level() {
+		return th.h.Enabled(ctx, level)
+	}
+	return triggerBufferFromContext(ctx) != nil
+}
+
+func (th *triggerHandler) Handle(ctx context.Context, record slog.Record) error {
+	tb := triggerBufferFromContext(ctx)
+	if tb == nil {
+		if record.Level < th.bufferLevel.Level() {
+			return nil
+		}
+		return th.h.Handle(ctx, record)
+	}
+
+	tb.mu.Lock()
+	if record.Level < th.bufferLevel.Level() && !tb.triggered {
+		tb.add(triggerItem{h: th.h, ctx: ctx, r: record.Clone()})
+		tb.mu.Unlock()
+		return nil
+	}
+
+	var items []triggerItem
+	if record.Level >= th.triggerLevel.Level() {
+		tb.triggered = true
+		items = tb.take()
+	}
+	tb.mu.Unlock()
+
+	for _, item := range items {
+		item.h.Handle(item.ctx, item.r)
+	}
+
+	return th.h.Handle(ctx, record)
+}
+
+func (th *triggerHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &triggerHandler{
+		h:            th.h.WithAttrs(attrs),
+		bufferLevel:  th.bufferLevel,
+		triggerLevel: th.triggerLevel,
+	}
+}
+
+func (th *triggerHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return th
+	}
+
+	return &triggerHandler{
+		h:            th.h.WithGroup(name),
+		bufferLevel:  th.bufferLevel,
+		triggerLevel: th.triggerLevel,
+	}
+}
+
+// Implements Parent.
+func (th *triggerHandler) Children() []slog.Handler {
+	return []slog.Handler{th.h}
+}
@@ -0,0 +1,55 @@
+package slogdispatch_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hlandau/slogkit/slogdispatch"
+	"golang.org/x/exp/slog"
+)
+
+func TestTriggerHandler(t *testing.T) {
+	h := &recordingHandler{level: slog.LevelDebug}
+	th := slogdispatch.NewTriggerHandler(h, nil)
+
+	handle := func(ctx context.Context, level slog.Level, msg string) {
+		t.Helper()
+		if err := th.Handle(ctx, slog.NewRecord(time.Time{}, level, msg, 0)); err != nil {
+			t.Fatalf("cannot handle: %v", err)
+		}
+	}
+
+	// Without a buffer, debug records are discarded.
+	ctx := context.Background()
+	if th.Enabled(ctx, slog.LevelDebug) || !th.Enabled(ctx, slog.LevelInfo) {
+		t.Errorf("unexpected Enabled results without a buffer")
+	}
+	handle(ctx, slog.LevelDebug, "discarded")
+	handle(ctx, slog.LevelInfo, "info")
+
+	// Buffered debug records are passed on, oldest first, when an error is
+	// logged; the oldest is evicted if the buffer is full.
+	ctx1 := slogdispatch.WithTriggerBuffer(ctx, 2)
+	if !th.Enabled(ctx1, slog.LevelDebug) {
+		t.Errorf("expected debug records to be enabled with a buffer")
+	}
+	handle(ctx1, slog.LevelDebug, "evicted")
+	handle(ctx1, slog.LevelDebug, "d1")
+	handle(ctx1, slog.LevelDebug, "d2")
+	handle(ctx1, slog.LevelInfo, "i1")
+
+	// Records buffered with another context are not affected.
+	ctx2 := slogdispatch.WithTriggerBuffer(ctx, 0)
+	handle(ctx2, slog.LevelDebug, "other")
+
+	handle(ctx1, slog.LevelError, "e1")
+
+	// Once triggered, debug records are passed on directly.
+	handle(ctx1, slog.LevelDebug, "d3")
+
+	expected := []string{"info", "i1", "d1", "d2", "e1", "d3"}
+	if got := h.messages(); !equalStrings(got, expected) {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+}
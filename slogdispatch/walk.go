@@ -0,0 +1,149 @@
+package slogdispatch
+
+import (
+	"context"
+	"reflect"
+
+	"golang.org/x/exp/slog"
+)
+
+// Walking Handler Trees
+
+// Implemented by handlers which dispatch to or wrap other handlers.
+type Parent interface {
+	// Returns the handlers dispatched to. Where handlers are derived from
+	// other handlers using WithAttrs or WithGroup, the handlers returned may
+	// be the original handlers rather than the derived ones.
+	Children() []slog.Handler
+}
+
+// Implemented by handlers which buffer records, such as AsyncHandler.
+type Flusher interface {
+	// Blocks until records handled so far have been written.
+	Flush() error
+}
+
+// Implemented by handlers which hold resources which should be released when
+// they are no longer needed, such as AsyncHandler.
+type Closer interface {
+	Close() error
+}
+
+// Implemented by handlers which queue records, such as AsyncHandler, so that
+// they can be shut down gracefully.
+type Drainer interface {
+	// Stops accepting new records, returning an error from Handle instead, and
+	// waits until queued records have been handled or ctx is done. In the
+	// latter case, the remaining records are discarded. Returns the number of
+	// records discarded.
+	Drain(ctx context.Context) (dropped uint64, err error)
+}
+
+// Calls f for h and for each handler reachable from it via Parent, depth
+// first, visiting each handler before the handlers it dispatches to. Handlers
+// reachable by more than one path are visited once, if they are comparable.
+// All handlers are visited even if f returns an error; the first error
+// returned by f is returned.
+func Walk(h slog.Handler, f func(h slog.Handler) error) error {
+	var firstErr error
+	visited := map[slog.Handler]struct{}{}
+
+	var walk func(h slog.Handler)
+	walk = func(h slog.Handler) {
+		if h == nil {
+			return
+		}
+		if reflect.TypeOf(h).Comparable() {
+			if _, ok := visited[h]; ok {
+				return
+			}
+			visited[h] = struct{}{}
+		}
+
+		if err := f(h); err != nil && firstErr == nil {
+			firstErr = err
+		}
+
+		if p, ok := h.(Parent); ok {
+			for _, c := range p.Children() {
+				walk(c)
+			}
+		}
+	}
+	walk(h)
+
+	return firstErr
+}
+
+// Calls Flush on h and each handler reachable from it which implements
+// Flusher, returning the first error. Since handlers are visited before the
+// handlers they dispatch to, records flushed by one handler are flushed by the
+// handlers below it.
+func FlushAll(h slog.Handler) error {
+	return Walk(h, func(h slog.Handler) error {
+		if f, ok := h.(Flusher); ok {
+			return f.Flush()
+		}
+		return nil
+	})
+}
+
+// Calls Close on h and each handler reachable from it which implements Closer,
+// returning the first error. Since handlers are visited before the handlers
+// they dispatch to, records written by one handler when it is closed reach the
+// handlers below it before they are closed.
+func CloseAll(h slog.Handler) error {
+	return Walk(h, func(h slog.Handler) error {
+		if c, ok := h.(Closer); ok {
+			return c.Close()
+		}
+		return nil
+	})
+}
+
+// Prepares h and the handlers reachable from it for shutdown. Each handler
+// which implements Drainer is drained, so that it stops accepting new records
+// and finishes handling the records it has queued, and each other handler
+// which implements Flusher is flushed. Since handlers are visited before the
+// handlers they dispatch to, records drained from one handler reach the
+// handlers below it before they are drained.
+//
+// If ctx is done before all handlers are drained, the records remaining in
+// their queues are discarded, and ctx.Err() is returned. Drain returns the
+// number of records discarded. Handlers are not closed; CloseAll can be used
+// to close them afterwards.
+func Drain(ctx context.Context, h slog.Handler) (dropped uint64, err error) {
+	err = Walk(h, func(h slog.Handler) error {
+		switch h := h.(type) {
+		case Drainer:
+			n, err := h.Drain(ctx)
+			dropped += n
+			return err
+		case Flusher:
+			return flushContext(ctx, h)
+		default:
+			return nil
+		}
+	})
+	return dropped, err
+}
+
+// Calls f.Flush, but returns ctx.Err() if ctx is done first. The flush
+// continues in the background.
+func flushContext(ctx context.Context, f Flusher) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- f.Flush()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,96 @@
+package slogjournal
+
+import (
+	"encoding/binary"
+	"errors"
+	"strings"
+)
+
+// The path of the socket on which journald receives messages using its native
+// protocol.
+const DefaultSocketPath = "/run/systemd/journal/socket"
+
+// Returned by Open on platforms other than Linux.
+var ErrNotSupported = errors.New("the systemd journal is not supported on this platform")
+
+// Returned by Journal.Send if a field name is not valid. See ValidFieldName.
+var ErrInvalidFieldName = errors.New("invalid journal field name")
+
+// Maximum length of a journal field name.
+const maxFieldNameLen = 64
+
+// A journal field. The same field name may occur more than once in a message.
+type Field struct {
+	Name  string
+	Value string
+}
+
+// Returns true iff s is a valid name for a field sent by a client. Such a name
+// consists of at most 64 uppercase letters, digits and underscores, and begins
+// with a letter. (Names beginning with an underscore are reserved for fields
+// added by journald itself.)
+func ValidFieldName(s string) bool {
+	if s == "" || len(s) > maxFieldNameLen || s[0] < 'A' || s[0] > 'Z' {
+		return false
+	}
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		if (c < 'A' || c > 'Z') && (c < '0' || c > '9') && c != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+// Converts a string, such as an attribute key, to a valid field name by
+// converting letters to uppercase and replacing other characters which are
+// not permitted with underscores. Leading underscores are removed, names
+// which would not then begin with a letter are prefixed with "X_", and names
+// are truncated to 64 bytes.
+func fieldName(s string) string {
+	s = strings.TrimLeft(s, "_")
+
+	buf := make([]byte, 0, len(s)+2)
+	if s == "" || s[0] < 'A' || (s[0] > 'Z' && s[0] < 'a') || s[0] > 'z' {
+		buf = append(buf, 'X', '_')
+	}
+	for i := 0; i < len(s) && len(buf) < maxFieldNameLen; i++ {
+		c := s[i]
+		switch {
+		case c >= 'a' && c <= 'z':
+			c -= 'a' - 'A'
+		case (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9'):
+		default:
+			c = '_'
+		}
+		buf = append(buf, c)
+	}
+	return string(buf)
+}
+
+// Encodes fields in the journal native protocol format. Values which contain
+// a newline are length-prefixed; others are sent as NAME=VALUE lines.
+func appendFields(buf []byte, fields []Field) []byte {
+	for _, f := range fields {
+		buf = append(buf, f.Name...)
+		if strings.IndexByte(f.Value, '\n') < 0 {
+			buf = append(buf, '=')
+		} else {
+			buf = append(buf, '\n')
+			buf = binary.LittleEndian.AppendUint64(buf, uint64(len(f.Value)))
+		}
+		buf = append(buf, f.Value...)
+		buf = append(buf, '\n')
+	}
+	return buf
+}
+
+// Validates the names of fields.
+func checkFields(fields []Field) error {
+	for _, f := range fields {
+		if !ValidFieldName(f.Name) {
+			return ErrInvalidFieldName
+		}
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+//go:build linux
+// +build linux
+
+package slogjournal
+
+import (
+	"errors"
+	"net"
+	"os"
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+// A connection to the systemd journal.
+type Journal struct {
+	conn *net.UnixConn
+	addr *net.UnixAddr
+}
+
+// Opens a connection to the journal using the socket at the given path, or at
+// DefaultSocketPath if it is empty. Fails if the socket does not exist, for
+// example because the system is not running systemd.
+func Open(path string) (*Journal, error) {
+	if path == "" {
+		path = DefaultSocketPath
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+
+	// An unconnected socket is used so that messages continue to be delivered
+	// if journald is restarted.
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Journal{
+		conn: conn,
+		addr: &net.UnixAddr{Name: path, Net: "unixgram"},
+	}, nil
+}
+
+// Sends a message consisting of the given fields. Messages too large to be
+// sent as a single datagram are written to a sealed memory file, which is
+// passed to journald instead.
+func (j *Journal) Send(fields []Field) error {
+	if err := checkFields(fields); err != nil {
+		return err
+	}
+
+	b := appendFields(nil, fields)
+	_, _, err := j.conn.WriteMsgUnix(b, nil, j.addr)
+	if errors.Is(err, syscall.EMSGSIZE) || errors.Is(err, syscall.ENOBUFS) {
+		err = j.sendFile(b)
+	}
+	return err
+}
+
+// Closes the connection.
+func (j *Journal) Close() error {
+	return j.conn.Close()
+}
+
+func (j *Journal) sendFile(b []byte) error {
+	f, err := createMemfd()
+	if err != nil {
+		f, err = createShmFile()
+		if err != nil {
+			return err
+		}
+	}
+	defer f.Close()
+
+	if _, err := f.Write(b); err != nil {
+		return err
+	}
+
+	// journald accepts either a sealed memfd or an unlinked regular file; the
+	// seals are not required for the latter, so errors are ignored.
+	fcntl(f.Fd(), fAddSeals, fSealSeal|fSealShrink|fSealGrow|fSealWrite)
+
+	_, _, err = j.conn.WriteMsgUnix(nil, syscall.UnixRights(int(f.Fd())), j.addr)
+	return err
+}
+
+// Constants not provided by package syscall.
+const (
+	mfdCloexec      = 0x1
+	mfdAllowSealing = 0x2
+
+	fAddSeals   = 1033
+	fSealSeal   = 0x1
+	fSealShrink = 0x2
+	fSealGrow   = 0x4
+	fSealWrite  = 0x8
+)
+
+// The memfd_create system call number for each architecture, which package
+// syscall does not provide.
+var memfdCreateTrap = map[string]uintptr{
+	"386":      356,
+	"amd64":    319,
+	"arm":      385,
+	"arm64":    279,
+	"loong64":  279,
+	"mips":     4354,
+	"mipsle":   4354,
+	"mips64":   5314,
+	"mips64le": 5314,
+	"ppc64":    360,
+	"ppc64le":  360,
+	"riscv64":  279,
+	"s390x":    350,
+}[runtime.GOARCH]
+
+func createMemfd() (*os.File, error) {
+	if memfdCreateTrap == 0 {
+		return nil, syscall.ENOSYS
+	}
+
+	name := []byte("slogjournal\x00")
+	fd, _, errno := syscall.Syscall(memfdCreateTrap, uintptr(unsafe.Pointer(&name[0])), mfdCloexec|mfdAllowSealing, 0)
+	if errno != 0 {
+		return nil, errno
+	}
+	return os.NewFile(fd, "memfd:slogjournal"), nil
+}
+
+// Creates an unlinked temporary file in /dev/shm, for kernels without
+// memfd_create.
+func createShmFile() (*os.File, error) {
+	f, err := os.CreateTemp("/dev/shm", "slogjournal-")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Remove(f.Name()); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+func fcntl(fd uintptr, cmd, arg int) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_FCNTL, fd, uintptr(cmd), uintptr(arg))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
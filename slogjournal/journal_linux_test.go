@@ -0,0 +1,86 @@
+//go:build linux
+// +build linux
+
+package slogjournal
+
+import (
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"golang.org/x/exp/slog"
+)
+
+// Receives a message from a fake journald socket, reading it from a passed
+// file descriptor if necessary.
+func receive(t *testing.T, conn *net.UnixConn) string {
+	buf := make([]byte, 64*1024)
+	oob := make([]byte, 64)
+	n, oobn, _, _, err := conn.ReadMsgUnix(buf, oob)
+	if err != nil {
+		t.Fatalf("cannot receive: %v", err)
+	}
+	if oobn == 0 {
+		return string(buf[:n])
+	}
+
+	msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("cannot parse control message: %v", err)
+	}
+	fds, err := syscall.ParseUnixRights(&msgs[0])
+	if err != nil || len(fds) != 1 {
+		t.Fatalf("cannot parse rights: %v", err)
+	}
+
+	f := os.NewFile(uintptr(fds[0]), "passed")
+	defer f.Close()
+	b, err := io.ReadAll(io.NewSectionReader(f, 0, 1<<30))
+	if err != nil {
+		t.Fatalf("cannot read passed file: %v", err)
+	}
+	return string(b)
+}
+
+func TestJournal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "socket")
+	server, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("cannot listen: %v", err)
+	}
+	defer server.Close()
+
+	j, err := Open(path)
+	if err != nil {
+		t.Fatalf("cannot open: %v", err)
+	}
+	defer j.Close()
+
+	log := slog.New(New(j, Config{Identifier: "test"}))
+	log.WithGroup("http").Warn("hello\nworld", "status", 404)
+
+	msg := receive(t, server)
+	for _, s := range []string{"MESSAGE\n\x0b\x00\x00\x00\x00\x00\x00\x00hello\nworld\n", "PRIORITY=4\n", "SYSLOG_IDENTIFIER=test\n", "HTTP_STATUS=404\n"} {
+		if !strings.Contains(msg, s) {
+			t.Errorf("message %q does not contain %q", msg, s)
+		}
+	}
+
+	// A message too large for a datagram is passed as a file.
+	large := strings.Repeat("x", 1024*1024)
+	if err := j.Send([]Field{{"MESSAGE", large}}); err != nil {
+		t.Fatalf("cannot send large message: %v", err)
+	}
+	if msg := receive(t, server); msg != "MESSAGE="+large+"\n" {
+		t.Errorf("unexpected large message of length %d", len(msg))
+	}
+
+	if err := j.Send([]Field{{"_PID", "1"}}); err != ErrInvalidFieldName {
+		t.Errorf("expected ErrInvalidFieldName, got %v", err)
+	}
+
+}
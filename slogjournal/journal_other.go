@@ -0,0 +1,24 @@
+//go:build !linux
+// +build !linux
+
+package slogjournal
+
+// A connection to the systemd journal.
+type Journal struct{}
+
+// Opens a connection to the journal using the socket at the given path, or at
+// DefaultSocketPath if it is empty. Always fails with ErrNotSupported on this
+// platform.
+func Open(path string) (*Journal, error) {
+	return nil, ErrNotSupported
+}
+
+// Sends a message consisting of the given fields.
+func (j *Journal) Send(fields []Field) error {
+	return ErrNotSupported
+}
+
+// Closes the connection.
+func (j *Journal) Close() error {
+	return nil
+}
@@ -0,0 +1,43 @@
+package slogjournal
+
+import (
+	"testing"
+)
+
+var fieldNameTests = []struct {
+	In, Out string
+}{
+	{"MESSAGE", "MESSAGE"},
+	{"status", "STATUS"},
+	{"http_req.id", "HTTP_REQ_ID"},
+	{"_PID", "PID"},
+	{"__a-b", "A_B"},
+	{"1x", "X_1X"},
+	{"", "X_"},
+	{"é", "X___"},
+	{"abcdefghijklmnopqrstuvwxyzabcdefghijklmnopqrstuvwxyzabcdefghijklmnopqrstuvwxyz", "ABCDEFGHIJKLMNOPQRSTUVWXYZABCDEFGHIJKLMNOPQRSTUVWXYZABCDEFGHIJKL"},
+}
+
+func TestFieldName(t *testing.T) {
+	for _, test := range fieldNameTests {
+		got := fieldName(test.In)
+		if got != test.Out {
+			t.Errorf("%q: expected %q, got %q", test.In, test.Out, got)
+		}
+		if test.In != "" && !ValidFieldName(got) {
+			t.Errorf("%q: converted name %q is not valid", test.In, got)
+		}
+	}
+}
+
+func TestAppendFields(t *testing.T) {
+	b := appendFields(nil, []Field{{"MESSAGE", "a\nb"}, {"PRIORITY", "6"}})
+	expected := "MESSAGE\n\x03\x00\x00\x00\x00\x00\x00\x00a\nb\nPRIORITY=6\n"
+	if string(b) != expected {
+		t.Errorf("expected %q, got %q", expected, b)
+	}
+
+	if err := checkFields([]Field{{"_PID", "1"}}); err != ErrInvalidFieldName {
+		t.Errorf("expected ErrInvalidFieldName, got %v", err)
+	}
+}
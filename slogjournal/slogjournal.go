@@ -0,0 +1,159 @@
+// Package slogjournal provides a slog sink for logging to the systemd journal
+// using its native protocol, which preserves the attributes of records as
+// journal fields.
+package slogjournal
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"time"
+
+	"github.com/hlandau/slogkit/slogwriter"
+	"golang.org/x/exp/slog"
+)
+
+// Configuration for the journal logger.
+type Config struct {
+	// Handler options. Note that WriterFunc and RecordWriterFunc are
+	// overridden by this package. ReplaceAttr, if set, is applied to each
+	// attribute.
+	HandlerOptions slogwriter.HandlerOptions
+
+	// The value of the SYSLOG_IDENTIFIER field. If empty, the base name of the
+	// executable is used.
+	Identifier string
+}
+
+// Returns a new slog.Handler which logs to the given journal.
+//
+// The message of each record is sent as the MESSAGE field, and its level is
+// mapped to a syslog severity sent as the PRIORITY field. If AddSource is set,
+// the source location is sent as the CODE_FILE, CODE_LINE and CODE_FUNC
+// fields.
+//
+// Each attribute of a record, and each attribute added to the handler using
+// WithAttrs, is sent as a field whose name is formed by joining the names of
+// any groups containing it and its key with underscores, and converting the
+// result to uppercase; characters which are not permitted in field names are
+// replaced with underscores. For example, the attribute "status" in the group
+// "http" is sent as the field HTTP_STATUS. Time values are formatted as in
+// RFC 3339. Attributes whose field names would collide with a field set by
+// the handler, such as MESSAGE or CODE_LINE, are sent with the prefix ATTR_.
+func New(j *Journal, cfg Config) slog.Handler {
+	if cfg.Identifier == "" {
+		cfg.Identifier = filepath.Base(os.Args[0])
+	}
+
+	cfg.HandlerOptions.NoColor = true
+	cfg.HandlerOptions.WriterFunc = nil
+	cfg.HandlerOptions.RecordWriterFunc = func(ctx context.Context, b []byte, info *slogwriter.RecordInfo) error {
+		fields := []Field{
+			{"MESSAGE", info.Record.Message},
+			{"PRIORITY", strconv.Itoa(mapLevelToPriority(info.Record.Level))},
+			{"SYSLOG_IDENTIFIER", cfg.Identifier},
+		}
+
+		if opts := &cfg.HandlerOptions; opts.AddSource && !opts.OmitSource && info.Record.PC != 0 {
+			fs := runtime.CallersFrames([]uintptr{info.Record.PC})
+			if f, _ := fs.Next(); f.File != "" {
+				fields = append(fields,
+					Field{"CODE_FILE", f.File},
+					Field{"CODE_LINE", strconv.Itoa(f.Line)})
+				if f.Function != "" {
+					fields = append(fields, Field{"CODE_FUNC", f.Function})
+				}
+			}
+		}
+
+		for _, ga := range info.Attrs {
+			for _, a := range ga.Attrs {
+				fields = appendAttrFields(fields, &cfg, ga.Groups, a)
+			}
+		}
+		info.Record.Attrs(func(a slog.Attr) bool {
+			fields = appendAttrFields(fields, &cfg, info.Groups, a)
+			return true
+		})
+
+		return j.Send(fields)
+	}
+	return slogwriter.NewJSONHandler(nil, &cfg.HandlerOptions)
+}
+
+// Appends the fields for an attribute, which is inside the given groups.
+func appendAttrFields(fields []Field, cfg *Config, groups []string, a slog.Attr) []Field {
+	v := a.Value.Resolve()
+	if v.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			groups = append(groups[:len(groups):len(groups)], a.Key)
+		}
+		for _, ga := range v.Group() {
+			fields = appendAttrFields(fields, cfg, groups, ga)
+		}
+		return fields
+	}
+
+	if rep := cfg.HandlerOptions.ReplaceAttr; rep != nil {
+		a = rep(groups, slog.Attr{Key: a.Key, Value: v})
+		if a.Key == "" {
+			return fields
+		}
+		v = a.Value.Resolve()
+	}
+
+	name := a.Key
+	for i := len(groups) - 1; i >= 0; i-- {
+		name = groups[i] + "_" + name
+	}
+
+	value := v.String()
+	if v.Kind() == slog.KindTime {
+		value = v.Time().Format(time.RFC3339Nano)
+	}
+
+	return append(fields, Field{attrFieldName(name), value})
+}
+
+// Fields set by the handler itself, which attributes must not override.
+var reservedFields = map[string]bool{
+	"MESSAGE":           true,
+	"PRIORITY":          true,
+	"SYSLOG_IDENTIFIER": true,
+	"CODE_FILE":         true,
+	"CODE_LINE":         true,
+	"CODE_FUNC":         true,
+}
+
+// Converts the name of an attribute to a field name which does not collide
+// with a field set by the handler.
+func attrFieldName(name string) string {
+	s := fieldName(name)
+	if reservedFields[s] {
+		s = "ATTR_" + s
+	}
+	return s
+}
+
+func mapLevelToPriority(level slog.Level) int {
+	switch {
+	case level <= slog.LevelDebug:
+		return 7 // debug
+	case level <= slog.LevelInfo:
+		return 6 // info
+	case level <= 2:
+		return 5 // notice
+	case level <= slog.LevelWarn:
+		return 4 // warning
+	case level <= slog.LevelError:
+		return 3 // err
+	case level <= 12:
+		return 2 // crit
+	case level <= 16:
+		return 1 // alert
+	default:
+		return 0 // emerg
+	}
+}
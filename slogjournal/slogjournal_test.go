@@ -0,0 +1,42 @@
+package slogjournal
+
+import (
+	"testing"
+
+	"golang.org/x/exp/slog"
+)
+
+func TestAppendAttrFields(t *testing.T) {
+	var cfg Config
+	var fields []Field
+	for _, a := range []slog.Attr{
+		slog.String("msg", "a"),
+		slog.String("message", "b"),
+		slog.Int("priority", 1),
+		slog.String("_SYSLOG_IDENTIFIER", "c"),
+		slog.Group("code", slog.String("file", "d"), slog.Int("line", 2)),
+		slog.String("code_func", "e"),
+		slog.String("user", "f"),
+	} {
+		fields = appendAttrFields(fields, &cfg, nil, a)
+	}
+
+	expected := []Field{
+		{"MSG", "a"},
+		{"ATTR_MESSAGE", "b"},
+		{"ATTR_PRIORITY", "1"},
+		{"ATTR_SYSLOG_IDENTIFIER", "c"},
+		{"ATTR_CODE_FILE", "d"},
+		{"ATTR_CODE_LINE", "2"},
+		{"ATTR_CODE_FUNC", "e"},
+		{"USER", "f"},
+	}
+	if len(fields) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, fields)
+	}
+	for i := range expected {
+		if fields[i] != expected[i] {
+			t.Errorf("field %d: expected %v, got %v", i, expected[i], fields[i])
+		}
+	}
+}
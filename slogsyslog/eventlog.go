@@ -0,0 +1,157 @@
+package slogsyslog
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/hlandau/slogkit/slogsyslog/syslog"
+	"github.com/hlandau/slogkit/slogwriter"
+	"golang.org/x/exp/slog"
+)
+
+// Returned by OpenEventLog and InstallEventSource on platforms other than
+// Windows.
+var ErrEventLogNotSupported = errors.New("the Windows Event Log is not supported on this platform")
+
+// Windows event types.
+const (
+	eventTypeError       = 0x1
+	eventTypeWarning     = 0x2
+	eventTypeInformation = 0x4
+)
+
+// The event ID used for all events. Sources installed by InstallEventSource
+// use EventCreate.exe as their message file, in which the messages for IDs 1
+// to 1000 consist of the first insertion string alone.
+const eventID = 1
+
+// Maximum length of an insertion string, in UTF-16 code units.
+const maxEventStringLen = 31839
+
+// Maps a syslog severity to a Windows event type.
+func mapSeverityToEventType(sev syslog.Severity) uint16 {
+	switch {
+	case sev <= syslog.SeverityErr:
+		return eventTypeError
+	case sev == syslog.SeverityWarning:
+		return eventTypeWarning
+	default:
+		return eventTypeInformation
+	}
+}
+
+// Returns a new slog.Handler which logs to the given Windows Event Log
+// source.
+//
+// The level of each record is mapped to an event type: levels of LevelError
+// and above become errors, levels of LevelWarn and above become warnings, and
+// other levels become information events. The reserved attribute SeverityKey
+// can override this; FacilityKey is ignored. The description of each event
+// consists of the message of the record, followed by the attributes of the
+// record and those added to the handler using WithAttrs, one per line, in the
+// form "key=value". The keys of attributes in groups are prefixed with the
+// names of the groups, separated by dots. ReplaceAttr, if set, is applied to
+// each attribute.
+//
+// Config fields relating only to syslog, such as Facility and StructuredData,
+// are ignored.
+func NewEventLogHandler(e *EventLog, cfg Config) slog.Handler {
+	cfg.HandlerOptions.NoColor = true
+	cfg.HandlerOptions.WriterFunc = nil
+	cfg.HandlerOptions.RecordWriterFunc = func(ctx context.Context, b []byte, info *slogwriter.RecordInfo) error {
+		sev := mapLevelToSeverity(info.Record.Level)
+		if f := recordFields(ctx); f.hasSeverity {
+			sev = f.severity
+		}
+
+		return e.report(mapSeverityToEventType(sev), formatDescription(&cfg, info))
+	}
+	return &fieldsHandler{
+		h:          slogwriter.NewJSONHandler(nil, &cfg.HandlerOptions),
+		keepMsgIDs: true,
+	}
+}
+
+// Returns a new slog.Handler which logs to the system log, together with a
+// Closer which closes the underlying connection. On Windows, this is the
+// Windows Event Log (see NewEventLogHandler), using cfg.EventSource as the
+// event source. On other platforms, it is the local syslog daemon (see New).
+func NewSystem(cfg Config) (slog.Handler, io.Closer, error) {
+	if runtime.GOOS == "windows" {
+		source := cfg.EventSource
+		if source == "" {
+			source = strings.TrimSuffix(filepath.Base(os.Args[0]), ".exe")
+		}
+
+		e, err := OpenEventLog(source)
+		if err != nil {
+			return nil, nil, err
+		}
+		return NewEventLogHandler(e, cfg), e, nil
+	}
+
+	l, err := syslog.New(syslog.Config{})
+	if err != nil {
+		return nil, nil, err
+	}
+	return New(l, cfg), l, nil
+}
+
+// Generates the description of an event.
+func formatDescription(cfg *Config, info *slogwriter.RecordInfo) string {
+	var sb strings.Builder
+	sb.WriteString(info.Record.Message)
+
+	for _, ga := range info.Attrs {
+		for _, a := range ga.Attrs {
+			appendDescriptionAttr(&sb, cfg, ga.Groups, a)
+		}
+	}
+	info.Record.Attrs(func(a slog.Attr) bool {
+		appendDescriptionAttr(&sb, cfg, info.Groups, a)
+		return true
+	})
+
+	return sb.String()
+}
+
+// Appends an attribute, which is inside the given groups, to a description.
+func appendDescriptionAttr(sb *strings.Builder, cfg *Config, groups []string, a slog.Attr) {
+	v := a.Value.Resolve()
+	if v.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			groups = append(groups[:len(groups):len(groups)], a.Key)
+		}
+		for _, ga := range v.Group() {
+			appendDescriptionAttr(sb, cfg, groups, ga)
+		}
+		return
+	}
+
+	if rep := cfg.HandlerOptions.ReplaceAttr; rep != nil {
+		a = rep(groups, slog.Attr{Key: a.Key, Value: v})
+		if a.Key == "" {
+			return
+		}
+		v = a.Value.Resolve()
+	}
+
+	sb.WriteString("\r\n")
+	for _, g := range groups {
+		sb.WriteString(g)
+		sb.WriteByte('.')
+	}
+	sb.WriteString(a.Key)
+	sb.WriteByte('=')
+	if v.Kind() == slog.KindTime {
+		sb.WriteString(v.Time().Format(time.RFC3339Nano))
+	} else {
+		sb.WriteString(v.String())
+	}
+}
@@ -0,0 +1,28 @@
+//go:build !windows
+// +build !windows
+
+package slogsyslog
+
+// A Windows Event Log event source.
+type EventLog struct{}
+
+// Opens the event source with the given name. Always fails with
+// ErrEventLogNotSupported on this platform.
+func OpenEventLog(source string) (*EventLog, error) {
+	return nil, ErrEventLogNotSupported
+}
+
+// Registers an event source with the given name in the Application log.
+// Always fails with ErrEventLogNotSupported on this platform.
+func InstallEventSource(source string) error {
+	return ErrEventLogNotSupported
+}
+
+// Closes the event source.
+func (e *EventLog) Close() error {
+	return nil
+}
+
+func (e *EventLog) report(eventType uint16, description string) error {
+	return ErrEventLogNotSupported
+}
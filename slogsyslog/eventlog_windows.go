@@ -0,0 +1,135 @@
+//go:build windows
+// +build windows
+
+package slogsyslog
+
+import (
+	"syscall"
+	"unicode/utf16"
+	"unsafe"
+)
+
+var (
+	advapi32                  = syscall.NewLazyDLL("advapi32.dll")
+	procRegisterEventSourceW  = advapi32.NewProc("RegisterEventSourceW")
+	procDeregisterEventSource = advapi32.NewProc("DeregisterEventSource")
+	procReportEventW          = advapi32.NewProc("ReportEventW")
+	procRegCreateKeyExW       = advapi32.NewProc("RegCreateKeyExW")
+	procRegSetValueExW        = advapi32.NewProc("RegSetValueExW")
+)
+
+// A Windows Event Log event source.
+type EventLog struct {
+	handle syscall.Handle
+}
+
+// Opens the event source with the given name. The source should have been
+// registered, for example by InstallEventSource when the application is
+// installed; otherwise, Event Viewer cannot display the descriptions of its
+// events properly.
+func OpenEventLog(source string) (*EventLog, error) {
+	p, err := syscall.UTF16PtrFromString(source)
+	if err != nil {
+		return nil, err
+	}
+
+	h, _, err := procRegisterEventSourceW.Call(0, uintptr(unsafe.Pointer(p)))
+	if h == 0 {
+		return nil, err
+	}
+	return &EventLog{handle: syscall.Handle(h)}, nil
+}
+
+// Closes the event source.
+func (e *EventLog) Close() error {
+	r, _, err := procDeregisterEventSource.Call(uintptr(e.handle))
+	if r == 0 {
+		return err
+	}
+	return nil
+}
+
+func (e *EventLog) report(eventType uint16, description string) error {
+	s := utf16.Encode([]rune(description))
+	if len(s) > maxEventStringLen {
+		s = s[:maxEventStringLen]
+	}
+	s = append(s, 0)
+
+	strs := []*uint16{&s[0]}
+	r, _, err := procReportEventW.Call(
+		uintptr(e.handle),
+		uintptr(eventType),
+		0, // category
+		eventID,
+		0, // user SID
+		uintptr(len(strs)),
+		0, // raw data size
+		uintptr(unsafe.Pointer(&strs[0])),
+		0) // raw data
+	if r == 0 {
+		return err
+	}
+	return nil
+}
+
+// Registers an event source with the given name in the Application log, using
+// EventCreate.exe as its message file. This requires administrative
+// privileges, so is usually done when an application is installed. It
+// succeeds if the source is already registered.
+func InstallEventSource(source string) error {
+	const keyPrefix = `SYSTEM\CurrentControlSet\Services\EventLog\Application\`
+
+	name, err := syscall.UTF16PtrFromString(keyPrefix + source)
+	if err != nil {
+		return err
+	}
+
+	var key syscall.Handle
+	r, _, _ := procRegCreateKeyExW.Call(
+		uintptr(syscall.HKEY_LOCAL_MACHINE),
+		uintptr(unsafe.Pointer(name)),
+		0, 0, 0,
+		syscall.KEY_SET_VALUE,
+		0,
+		uintptr(unsafe.Pointer(&key)),
+		0)
+	if r != 0 {
+		return syscall.Errno(r)
+	}
+	defer syscall.RegCloseKey(key)
+
+	if err := setRegistryString(key, "EventMessageFile", `%SystemRoot%\System32\EventCreate.exe`); err != nil {
+		return err
+	}
+
+	types := uint32(eventTypeError | eventTypeWarning | eventTypeInformation)
+	return setRegistryValue(key, "TypesSupported", syscall.REG_DWORD, (*byte)(unsafe.Pointer(&types)), 4)
+}
+
+func setRegistryString(key syscall.Handle, name, value string) error {
+	s, err := syscall.UTF16FromString(value)
+	if err != nil {
+		return err
+	}
+	return setRegistryValue(key, name, syscall.REG_EXPAND_SZ, (*byte)(unsafe.Pointer(&s[0])), uint32(len(s)*2))
+}
+
+func setRegistryValue(key syscall.Handle, name string, valueType uint32, data *byte, size uint32) error {
+	p, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return err
+	}
+
+	r, _, _ := procRegSetValueExW.Call(
+		uintptr(key),
+		uintptr(unsafe.Pointer(p)),
+		0,
+		uintptr(valueType),
+		uintptr(unsafe.Pointer(data)),
+		uintptr(size))
+	if r != 0 {
+		return syscall.Errno(r)
+	}
+	return nil
+}
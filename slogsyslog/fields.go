@@ -0,0 +1,202 @@
+package slogsyslog
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/hlandau/slogkit/slogsyslog/syslog"
+	"golang.org/x/exp/slog"
+)
+
+// Reserved attribute keys. If an attribute with one of these keys is present
+// on a record, or has been added to the handler using WithAttrs, outside of
+// any group, it overrides the configured facility or the severity derived
+// from the level of the record, and is not otherwise output. For example:
+//
+//	logger.Info("LOGIN_FAILED", slogsyslog.FacilityKey, "auth", "user", user)
+//
+// The value may be a syslog.Facility or syslog.Severity, an integer, or a
+// name accepted by syslog.ParseFacility or syslog.ParseSeverity. Invalid
+// values are ignored.
+const (
+	FacilityKey = "syslog.facility"
+	SeverityKey = "syslog.severity"
+)
+
+// Maximum length of a MSGID (RFC 5424 §6.2.7).
+const maxMsgIDLen = 32
+
+// Returns true iff the message of a record is a message code, as used by
+// slogtree known log message types (for example "HTTP_REQ_START"), rather than
+// a freeform phrase. Such a message consists of an uppercase letter followed
+// by uppercase letters, digits and underscores, and must be short enough to
+// be a valid MSGID.
+func isMessageCode(msg string) bool {
+	if msg == "" || len(msg) > maxMsgIDLen || msg[0] < 'A' || msg[0] > 'Z' {
+		return false
+	}
+	for i := 1; i < len(msg); i++ {
+		c := msg[i]
+		if (c < 'A' || c > 'Z') && (c < '0' || c > '9') && c != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+// Fields of a syslog message determined from a record other than by
+// formatting it.
+type fields struct {
+	msgID string
+
+	facility    syslog.Facility
+	hasFacility bool
+
+	severity    syslog.Severity
+	hasSeverity bool
+}
+
+// Applies a reserved attribute, returning false if it is not one.
+func (f *fields) apply(a slog.Attr) bool {
+	switch a.Key {
+	case FacilityKey:
+		if n, ok := parseFieldValue(a.Value, 23, func(s string) (int, error) {
+			fac, err := syslog.ParseFacility(s)
+			return int(fac), err
+		}); ok {
+			f.facility, f.hasFacility = syslog.Facility(n), true
+		}
+	case SeverityKey:
+		if n, ok := parseFieldValue(a.Value, 7, func(s string) (int, error) {
+			sev, err := syslog.ParseSeverity(s)
+			return int(sev), err
+		}); ok {
+			f.severity, f.hasSeverity = syslog.Severity(n), true
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+// Parses the value of a reserved attribute, which must lie in [0, max].
+func parseFieldValue(v slog.Value, max int64, parse func(s string) (int, error)) (int, bool) {
+	v = v.Resolve()
+
+	var n int64
+	switch v.Kind() {
+	case slog.KindInt64:
+		n = v.Int64()
+	case slog.KindUint64:
+		if v.Uint64() > uint64(max) {
+			return 0, false
+		}
+		n = int64(v.Uint64())
+	case slog.KindString:
+		if i, err := strconv.ParseInt(v.String(), 10, 64); err == nil {
+			n = i
+		} else if p, err := parse(v.String()); err == nil {
+			n = int64(p)
+		} else {
+			return 0, false
+		}
+	case slog.KindAny:
+		switch x := v.Any().(type) {
+		case syslog.Facility:
+			n = int64(x)
+		case syslog.Severity:
+			n = int64(x)
+		default:
+			return 0, false
+		}
+	default:
+		return 0, false
+	}
+
+	if n < 0 || n > max {
+		return 0, false
+	}
+	return int(n), true
+}
+
+type fieldsKey struct{}
+
+// A handler which determines the fields of a record before passing it to the
+// JSON handler, passing them to the RecordWriterFunc via the context. Message
+// codes, unless keepMsgIDs is set, and reserved attributes are removed from
+// the record, so that they are not repeated in the message body.
+type fieldsHandler struct {
+	h          slog.Handler
+	fields     fields // from reserved attributes added using WithAttrs
+	grouped    bool   // whether a group has been opened
+	keepMsgIDs bool   // whether to leave message codes in the record
+}
+
+func (fh *fieldsHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return fh.h.Enabled(ctx, level)
+}
+
+func (fh *fieldsHandler) Handle(ctx context.Context, r slog.Record) error {
+	f := fh.fields
+	if !fh.keepMsgIDs && isMessageCode(r.Message) {
+		f.msgID = r.Message
+		r.Message = ""
+	}
+
+	if !fh.grouped {
+		reserved := false
+		r.Attrs(func(a slog.Attr) bool {
+			reserved = a.Key == FacilityKey || a.Key == SeverityKey
+			return !reserved
+		})
+
+		if reserved {
+			nr := slog.NewRecord(r.Time, r.Level, r.Message, r.PC)
+			r.Attrs(func(a slog.Attr) bool {
+				if !f.apply(a) {
+					nr.AddAttrs(a)
+				}
+				return true
+			})
+			r = nr
+		}
+	}
+
+	return fh.h.Handle(context.WithValue(ctx, fieldsKey{}, &f), r)
+}
+
+func (fh *fieldsHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	nfh := *fh
+	if !fh.grouped {
+		var rest []slog.Attr
+		for _, a := range attrs {
+			if !nfh.fields.apply(a) {
+				rest = append(rest, a)
+			}
+		}
+		attrs = rest
+	}
+
+	nfh.h = fh.h.WithAttrs(attrs)
+	return &nfh
+}
+
+func (fh *fieldsHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return fh
+	}
+
+	nfh := *fh
+	nfh.h = fh.h.WithGroup(name)
+	nfh.grouped = true
+	return &nfh
+}
+
+// Returns the fields determined by fieldsHandler.
+func recordFields(ctx context.Context) *fields {
+	f, _ := ctx.Value(fieldsKey{}).(*fields)
+	if f == nil {
+		f = &fields{}
+	}
+	return f
+}
@@ -0,0 +1,160 @@
+package slogsyslog
+
+import (
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hlandau/slogkit/slogsyslog/syslog"
+	"github.com/hlandau/slogkit/slogwriter"
+	"golang.org/x/exp/slog"
+)
+
+// The SD-ID used by default for attributes which are not in a group.
+const DefaultSDID = "slog"
+
+// The private enterprise number used by default in SD-IDs. This is the number
+// reserved for documentation by RFC 5612; applications should register and
+// use their own.
+const DefaultEnterpriseNumber = 32473
+
+// Maximum length of an SD-NAME (RFC 5424 §6.3).
+const maxSDNameLen = 32
+
+// Builds SYSLOGv1 structured data from the attributes of a record.
+type sdBuilder struct {
+	cfg    *Config
+	suffix string // "@" followed by the enterprise number
+	sd     syslog.StructuredData
+}
+
+func newSDBuilder(cfg *Config) *sdBuilder {
+	pen := cfg.EnterpriseNumber
+	if pen == 0 {
+		pen = DefaultEnterpriseNumber
+	}
+	return &sdBuilder{
+		cfg:    cfg,
+		suffix: "@" + strconv.Itoa(pen),
+	}
+}
+
+// Adds an attribute, which is inside the given groups. Attributes which are
+// not in a group are added to the element with the configured SD-ID. Other
+// attributes are added to an element whose SD-ID is the name of their
+// outermost group, with a parameter name consisting of the names of any
+// further groups and the key, separated by dots.
+func (b *sdBuilder) add(groups []string, a slog.Attr) {
+	v := a.Value.Resolve()
+	if v.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			groups = append(groups[:len(groups):len(groups)], a.Key)
+		}
+		for _, ga := range v.Group() {
+			b.add(groups, ga)
+		}
+		return
+	}
+
+	if rep := b.cfg.HandlerOptions.ReplaceAttr; rep != nil {
+		a = rep(groups, slog.Attr{Key: a.Key, Value: v})
+		if a.Key == "" {
+			return
+		}
+		v = a.Value.Resolve()
+	}
+
+	if len(groups) == 0 {
+		b.addParam(b.defaultID(), a.Key, sdValue(v))
+	} else {
+		b.addParam(groups[0], strings.Join(append(groups[1:len(groups):len(groups)], a.Key), "."), sdValue(v))
+	}
+}
+
+// Returns the name part of the SD-ID for attributes which are not in a group.
+func (b *sdBuilder) defaultID() string {
+	if b.cfg.SDID != "" {
+		return b.cfg.SDID
+	}
+	return DefaultSDID
+}
+
+// Adds a parameter to the element with the given SD-ID name part.
+func (b *sdBuilder) addParam(id, name, value string) {
+	// Both names are valid after conversion by sdName, so neither call can
+	// fail.
+	e, err := b.sd.Element(sdName(id, maxSDNameLen-len(b.suffix)) + b.suffix)
+	if err != nil {
+		return
+	}
+	e.AddParam(sdName(name, maxSDNameLen), value)
+}
+
+// Adds the source location of a record to the element for attributes which
+// are not in a group, as the parameters "source.file", "source.line" and
+// "source.function".
+func (b *sdBuilder) addSource(pc uintptr) {
+	fs := runtime.CallersFrames([]uintptr{pc})
+	f, _ := fs.Next()
+	if f.File == "" {
+		return
+	}
+
+	id := b.defaultID()
+	b.addParam(id, slog.SourceKey+".file", f.File)
+	b.addParam(id, slog.SourceKey+".line", strconv.Itoa(f.Line))
+	if f.Function != "" {
+		b.addParam(id, slog.SourceKey+".function", f.Function)
+	}
+}
+
+// Formats an attribute value as an SD-PARAM value. Times are formatted as in
+// RFC 3339, as in SYSLOGv1 timestamps; other values are formatted as by
+// slog.Value.String.
+func sdValue(v slog.Value) string {
+	if v.Kind() == slog.KindTime {
+		return v.Time().Format(time.RFC3339Nano)
+	}
+	return v.String()
+}
+
+// Generates structured data from the attributes added to a handler and the
+// attributes of a record, preceded by the source location of the record if
+// AddSource is set.
+func formatStructuredData(cfg *Config, info *slogwriter.RecordInfo) string {
+	b := newSDBuilder(cfg)
+	if opts := &cfg.HandlerOptions; opts.AddSource && !opts.OmitSource && info.Record.PC != 0 {
+		b.addSource(info.Record.PC)
+	}
+	for _, ga := range info.Attrs {
+		for _, a := range ga.Attrs {
+			b.add(ga.Groups, a)
+		}
+	}
+	info.Record.Attrs(func(a slog.Attr) bool {
+		b.add(info.Groups, a)
+		return true
+	})
+	return b.sd.String()
+}
+
+// Converts a string to a valid SD-NAME by replacing characters which are not
+// permitted, and '@', which has a special meaning in SD-IDs, with underscores,
+// and truncating it to maxLen bytes. An empty string becomes "_".
+func sdName(s string, maxLen int) string {
+	if s == "" {
+		return "_"
+	}
+
+	buf := []byte(s)
+	if len(buf) > maxLen {
+		buf = buf[:maxLen]
+	}
+	for i, c := range buf {
+		if c <= ' ' || c >= 0x7F || c == '=' || c == ']' || c == '"' || c == '@' {
+			buf[i] = '_'
+		}
+	}
+	return string(buf)
+}
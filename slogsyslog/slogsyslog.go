@@ -1,4 +1,5 @@
-// Package slogsyslog provides a slog sink for logging to syslog.
+// Package slogsyslog provides a slog sink for logging to syslog, or on
+// Windows, to the Windows Event Log (see NewEventLogHandler and NewSystem).
 package slogsyslog
 
 import (
@@ -16,26 +17,106 @@ type syslogHandler struct {
 
 // Configuration for the syslog logger.
 type Config struct {
-	// Handler options. Note that WriterFunc is overridden by this package.
+	// Handler options. Note that WriterFunc and RecordWriterFunc are
+	// overridden by this package.
 	HandlerOptions slogwriter.HandlerOptions
 
 	// Facility to log to.
 	Facility syslog.Facility
+
+	// If set, the attributes of each record, and those added to the handler
+	// using WithAttrs, are sent as SYSLOGv1 structured data rather than being
+	// encoded as JSON in the message body. The message body then contains only
+	// the message of the record, unless it is a message code (see New).
+	//
+	// Attributes which are not in a group are placed in an SD-ELEMENT whose
+	// SD-ID is SDID. Attributes in a group are placed in an SD-ELEMENT whose
+	// SD-ID is the name of the outermost group, with a parameter name formed
+	// by joining the names of any further groups and the key with dots. Names
+	// are altered as necessary to be valid SD-NAMEs. ReplaceAttr, if set, is
+	// applied to each attribute. Time values are formatted as in RFC 3339.
+	//
+	// If AddSource is set, the source location of the record is placed in the
+	// SD-ELEMENT for attributes which are not in a group, as the parameters
+	// "source.file", "source.line" and "source.function".
+	//
+	// This produces messages which receivers that understand structured data,
+	// such as rsyslog with mmpstrucdata, can parse without any knowledge of
+	// the body format.
+	//
+	// Structured data is only supported by SYSLOGv1 and GELF (see
+	// syslog.Protocol), and is discarded when other protocols are used. With
+	// GELF, each parameter is sent as an additional field.
+	StructuredData bool
+
+	// The name part of the SD-ID used for attributes which are not in a group
+	// if StructuredData is set. If empty, DefaultSDID is used.
+	SDID string
+
+	// The private enterprise number appended to SD-IDs if StructuredData is
+	// set. If zero, DefaultEnterpriseNumber is used.
+	EnterpriseNumber int
+
+	// If set, the JSON message body is prefixed with the CEE cookie "@cee: ",
+	// so that receivers following the Lumberjack conventions, such as rsyslog
+	// with mmjsonparse, parse the attributes of each record as structured
+	// fields. Message codes are then left in the JSON body rather than being
+	// sent as the MSGID, since SYSLOGv0 protocols would otherwise place the
+	// MSGID before the cookie. Ignored if StructuredData is set.
+	CEE bool
+
+	// The name of the Windows Event Log source used by NewSystem on Windows.
+	// If empty, the base name of the executable is used.
+	EventSource string
 }
 
+// The cookie prefixed to message bodies if Config.CEE is set.
+const ceeCookie = "@cee: "
+
 // Returns a new slog.Handler which logs to the given syslog.Logger.
+//
+// If the message of a record is a message code, such as the message type
+// identifier of a slogtree known log message type (for example
+// "HTTP_REQ_START"), it is sent as the SYSLOGv1 MSGID and omitted from the
+// message body, so that collectors can filter on it. A message code consists
+// of at most 32 uppercase letters, digits and underscores, beginning with a
+// letter. Other messages, and message codes if Config.CEE is set, are included
+// in the message body.
+//
+// The facility and severity of individual messages can be overridden using
+// the reserved attributes FacilityKey and SeverityKey.
 func New(l *syslog.Logger, cfg Config) slog.Handler {
 	cfg.HandlerOptions.NoColor = true
-	cfg.HandlerOptions.WriterFunc = func(ctx context.Context, b []byte, r slog.Record) error {
-		return l.Write(ctx, syslog.Message{
-			Time:     r.Time,
-			Severity: mapLevelToSeverity(r.Level),
+	cfg.HandlerOptions.OmitMessageKey = true
+	cfg.HandlerOptions.WriterFunc = nil
+	cfg.HandlerOptions.RecordWriterFunc = func(ctx context.Context, b []byte, info *slogwriter.RecordInfo) error {
+		f := recordFields(ctx)
+		msg := syslog.Message{
+			Time:     info.Record.Time,
+			Severity: mapLevelToSeverity(info.Record.Level),
 			Facility: cfg.Facility,
-			ID:       r.Message,
-			Body:     string(b),
-		})
+			ID:       f.msgID,
+		}
+		if f.hasFacility {
+			msg.Facility = f.facility
+		}
+		if f.hasSeverity {
+			msg.Severity = f.severity
+		}
+		if cfg.StructuredData {
+			msg.StructuredData = formatStructuredData(&cfg, info)
+			msg.Body = info.Record.Message
+		} else if cfg.CEE {
+			msg.Body = ceeCookie + string(b)
+		} else {
+			msg.Body = string(b)
+		}
+		return l.Write(ctx, msg)
+	}
+	return &fieldsHandler{
+		h:          slogwriter.NewJSONHandler(nil, &cfg.HandlerOptions),
+		keepMsgIDs: cfg.CEE && !cfg.StructuredData,
 	}
-	return slogwriter.NewJSONHandler(nil, &cfg.HandlerOptions)
 }
 
 func mapLevelToSeverity(level slog.Level) syslog.Severity {
@@ -0,0 +1,135 @@
+package syslog
+
+import (
+	crand "crypto/rand"
+	"encoding/binary"
+	"math/rand"
+	"time"
+)
+
+// Determines how long a Logger waits before attempting to reconnect after a
+// connection attempt fails. See Config.ConnectBackoff.
+//
+// The methods are called with the logger's internal lock held, so an
+// implementation need not be safe for concurrent use unless it is shared
+// between loggers.
+type Backoff interface {
+	// Returns the time to wait before the next connection attempt. Called
+	// each time an attempt fails.
+	NextDelay() time.Duration
+
+	// Called whenever a message is written successfully, so that the next
+	// failure starts a new sequence of delays.
+	Reset()
+}
+
+// Defaults for ExponentialBackoff.
+const (
+	DefaultInitialDelay = 5 * time.Second
+	DefaultMaxDelay     = 2 * time.Minute
+	DefaultMultiplier   = 2
+)
+
+// The jitter used by the default Backoff. See Config.ConnectBackoff.
+const DefaultJitter = 0.2
+
+// A Backoff whose delay grows exponentially, up to a maximum, with optional
+// random jitter. The zero value is usable, and uses the default delays with no
+// jitter.
+type ExponentialBackoff struct {
+	// The delay after the first failure. Defaults to DefaultInitialDelay.
+	InitialDelay time.Duration
+
+	// The maximum delay. Defaults to DefaultMaxDelay.
+	MaxDelay time.Duration
+
+	// The factor by which the delay grows after each further failure. Must be
+	// at least 1. Defaults to DefaultMultiplier.
+	Multiplier float64
+
+	// If this is non-zero, each delay is varied randomly by up to this
+	// fraction of it in either direction, so that many loggers which lose
+	// their connections at the same time, for example because a collector was
+	// restarted, do not all reconnect at the same time. Must be in [0, 1].
+	Jitter float64
+
+	delay time.Duration // the delay before jitter, or zero after a reset
+	rng   *rand.Rand
+}
+
+// Implements Backoff.
+func (b *ExponentialBackoff) NextDelay() time.Duration {
+	maxDelay := b.MaxDelay
+	if maxDelay <= 0 {
+		maxDelay = DefaultMaxDelay
+	}
+
+	if b.delay == 0 {
+		b.delay = b.InitialDelay
+		if b.delay <= 0 {
+			b.delay = DefaultInitialDelay
+		}
+	} else {
+		m := b.Multiplier
+		if m < 1 {
+			m = DefaultMultiplier
+		}
+		b.delay = time.Duration(float64(b.delay) * m)
+	}
+	if b.delay > maxDelay || b.delay <= 0 {
+		b.delay = maxDelay
+	}
+
+	return applyJitter(b.delay, b.Jitter, &b.rng)
+}
+
+// Implements Backoff.
+func (b *ExponentialBackoff) Reset() {
+	b.delay = 0
+}
+
+// A Backoff whose delay is always the same, apart from optional random
+// jitter.
+type ConstantBackoff struct {
+	// The delay. Defaults to DefaultInitialDelay.
+	Delay time.Duration
+
+	// If this is non-zero, each delay is varied randomly by up to this
+	// fraction of it in either direction. Must be in [0, 1].
+	Jitter float64
+
+	rng *rand.Rand
+}
+
+// Implements Backoff.
+func (b *ConstantBackoff) NextDelay() time.Duration {
+	d := b.Delay
+	if d <= 0 {
+		d = DefaultInitialDelay
+	}
+	return applyJitter(d, b.Jitter, &b.rng)
+}
+
+// Implements Backoff.
+func (b *ConstantBackoff) Reset() {
+}
+
+// Varies d randomly by up to the fraction jitter of it in either direction,
+// creating *rng if necessary. Each generator is seeded randomly, so that
+// processes started at the same time do not produce the same delays.
+func applyJitter(d time.Duration, jitter float64, rng **rand.Rand) time.Duration {
+	if jitter <= 0 {
+		return d
+	}
+	if jitter > 1 {
+		jitter = 1
+	}
+
+	if *rng == nil {
+		var seed [8]byte
+		crand.Read(seed[:])
+		*rng = rand.New(rand.NewSource(int64(binary.LittleEndian.Uint64(seed[:]))))
+	}
+
+	return time.Duration(float64(d) * (1 - jitter + 2*jitter*(*rng).Float64()))
+}
@@ -0,0 +1,41 @@
+package syslog
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExponentialBackoff(t *testing.T) {
+	b := &ExponentialBackoff{InitialDelay: time.Second, MaxDelay: 10 * time.Second}
+	for _, expected := range []time.Duration{1, 2, 4, 8, 10, 10} {
+		if d := b.NextDelay(); d != expected*time.Second {
+			t.Errorf("expected %v, got %v", expected*time.Second, d)
+		}
+	}
+
+	b.Reset()
+	if d := b.NextDelay(); d != time.Second {
+		t.Errorf("expected %v after reset, got %v", time.Second, d)
+	}
+
+	var zero ExponentialBackoff
+	if d := zero.NextDelay(); d != DefaultInitialDelay {
+		t.Errorf("expected %v, got %v", DefaultInitialDelay, d)
+	}
+}
+
+func TestBackoffJitter(t *testing.T) {
+	b := &ConstantBackoff{Delay: time.Second, Jitter: 0.5}
+
+	distinct := map[time.Duration]struct{}{}
+	for i := 0; i < 100; i++ {
+		d := b.NextDelay()
+		if d < 500*time.Millisecond || d > 1500*time.Millisecond {
+			t.Fatalf("delay outside jitter range: %v", d)
+		}
+		distinct[d] = struct{}{}
+	}
+	if len(distinct) < 10 {
+		t.Errorf("delays not randomised: %v", distinct)
+	}
+}
@@ -0,0 +1,43 @@
+package syslog
+
+import (
+	"strings"
+)
+
+// The maximum length of a SYSLOGv0 message (RFC 3164 §4.1).
+const bsdMaxMessageSize = 1024
+
+// The maximum length of a SYSLOGv0 TAG (RFC 3164 §4.1.3).
+const bsdMaxTagLen = 32
+
+// Returns true iff messages must be made to comply with RFC 3164. The
+// connection must have been established, so that the protocol has been
+// determined.
+func (l *Logger) bsdCompliant() bool {
+	return l.cfg.BSDCompliance && l.protocol.isV0()
+}
+
+// Converts a process name to a valid RFC 3164 TAG by removing all characters
+// other than ASCII letters and digits and truncating it to bsdMaxTagLen
+// characters.
+func bsdTag(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s) && b.Len() < bsdMaxTagLen; i++ {
+		c := s[i]
+		if (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// Replaces control characters, which RFC 3164 does not permit in the CONTENT
+// of a message, with spaces.
+func bsdContent(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r < ' ' || r == 0x7F {
+			return ' '
+		}
+		return r
+	}, s)
+}
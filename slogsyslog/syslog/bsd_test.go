@@ -0,0 +1,59 @@
+package syslog
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestBSDCompliance(t *testing.T) {
+	for _, p := range []Protocol{ProtocolV0Net, ProtocolV1Net} {
+		c := &recordingConn{}
+		log, err := New(Config{
+			Network:       "udp",
+			Address:       "192.0.2.1",
+			Protocol:      p,
+			HostName:      "host",
+			ProcName:      "my-app.worker_0123456789012345678901234567890",
+			BSDCompliance: true,
+			DialFunc: func(ctx context.Context, net, addr string) (io.WriteCloser, error) {
+				return c, nil
+			},
+		})
+		if err != nil {
+			t.Fatalf("cannot instantiate: %v", err)
+		}
+
+		if err := log.Write(context.Background(), Message{Body: "line 1\nline 2\t" + strings.Repeat("x", 2000)}); err != nil {
+			t.Fatalf("cannot write: %v", err)
+		}
+		log.Close()
+
+		if len(c.written) != 1 {
+			t.Fatalf("%v: expected one message, got %d", p, len(c.written))
+		}
+		m := c.written[0]
+
+		msg, err := ParseMessage([]byte(m))
+		if err != nil {
+			t.Fatalf("%v: cannot parse %q: %v", p, m, err)
+		}
+
+		if p == ProtocolV0Net {
+			if len(m) > 1024 {
+				t.Errorf("message exceeds 1024 bytes: %d", len(m))
+			}
+			if msg.ProcName != "myappworker012345678901234567890" {
+				t.Errorf("unexpected tag: %q", msg.ProcName)
+			}
+			if !strings.HasPrefix(msg.Body, "line 1 line 2 xxx") {
+				t.Errorf("unexpected body: %q", msg.Body)
+			}
+		} else {
+			if len(m) <= 2000 || msg.ProcName != "my-app.worker_0123456789012345678901234567890" || !strings.HasPrefix(msg.Body, "line 1\nline 2\t") {
+				t.Errorf("SYSLOGv1 message unexpectedly altered: %q", m)
+			}
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package syslog
+
+import (
+	"context"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// A fake secured datagram connection, which reports a network other than
+// "udp".
+type fakeDatagramConn struct {
+	net.Conn
+	written []string
+}
+
+func (c *fakeDatagramConn) Write(b []byte) (int, error) {
+	c.written = append(c.written, string(b))
+	return len(b), nil
+}
+
+func (c *fakeDatagramConn) Close() error {
+	return nil
+}
+
+func (c *fakeDatagramConn) LocalAddr() net.Addr {
+	return fakeAddr{}
+}
+
+type fakeAddr struct{}
+
+func (fakeAddr) Network() string { return "dtls" }
+func (fakeAddr) String() string  { return "192.0.2.2:1234" }
+
+func TestDialDatagram(t *testing.T) {
+	dc := &fakeDatagramConn{}
+	sc := &recordingConn{}
+	var dialed []string
+	log, err := New(Config{
+		Targets: []Target{
+			{"udp", "192.0.2.1:6514"},
+			{"tcp", "192.0.2.1"},
+		},
+		TargetPolicy:   TargetRoundRobin,
+		Protocol:       ProtocolV1Net,
+		ConnectBackoff: &ConstantBackoff{Delay: time.Nanosecond},
+		DialDatagram: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			dialed = append(dialed, "datagram "+network+" "+addr)
+			return dc, nil
+		},
+		DialFunc: func(ctx context.Context, network, addr string) (io.WriteCloser, error) {
+			dialed = append(dialed, "stream "+network+" "+addr)
+			return sc, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("cannot instantiate: %v", err)
+	}
+
+	if err := log.Write(context.Background(), Message{Body: "hello"}); err != nil {
+		t.Fatalf("cannot write: %v", err)
+	}
+	if st := log.Status(); st.Framing != FramingNone {
+		t.Errorf("expected no framing, got %v", st.Framing)
+	}
+	log.Close()
+
+	if len(dialed) != 1 || dialed[0] != "datagram udp 192.0.2.1:6514" {
+		t.Errorf("unexpected dials: %q", dialed)
+	}
+	if len(dc.written) != 1 || !strings.HasPrefix(dc.written[0], "<0>1 ") || !strings.HasSuffix(dc.written[0], "\ufeffhello") {
+		t.Errorf("expected a single unframed message, got %q", dc.written)
+	}
+
+	// Stream targets are not affected.
+	log, err = New(Config{
+		Network:  "tcp",
+		Address:  "192.0.2.1",
+		Protocol: ProtocolV1Net,
+		DialDatagram: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			t.Errorf("DialDatagram called for %q", network)
+			return dc, nil
+		},
+		DialFunc: func(ctx context.Context, network, addr string) (io.WriteCloser, error) {
+			return sc, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("cannot instantiate: %v", err)
+	}
+	defer log.Close()
+
+	if err := log.Write(context.Background(), Message{Body: "hello"}); err != nil {
+		t.Fatalf("cannot write: %v", err)
+	}
+	if len(sc.written) != 1 || !strings.HasSuffix(sc.written[0], "\x00") {
+		t.Errorf("expected a NUL-framed message, got %q", sc.written)
+	}
+}
@@ -2,6 +2,9 @@ package syslog_test
 
 import (
 	"context"
+	"errors"
+	"net"
+
 	"github.com/hlandau/slogkit/slogsyslog/syslog"
 )
 
@@ -22,3 +25,26 @@ func Example() {
 		Body:     "This is a syslog message.",
 	})
 }
+
+// This example shows how to send messages over DTLS (RFC 6012) using a
+// third-party DTLS implementation.
+func Example_dtls() {
+	log, err := syslog.New(syslog.Config{
+		Network: "udp",
+		Address: "192.0.2.1:6514",
+		DialDatagram: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			// Establish a DTLS connection to addr here, for example using
+			// github.com/pion/dtls, and return it.
+			return nil, errors.New("DTLS not available")
+		},
+	})
+	if err != nil {
+		// Handle error
+	}
+
+	log.Write(context.Background(), syslog.Message{
+		Severity: syslog.SeverityInfo,
+		Facility: syslog.FacilityDaemon,
+		Body:     "This message is encrypted in transit.",
+	})
+}
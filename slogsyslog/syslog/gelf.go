@@ -0,0 +1,237 @@
+package syslog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"crypto/rand"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// The standard port for GELF.
+const DefaultGELFPort = 12201
+
+// The default maximum size of a GELF UDP datagram. See Config.GELFChunkSize.
+const DefaultGELFChunkSize = 1420
+
+// Specifies how GELF messages sent over datagram sockets are compressed.
+type GELFCompression int
+
+const (
+	// Compress messages using gzip.
+	GELFCompressionGzip GELFCompression = iota
+
+	// Compress messages using zlib.
+	GELFCompressionZlib
+
+	// Do not compress messages.
+	GELFCompressionNone
+)
+
+const (
+	gelfChunkHeaderLen = 12  // magic, message ID, sequence number and count
+	gelfMaxChunks      = 128 // maximum sequence count
+)
+
+// Returned when a GELF message is too large to be sent in the maximum number
+// of chunks.
+var errGELFTooLarge = errors.New("GELF message too large")
+
+// Appends a GELF 1.1 message encoded as JSON. The SYSLOG fields which have no
+// GELF equivalent, and the parameters of any structured data, are sent as
+// additional fields.
+func appendGELF(buf []byte, pri int, timestamp time.Time, hostName, procName, procID string, msgID, msgBody, structuredData string) []byte {
+	shortMsg, fullMsg := msgBody, ""
+	if i := strings.IndexByte(msgBody, '\n'); i >= 0 {
+		shortMsg, fullMsg = msgBody[:i], msgBody
+	}
+	if shortMsg == "" {
+		shortMsg = msgID
+	}
+	if shortMsg == "" {
+		shortMsg = "-"
+	}
+
+	buf = append(buf, `{"version":"1.1","host":`...)
+	buf = appendJSONString(buf, hostName)
+	buf = append(buf, `,"short_message":`...)
+	buf = appendJSONString(buf, shortMsg)
+	if fullMsg != "" {
+		buf = append(buf, `,"full_message":`...)
+		buf = appendJSONString(buf, fullMsg)
+	}
+
+	ts := timestamp.UnixMicro()
+	buf = append(buf, `,"timestamp":`...)
+	buf = strconv.AppendInt(buf, ts/1e6, 10)
+	buf = append(buf, '.')
+	buf = append(buf, strconv.FormatInt(1e6+ts%1e6, 10)[1:]...)
+
+	buf = append(buf, `,"level":`...)
+	buf = strconv.AppendInt(buf, int64(pri&7), 10)
+	buf = append(buf, `,"_facility":`...)
+	buf = strconv.AppendInt(buf, int64(pri>>3), 10)
+	if procName != "-" {
+		buf = append(buf, `,"_appname":`...)
+		buf = appendJSONString(buf, procName)
+	}
+	if procID != "-" {
+		buf = append(buf, `,"_procid":`...)
+		buf = appendJSONString(buf, procID)
+	}
+	if msgID != "" {
+		buf = append(buf, `,"_msgid":`...)
+		buf = appendJSONString(buf, msgID)
+	}
+
+	if structuredData != "" && structuredData != "-" {
+		sd, err := ParseStructuredData(structuredData)
+		if err != nil {
+			buf = append(buf, `,"_structured_data":`...)
+			buf = appendJSONString(buf, structuredData)
+		} else {
+			for _, e := range sd.Elements() {
+				id := e.ID()
+				if i := strings.IndexByte(id, '@'); i >= 0 {
+					id = id[:i]
+				}
+				for _, p := range e.Params() {
+					buf = append(buf, `,"_`...)
+					buf = appendGELFFieldName(buf, id+"."+p.Name)
+					buf = append(buf, `":`...)
+					buf = appendJSONString(buf, p.Value)
+				}
+			}
+		}
+	}
+
+	return append(buf, '}')
+}
+
+// Appends a GELF additional field name, without the leading underscore,
+// replacing characters which are not permitted with underscores.
+func appendGELFFieldName(buf []byte, s string) []byte {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (c < '0' || c > '9') && c != '_' && c != '.' && c != '-' {
+			c = '_'
+		}
+		buf = append(buf, c)
+	}
+	return buf
+}
+
+// Appends a string as a JSON string literal, replacing invalid UTF-8 with
+// U+FFFD.
+func appendJSONString(buf []byte, s string) []byte {
+	const hex = "0123456789abcdef"
+
+	buf = append(buf, '"')
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			switch {
+			case c == '"' || c == '\\':
+				buf = append(buf, '\\', c)
+			case c == '\n':
+				buf = append(buf, '\\', 'n')
+			case c == '\r':
+				buf = append(buf, '\\', 'r')
+			case c == '\t':
+				buf = append(buf, '\\', 't')
+			case c < ' ':
+				buf = append(buf, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xF])
+			default:
+				buf = append(buf, c)
+			}
+			i++
+			continue
+		}
+
+		r, n := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && n == 1 {
+			buf = append(buf, "\ufffd"...)
+		} else {
+			buf = append(buf, s[i:i+n]...)
+		}
+		i += n
+	}
+	return append(buf, '"')
+}
+
+// Writes GELF messages to a datagram socket, compressing them and splitting
+// them into chunks as necessary. Each call to Write must pass a single
+// message.
+type gelfDatagramWriter struct {
+	w           io.Writer
+	compression GELFCompression
+	chunkSize   int
+}
+
+func (gw *gelfDatagramWriter) compress(b []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	var zw io.WriteCloser
+	switch gw.compression {
+	case GELFCompressionGzip:
+		zw = gzip.NewWriter(&buf)
+	case GELFCompressionZlib:
+		zw = zlib.NewWriter(&buf)
+	default:
+		return b, nil
+	}
+
+	if _, err := zw.Write(b); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gw *gelfDatagramWriter) Write(b []byte) (int, error) {
+	data, err := gw.compress(b)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(data) <= gw.chunkSize {
+		if _, err := gw.w.Write(data); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+
+	payloadSize := gw.chunkSize - gelfChunkHeaderLen
+	count := (len(data) + payloadSize - 1) / payloadSize
+	if count > gelfMaxChunks {
+		return 0, errGELFTooLarge
+	}
+
+	var id [8]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return 0, err
+	}
+
+	chunk := make([]byte, 0, gw.chunkSize)
+	for i := 0; i < count; i++ {
+		payload := data[i*payloadSize:]
+		if len(payload) > payloadSize {
+			payload = payload[:payloadSize]
+		}
+
+		chunk = append(chunk[:0], 0x1e, 0x0f)
+		chunk = append(chunk, id[:]...)
+		chunk = append(chunk, byte(i), byte(count))
+		chunk = append(chunk, payload...)
+		if _, err := gw.w.Write(chunk); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
@@ -0,0 +1,139 @@
+package syslog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newGELFTestLogger(t *testing.T, c *recordingConn, network string, compression GELFCompression, chunkSize int) *Logger {
+	log, err := New(Config{
+		Network:         network,
+		Address:         "192.0.2.1",
+		Protocol:        ProtocolGELF,
+		HostName:        "host",
+		ProcName:        "app",
+		GELFCompression: compression,
+		GELFChunkSize:   chunkSize,
+		DialFunc: func(ctx context.Context, net, addr string) (io.WriteCloser, error) {
+			if addr != "192.0.2.1:12201" {
+				t.Errorf("unexpected address: %q", addr)
+			}
+			return c, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("cannot instantiate: %v", err)
+	}
+	return log
+}
+
+func TestGELF(t *testing.T) {
+	c := &recordingConn{}
+	log := newGELFTestLogger(t, c, "tcp", GELFCompressionGzip, 0)
+
+	msg := Message{
+		Time:           time.Unix(1385053862, 307200000),
+		Severity:       SeverityWarning,
+		Facility:       FacilityAuth,
+		ID:             "LOGIN",
+		Body:           "first line\nsecond \"line\"",
+		StructuredData: `[slog@32473 user="bob"][http@32473 req.id="7"]`,
+	}
+	if err := log.Write(context.Background(), msg); err != nil {
+		t.Fatalf("cannot write: %v", err)
+	}
+	log.Close()
+
+	if len(c.written) != 1 || !strings.HasSuffix(c.written[0], "\x00") {
+		t.Fatalf("expected one NUL-terminated message, got %q", c.written)
+	}
+
+	var m map[string]any
+	if err := json.Unmarshal([]byte(strings.TrimSuffix(c.written[0], "\x00")), &m); err != nil {
+		t.Fatalf("cannot unmarshal %q: %v", c.written[0], err)
+	}
+
+	expected := map[string]any{
+		"version":       "1.1",
+		"host":          "host",
+		"short_message": "first line",
+		"full_message":  "first line\nsecond \"line\"",
+		"timestamp":     1385053862.3072,
+		"level":         4.0,
+		"_facility":     4.0,
+		"_appname":      "app",
+		"_msgid":        "LOGIN",
+		"_slog.user":    "bob",
+		"_http.req.id":  "7",
+	}
+	for k, v := range expected {
+		if m[k] != v {
+			t.Errorf("%s: expected %v, got %v", k, v, m[k])
+		}
+	}
+}
+
+func TestGELFChunking(t *testing.T) {
+	body := strings.Repeat("0123456789", 100)
+
+	c := &recordingConn{}
+	log := newGELFTestLogger(t, c, "udp", GELFCompressionNone, 100)
+	if err := log.Write(context.Background(), Message{Body: body}); err != nil {
+		t.Fatalf("cannot write: %v", err)
+	}
+	log.Close()
+
+	if len(c.written) < 2 {
+		t.Fatalf("expected multiple chunks, got %d", len(c.written))
+	}
+
+	var data []byte
+	for i, chunk := range c.written {
+		if len(chunk) > 100 || chunk[0] != 0x1e || chunk[1] != 0x0f || chunk[2:10] != c.written[0][2:10] ||
+			int(chunk[10]) != i || int(chunk[11]) != len(c.written) {
+			t.Fatalf("malformed chunk %d: %q", i, chunk)
+		}
+		data = append(data, chunk[12:]...)
+	}
+
+	var m map[string]any
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatalf("cannot unmarshal %q: %v", data, err)
+	}
+	if m["short_message"] != body {
+		t.Errorf("unexpected message: %q", data)
+	}
+}
+
+func TestGELFCompression(t *testing.T) {
+	c := &recordingConn{}
+	log := newGELFTestLogger(t, c, "udp", GELFCompressionGzip, 0)
+	if err := log.Write(context.Background(), Message{Body: "hello"}); err != nil {
+		t.Fatalf("cannot write: %v", err)
+	}
+	log.Close()
+
+	if len(c.written) != 1 {
+		t.Fatalf("expected one datagram, got %d", len(c.written))
+	}
+
+	r, err := gzip.NewReader(bytes.NewReader([]byte(c.written[0])))
+	if err != nil {
+		t.Fatalf("cannot decompress: %v", err)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("cannot decompress: %v", err)
+	}
+
+	var m map[string]any
+	if err := json.Unmarshal(data, &m); err != nil || m["short_message"] != "hello" {
+		t.Errorf("unexpected message %q: %v", data, err)
+	}
+}
@@ -0,0 +1,39 @@
+package syslog
+
+// Maximum lengths of SYSLOGv1 header fields (RFC 5424 §6).
+const (
+	maxHostNameLen = 255
+	maxAppNameLen  = 48
+	maxProcIDLen   = 128
+	maxMsgIDLen    = 32
+)
+
+// Converts s to a valid SYSLOGv1 header field of at most maxLen bytes, by
+// replacing any bytes other than printable US-ASCII characters (which do not
+// include the space) with underscores and truncating it. An empty string
+// becomes the NILVALUE. Valid fields are returned unchanged without
+// allocating.
+func headerField(s string, maxLen int) string {
+	if s == "" {
+		return "-"
+	}
+
+	valid := len(s) <= maxLen
+	for i := 0; valid && i < len(s); i++ {
+		valid = s[i] >= 33 && s[i] <= 126
+	}
+	if valid {
+		return s
+	}
+
+	if len(s) > maxLen {
+		s = s[:maxLen]
+	}
+	buf := []byte(s)
+	for i, c := range buf {
+		if c < 33 || c > 126 {
+			buf[i] = '_'
+		}
+	}
+	return string(buf)
+}
@@ -0,0 +1,69 @@
+package syslog
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHostNameFunc(t *testing.T) {
+	c := &recordingConn{}
+	hostName, hostNameErr := "a", error(nil)
+	calls := 0
+	log, err := New(Config{
+		Network:          "udp",
+		Address:          "192.0.2.1",
+		Protocol:         ProtocolV1Net,
+		HostName:         "initial",
+		HostNameInterval: time.Hour,
+		HostNameFunc: func() (string, error) {
+			calls++
+			return hostName, hostNameErr
+		},
+		DialFunc: func(ctx context.Context, net, addr string) (io.WriteCloser, error) {
+			return c, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("cannot instantiate: %v", err)
+	}
+	defer log.Close()
+
+	write := func(expected string) {
+		t.Helper()
+		c.written = nil
+		if err := log.Write(context.Background(), Message{}); err != nil {
+			t.Fatalf("cannot write: %v", err)
+		}
+		if len(c.written) != 1 || strings.Fields(c.written[0])[2] != expected {
+			t.Errorf("expected hostname %q, got %q", expected, c.written)
+		}
+	}
+
+	// The function is called when connecting, and then not again until the
+	// interval has elapsed.
+	write("a")
+	hostName = "b"
+	write("a")
+	if calls != 1 {
+		t.Errorf("expected 1 call, got %d", calls)
+	}
+
+	log.mutex.Lock()
+	log.hostNameAt = time.Now().Add(-time.Hour)
+	log.mutex.Unlock()
+	write("b")
+
+	// Errors are reported and the previous hostname kept.
+	hostName, hostNameErr = "c", errors.New("hostname unavailable")
+	log.mutex.Lock()
+	log.hostNameAt = time.Now().Add(-time.Hour)
+	log.mutex.Unlock()
+	write("b")
+	if st := log.Status(); st.LastError != hostNameErr {
+		t.Errorf("expected hostname error to be reported, got %v", st.LastError)
+	}
+}
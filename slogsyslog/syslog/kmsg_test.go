@@ -0,0 +1,52 @@
+package syslog
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestKmsg(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kmsg")
+	if err := os.WriteFile(path, nil, 0600); err != nil {
+		t.Fatalf("cannot create file: %v", err)
+	}
+
+	log, err := New(Config{
+		Network:  "kmsg",
+		Address:  path,
+		ProcName: "app",
+	})
+	if err != nil {
+		t.Fatalf("cannot instantiate: %v", err)
+	}
+
+	err = log.Write(context.Background(), Message{Severity: SeverityWarning, Facility: FacilityDaemon, ID: "ID", Body: "hello"})
+	if err != nil {
+		t.Fatalf("cannot write: %v", err)
+	}
+	err = log.Write(context.Background(), Message{Severity: SeverityInfo, Facility: FacilityUser, Body: strings.Repeat("x", 2000)})
+	if err != nil {
+		t.Fatalf("cannot write: %v", err)
+	}
+	log.Close()
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("cannot read file: %v", err)
+	}
+
+	prefix := "app[" + strconv.Itoa(os.Getpid()) + "]: "
+	first := "<28>" + prefix + "ID hello"
+	if !strings.HasPrefix(string(b), first) {
+		t.Fatalf("expected %q, got %q", first, b)
+	}
+
+	second := string(b[len(first):])
+	if !strings.HasPrefix(second, "<14>"+prefix+"xxx") || len(second) != kmsgMaxMessageSize {
+		t.Errorf("unexpected second message of length %d: %q", len(second), second)
+	}
+}
@@ -0,0 +1,286 @@
+package syslog
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A SYSLOG protocol message received from a peer. See ParseMessage and Server.
+type ReceivedMessage struct {
+	// The message. For SYSLOGv0 messages, the message ID cannot be distinguished
+	// from the message body, so ID is always empty and Body contains both.
+	// Time is the zero value if the message did not specify a timestamp.
+	Message
+
+	// The protocol variant the message was encoded with. This is either
+	// ProtocolV0Net or ProtocolV1Net; a SYSLOGv0-LOCAL message is reported as
+	// SYSLOGv0-NET with an empty HostName.
+	Protocol Protocol
+
+	// The hostname, process name and process ID fields of the message. These
+	// are empty if not specified. The process ID is a string as SYSLOGv1 does not
+	// require it to be numeric.
+	HostName string
+	ProcName string
+	ProcID   string
+
+	// The network and address of the peer the message was received from, if it
+	// was received by a Server.
+	Network    string
+	RemoteAddr net.Addr
+}
+
+// Returned by ParseMessage when a message cannot be parsed.
+var ErrMalformedMessage = errors.New("malformed syslog message")
+
+// Parses a single unframed SYSLOG protocol message, which may be a SYSLOGv1
+// (RFC 5424) or SYSLOGv0 (RFC 3164) message. Any trailing LF or NUL bytes are
+// ignored, as is a UTF-8 BOM at the start of the message body.
+//
+// SYSLOGv0 messages are parsed leniently, as the format is not well specified;
+// anything which cannot be identified as a timestamp, hostname or process name
+// becomes part of the message body. Messages without a valid PRI field, and
+// SYSLOGv1 messages which do not comply with RFC 5424, are rejected with
+// ErrMalformedMessage.
+func ParseMessage(b []byte) (*ReceivedMessage, error) {
+	s := strings.TrimRight(string(b), "\n\x00")
+
+	pri, s, ok := parsePri(s)
+	if !ok {
+		return nil, ErrMalformedMessage
+	}
+
+	msg := &ReceivedMessage{}
+	msg.Severity = Severity(pri & 7)
+	msg.Facility = Facility(pri >> 3)
+
+	if strings.HasPrefix(s, "1 ") {
+		return msg, parseV1(msg, s[2:])
+	}
+
+	parseV0(msg, s)
+	return msg, nil
+}
+
+// Parses a "<PRI>" field, returning the PRI value and the remainder of s.
+func parsePri(s string) (int, string, bool) {
+	if len(s) < 3 || s[0] != '<' {
+		return 0, s, false
+	}
+
+	end := strings.IndexByte(s, '>')
+	if end < 2 || end > 4 {
+		return 0, s, false
+	}
+
+	digits := s[1:end]
+	if len(digits) > 1 && digits[0] == '0' {
+		return 0, s, false
+	}
+
+	pri, err := strconv.Atoi(digits)
+	if err != nil || pri < 0 || pri > 191 {
+		return 0, s, false
+	}
+
+	return pri, s[end+1:], true
+}
+
+// Splits off the next space-delimited field of a SYSLOGv1 message, returning
+// "" for the NILVALUE.
+func nextV1Field(s string) (string, string, bool) {
+	i := strings.IndexByte(s, ' ')
+	if i <= 0 {
+		return "", s, false
+	}
+
+	field := s[:i]
+	if field == "-" {
+		field = ""
+	}
+	return field, s[i+1:], true
+}
+
+func parseV1(msg *ReceivedMessage, s string) error {
+	msg.Protocol = ProtocolV1Net
+
+	var ts string
+	var ok bool
+	for _, f := range []*string{&ts, &msg.HostName, &msg.ProcName, &msg.ProcID, &msg.ID} {
+		*f, s, ok = nextV1Field(s)
+		if !ok {
+			return ErrMalformedMessage
+		}
+	}
+
+	if ts != "" {
+		t, err := time.Parse(time.RFC3339Nano, ts)
+		if err != nil {
+			return ErrMalformedMessage
+		}
+		msg.Time = t
+	}
+
+	if strings.HasPrefix(s, "-") {
+		s = s[1:]
+	} else {
+		_, rest, err := parseStructuredData(s)
+		if err != nil {
+			return err
+		}
+		msg.StructuredData = s[:len(s)-len(rest)]
+		s = rest
+	}
+
+	switch {
+	case s == "":
+	case s[0] == ' ':
+		msg.Body = strings.TrimPrefix(s[1:], "\ufeff")
+	default:
+		return ErrMalformedMessage
+	}
+
+	return nil
+}
+
+func parseV0(msg *ReceivedMessage, s string) {
+	msg.Protocol = ProtocolV0Net
+
+	// Timestamp
+	if len(s) > len(time.Stamp) && s[len(time.Stamp)] == ' ' {
+		t, err := time.ParseInLocation(time.Stamp, s[:len(time.Stamp)], time.Local)
+		if err == nil {
+			msg.Time = v0Year(t, time.Now())
+			s = s[len(time.Stamp)+1:]
+		}
+	}
+
+	// The hostname is optional, so the first word is taken to be the process
+	// name (TAG) if it looks like one, and the hostname otherwise.
+	if procName, procID, rest, ok := parseV0Tag(s); ok {
+		msg.ProcName, msg.ProcID, s = procName, procID, rest
+	} else if i := strings.IndexByte(s, ' '); i > 0 && !msg.Time.IsZero() {
+		hostName := s[:i]
+		if procName, procID, rest, ok := parseV0Tag(s[i+1:]); ok {
+			msg.HostName = hostName
+			msg.ProcName, msg.ProcID, s = procName, procID, rest
+		}
+	}
+
+	msg.Body = strings.TrimPrefix(s, "\ufeff")
+}
+
+// SYSLOGv0 timestamps have no year. Chooses the year which places the
+// timestamp closest to now, allowing for slight clock skew into the future.
+func v0Year(t, now time.Time) time.Time {
+	t = t.AddDate(now.Year()-t.Year(), 0, 0)
+	if t.After(now.AddDate(0, 0, 1)) {
+		t = t.AddDate(-1, 0, 0)
+	}
+	return t
+}
+
+// Parses a SYSLOGv0 TAG of the form "name: " or "name[pid]: ", returning the
+// name, PID and remainder.
+func parseV0Tag(s string) (procName, procID, rest string, ok bool) {
+	end := strings.IndexAny(s, " :[")
+	if end <= 0 {
+		return
+	}
+
+	procName, rest = s[:end], s[end:]
+	if rest[0] == '[' {
+		j := strings.IndexByte(rest, ']')
+		if j < 0 {
+			return
+		}
+		procID, rest = rest[1:j], rest[j+1:]
+	}
+
+	if !strings.HasPrefix(rest, ":") {
+		return
+	}
+	rest = strings.TrimPrefix(rest[1:], " ")
+	return procName, procID, rest, true
+}
+
+// Parses encoded SYSLOGv1 structured data, such as the value of
+// Message.StructuredData. Returns ErrMalformedMessage if it is not valid,
+// ErrInvalidSDID or ErrInvalidSDName if an SD-ID or parameter name is not
+// valid. An empty string yields empty structured data. Escaped characters in
+// parameter values are unescaped.
+func ParseStructuredData(s string) (*StructuredData, error) {
+	if s == "" || s == "-" {
+		return &StructuredData{}, nil
+	}
+
+	sd, rest, err := parseStructuredData(s)
+	if err != nil {
+		return nil, err
+	}
+	if rest != "" {
+		return nil, ErrMalformedMessage
+	}
+	return sd, nil
+}
+
+// Parses one or more SD-ELEMENTs at the start of s, returning them and the
+// remainder of s.
+func parseStructuredData(s string) (*StructuredData, string, error) {
+	sd := &StructuredData{}
+	for {
+		if !strings.HasPrefix(s, "[") {
+			return nil, s, ErrMalformedMessage
+		}
+		s = s[1:]
+
+		end := strings.IndexAny(s, " ]")
+		if end < 0 {
+			return nil, s, ErrMalformedMessage
+		}
+		e, err := sd.Element(s[:end])
+		if err != nil {
+			return nil, s, err
+		}
+		s = s[end:]
+
+		for s[0] == ' ' {
+			s = s[1:]
+			eq := strings.Index(s, "=\"")
+			if eq < 0 {
+				return nil, s, ErrMalformedMessage
+			}
+			name := s[:eq]
+			s = s[eq+2:]
+
+			var value []byte
+			i := 0
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) && strings.IndexByte("\"\\]", s[i+1]) >= 0 {
+					i++
+				}
+				value = append(value, s[i])
+			}
+			if i+1 >= len(s) {
+				return nil, s, ErrMalformedMessage
+			}
+			s = s[i+1:]
+
+			if err := e.AddParam(name, string(value)); err != nil {
+				return nil, s, err
+			}
+		}
+
+		if s[0] != ']' {
+			return nil, s, ErrMalformedMessage
+		}
+		s = s[1:]
+
+		if !strings.HasPrefix(s, "[") {
+			return sd, s, nil
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package syslog
+
+import (
+	"testing"
+	"time"
+)
+
+var parseTests = []struct {
+	Input    string
+	Expected ReceivedMessage
+}{
+	{"<36>1 2021-10-11T07:25:00Z HostName ProcName 12345 MsgID - \ufeffMsgBody\n",
+		ReceivedMessage{Message: Message{Time: time.Date(2021, 10, 11, 7, 25, 0, 0, time.UTC), Severity: SeverityWarning, Facility: FacilityAuth, ID: "MsgID", Body: "MsgBody"},
+			Protocol: ProtocolV1Net, HostName: "HostName", ProcName: "ProcName", ProcID: "12345"}},
+	{`<165>1 - - - - - [id@32473 a="b\]" c="\"d"][x@1] Body`,
+		ReceivedMessage{Message: Message{Severity: SeverityNotice, Facility: FacilityLocal4, StructuredData: `[id@32473 a="b\]" c="\"d"][x@1]`, Body: "Body"},
+			Protocol: ProtocolV1Net}},
+	{"<36>1 2021-10-11T07:25:00Z HostName ProcName 12345 MsgID [id@32473 a=\"b\"]",
+		ReceivedMessage{Message: Message{Time: time.Date(2021, 10, 11, 7, 25, 0, 0, time.UTC), Severity: SeverityWarning, Facility: FacilityAuth, ID: "MsgID", StructuredData: `[id@32473 a="b"]`},
+			Protocol: ProtocolV1Net, HostName: "HostName", ProcName: "ProcName", ProcID: "12345"}},
+	{"<36>Oct 11 07:25:00 HostName ProcName[12345]: MsgID MsgBody",
+		ReceivedMessage{Message: Message{Time: time.Date(0, 10, 11, 7, 25, 0, 0, time.Local), Severity: SeverityWarning, Facility: FacilityAuth, Body: "MsgID MsgBody"},
+			Protocol: ProtocolV0Net, HostName: "HostName", ProcName: "ProcName", ProcID: "12345"}},
+	{"<36>Oct 11 07:25:00 ProcName[12345]: MsgBody\x00",
+		ReceivedMessage{Message: Message{Time: time.Date(0, 10, 11, 7, 25, 0, 0, time.Local), Severity: SeverityWarning, Facility: FacilityAuth, Body: "MsgBody"},
+			Protocol: ProtocolV0Net, ProcName: "ProcName", ProcID: "12345"}},
+	{"<13>su: MsgBody",
+		ReceivedMessage{Message: Message{Severity: SeverityNotice, Facility: FacilityUser, Body: "MsgBody"},
+			Protocol: ProtocolV0Net, ProcName: "su"}},
+	{"<13>just some text",
+		ReceivedMessage{Message: Message{Severity: SeverityNotice, Facility: FacilityUser, Body: "just some text"},
+			Protocol: ProtocolV0Net}},
+}
+
+var malformedTests = []string{
+	"",
+	"no pri",
+	"<192>1 - - - - - -",
+	"<01>1 - - - - - -",
+	"<13>1 - - - - -",
+	"<13>1 bad - - - - -",
+	"<13>1 - - - - - [id@32473 a=\"b]",
+	"<13>1 - - - - - [id a=\"b\"]x",
+	"<13>1 - - - - - [bad@id]",
+}
+
+func TestParseMessage(t *testing.T) {
+	for _, test := range parseTests {
+		got, err := ParseMessage([]byte(test.Input))
+		if err != nil {
+			t.Errorf("%q: error: %v", test.Input, err)
+			continue
+		}
+
+		// SYSLOGv0 timestamps have no year, so compare them without it.
+		expected := test.Expected
+		if got.Protocol == ProtocolV0Net && !got.Time.IsZero() {
+			got.Time = got.Time.AddDate(-got.Time.Year(), 0, 0)
+		}
+		if !got.Time.Equal(expected.Time) {
+			t.Errorf("%q: expected time %v, got %v", test.Input, expected.Time, got.Time)
+		}
+		got.Time, expected.Time = time.Time{}, time.Time{}
+
+		if *got != expected {
+			t.Errorf("%q: expected %+v, got %+v", test.Input, expected, *got)
+		}
+	}
+
+	for _, input := range malformedTests {
+		if _, err := ParseMessage([]byte(input)); err == nil {
+			t.Errorf("%q: expected error", input)
+		}
+	}
+}
+
+func TestParseStructuredData(t *testing.T) {
+	sd, err := ParseStructuredData(`[id@32473 a="b\]" c="\"d\x"][x@1]`)
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+
+	es := sd.Elements()
+	if len(es) != 2 || es[0].ID() != "id@32473" || es[1].ID() != "x@1" {
+		t.Fatalf("unexpected elements: %v", sd)
+	}
+
+	ps := es[0].Params()
+	if len(ps) != 2 || ps[0] != (SDParam{"a", "b]"}) || ps[1] != (SDParam{"c", `"d\x`}) {
+		t.Errorf("unexpected params: %v", ps)
+	}
+}
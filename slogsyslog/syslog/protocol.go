@@ -21,12 +21,25 @@ const (
 	ProtocolV0Net
 	// Use the SYSLOGv1-NET protocol.
 	ProtocolV1Net
+	// Use the format accepted by the Linux kernel log device, /dev/kmsg, which
+	// is a SYSLOGv0-LOCAL message without a timestamp. This is selected
+	// automatically for the "kmsg" network.
+	ProtocolKmsg
+	// Use the Graylog Extended Log Format (GELF) rather than a SYSLOG protocol.
+	// Messages sent over datagram sockets are compressed and chunked as
+	// determined by Config.GELFCompression and Config.GELFChunkSize; messages
+	// sent over stream sockets always use NUL framing.
+	ProtocolGELF
 )
 
 func (p Protocol) isLocal() bool {
 	return p == ProtocolV0Local
 }
 
+func (p Protocol) isV0() bool {
+	return p == ProtocolV0Local || p == ProtocolV0Net
+}
+
 func (p Protocol) isV1() bool {
 	return p == ProtocolV1Net
 }
@@ -111,7 +124,7 @@ func (fmtr *formatter) init() {
 }
 
 // Generates a SYSLOG protocol message using the given protocol.
-func (fmtr *formatter) formatTo(w io.Writer, p Protocol, f Framing, b BOMMode, pri int, timestamp time.Time, hostName, procName string, procID int, msgID, msgBody, structuredData string) error {
+func (fmtr *formatter) formatTo(w io.Writer, p Protocol, f Framing, b BOMMode, pri int, timestamp time.Time, hostName, procName, procID string, msgID, msgBody, structuredData string) error {
 	buf := fmtr.writeBuf[0:16]
 
 	// Empty Fields
@@ -121,6 +134,16 @@ func (fmtr *formatter) formatTo(w io.Writer, p Protocol, f Framing, b BOMMode, p
 	if procName == "" {
 		procName = "-"
 	}
+	if procID == "" {
+		procID = "-"
+	}
+
+	// SYSLOGv0 has no NILVALUE, so the process ID is omitted from the TAG
+	// together with its brackets.
+	pidSfx := ""
+	if procID != "-" {
+		pidSfx = "[" + procID + "]"
+	}
 	if structuredData == "" {
 		structuredData = "-"
 	}
@@ -150,19 +173,37 @@ func (fmtr *formatter) formatTo(w io.Writer, p Protocol, f Framing, b BOMMode, p
 			sep = " "
 		}
 		// Message ID is folded into message body for v0, so BOM comes before it.
-		buf = fmt.Appendf(buf, "<%d>%s %s[%d]: %s%s%s%s%s", pri, timestamp.Format(time.Stamp), procName, procID, bomPfx, msgID, sep, msgBody, endChar)
+		buf = fmt.Appendf(buf, "<%d>%s %s%s: %s%s%s%s%s", pri, timestamp.Format(time.Stamp), procName, pidSfx, bomPfx, msgID, sep, msgBody, endChar)
 	case ProtocolV0Net:
 		sep := ""
 		if msgID != "" {
 			sep = " "
 		}
 		// Message ID is folded into message body for v0, so BOM comes before it.
-		buf = fmt.Appendf(buf, "<%d>%s %s %s[%d]: %s%s%s%s%s", pri, timestamp.Format(time.Stamp), hostName, procName, procID, bomPfx, msgID, sep, msgBody, endChar)
+		buf = fmt.Appendf(buf, "<%d>%s %s %s%s: %s%s%s%s%s", pri, timestamp.Format(time.Stamp), hostName, procName, pidSfx, bomPfx, msgID, sep, msgBody, endChar)
 	case ProtocolV1Net:
-		if msgID == "" {
-			msgID = "-"
+		// Whitespace or other invalid characters in the header fields would
+		// corrupt the message, so they are replaced.
+		hostName = headerField(hostName, maxHostNameLen)
+		procName = headerField(procName, maxAppNameLen)
+		procID = headerField(procID, maxProcIDLen)
+		msgID = headerField(msgID, maxMsgIDLen)
+		// The message body is optional, in which case it is omitted together
+		// with the space and BOM preceding it.
+		sep := " "
+		if msgBody == "" {
+			sep, bomPfx = "", ""
+		}
+		buf = fmt.Appendf(buf, "<%d>1 %s %s %s %s %s %s%s%s%s%s", pri, timestamp.Format(time.RFC3339Nano), hostName, procName, procID, msgID, structuredData, sep, bomPfx, msgBody, endChar)
+	case ProtocolKmsg:
+		sep := ""
+		if msgID != "" {
+			sep = " "
 		}
-		buf = fmt.Appendf(buf, "<%d>1 %s %s %s %d %s %s %s%s%s", pri, timestamp.Format(time.RFC3339Nano), hostName, procName, procID, msgID, structuredData, bomPfx, msgBody, endChar)
+		buf = fmt.Appendf(buf, "<%d>%s%s: %s%s%s%s", pri, procName, pidSfx, msgID, sep, msgBody, endChar)
+	case ProtocolGELF:
+		buf = appendGELF(buf, pri, timestamp, hostName, procName, procID, msgID, msgBody, structuredData)
+		buf = append(buf, endChar...)
 	default:
 		panic("unknown syslog protocol")
 	}
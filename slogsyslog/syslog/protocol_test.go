@@ -15,29 +15,44 @@ var encodingTests = []struct {
 	Facility       Facility
 	HostName       string
 	ProcName       string
-	PID            int
+	ProcID         string
 	MessageID      string
 	MessageBody    string
 	StructuredData string
 }{
 	{"<36>1 2021-10-11T07:25:00Z HostName ProcName 12345 MsgID SD \ufeffMsgBody",
 		ProtocolV1Net, FramingNone, BOMModeAlways,
-		SeverityWarning, FacilityAuth, "HostName", "ProcName", 12345, "MsgID", "MsgBody", "SD"},
+		SeverityWarning, FacilityAuth, "HostName", "ProcName", "12345", "MsgID", "MsgBody", "SD"},
 	{"<36>1 2021-10-11T07:25:00Z HostName ProcName 12345 MsgID SD \ufeffMsgBody\n",
 		ProtocolV1Net, FramingDelimiterLF, BOMModeAlways,
-		SeverityWarning, FacilityAuth, "HostName", "ProcName", 12345, "MsgID", "MsgBody", "SD"},
+		SeverityWarning, FacilityAuth, "HostName", "ProcName", "12345", "MsgID", "MsgBody", "SD"},
 	{"<36>1 2021-10-11T07:25:00Z HostName ProcName 12345 MsgID SD \ufeffMsgBody\x00",
 		ProtocolV1Net, FramingDelimiterNUL, BOMModeAlways,
-		SeverityWarning, FacilityAuth, "HostName", "ProcName", 12345, "MsgID", "MsgBody", "SD"},
+		SeverityWarning, FacilityAuth, "HostName", "ProcName", "12345", "MsgID", "MsgBody", "SD"},
 	{"70 <36>1 2021-10-11T07:25:00Z HostName ProcName 12345 MsgID SD \ufeffMsgBody",
 		ProtocolV1Net, FramingLength, BOMModeAlways,
-		SeverityWarning, FacilityAuth, "HostName", "ProcName", 12345, "MsgID", "MsgBody", "SD"},
+		SeverityWarning, FacilityAuth, "HostName", "ProcName", "12345", "MsgID", "MsgBody", "SD"},
+	{"<36>1 2021-10-11T07:25:00Z HostName ProcName 12345 MsgID [id@32473 a=\"b\"]\n",
+		ProtocolV1Net, FramingDelimiterLF, BOMModeAlways,
+		SeverityWarning, FacilityAuth, "HostName", "ProcName", "12345", "MsgID", "", `[id@32473 a="b"]`},
 	{"<36>Oct 11 07:25:00 HostName ProcName[12345]: MsgID MsgBody",
 		ProtocolV0Net, FramingNone, BOMModeNever,
-		SeverityWarning, FacilityAuth, "HostName", "ProcName", 12345, "MsgID", "MsgBody", "SD"},
+		SeverityWarning, FacilityAuth, "HostName", "ProcName", "12345", "MsgID", "MsgBody", "SD"},
 	{"<36>Oct 11 07:25:00 ProcName[12345]: MsgID MsgBody",
 		ProtocolV0Local, FramingNone, BOMModeNever,
-		SeverityWarning, FacilityAuth, "HostName", "ProcName", 12345, "MsgID", "MsgBody", "SD"},
+		SeverityWarning, FacilityAuth, "HostName", "ProcName", "12345", "MsgID", "MsgBody", "SD"},
+	{"<36>1 2021-10-11T07:25:00Z HostName ProcName web-7f9c MsgID SD MsgBody",
+		ProtocolV1Net, FramingNone, BOMModeNever,
+		SeverityWarning, FacilityAuth, "HostName", "ProcName", "web-7f9c", "MsgID", "MsgBody", "SD"},
+	{"<36>1 2021-10-11T07:25:00Z HostName ProcName - MsgID SD MsgBody",
+		ProtocolV1Net, FramingNone, BOMModeNever,
+		SeverityWarning, FacilityAuth, "HostName", "ProcName", "-", "MsgID", "MsgBody", "SD"},
+	{"<36>1 2021-10-11T07:25:00Z Host_Name Proc__Name 1_2 abcdefghijklmnopqrstuvwxyz012345 SD MsgBody",
+		ProtocolV1Net, FramingNone, BOMModeNever,
+		SeverityWarning, FacilityAuth, "Host Name", "Proc\xc3\xa9Name", "1\t2", "abcdefghijklmnopqrstuvwxyz0123456789", "MsgBody", "SD"},
+	{"<36>Oct 11 07:25:00 HostName ProcName: MsgID MsgBody",
+		ProtocolV0Net, FramingNone, BOMModeNever,
+		SeverityWarning, FacilityAuth, "HostName", "ProcName", "-", "MsgID", "MsgBody", "SD"},
 }
 
 func TestProtocol(t *testing.T) {
@@ -52,7 +67,7 @@ func TestProtocol(t *testing.T) {
 		//test.Expected
 
 		err := fmt.formatTo(&b, test.Protocol, test.Framing, test.BOMMode, makePri(test.Severity, test.Facility), refTime, test.HostName, test.ProcName,
-			test.PID, test.MessageID, test.MessageBody, test.StructuredData)
+			test.ProcID, test.MessageID, test.MessageBody, test.StructuredData)
 		if err != nil {
 			t.Errorf("error: %v", err)
 		}
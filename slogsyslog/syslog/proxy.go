@@ -0,0 +1,261 @@
+package syslog
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Parses and validates a proxy URL. See Config.Proxy.
+func parseProxyURL(s string) (*url.URL, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+
+	switch u.Scheme {
+	case "socks5", "socks5h", "http":
+	default:
+		return nil, fmt.Errorf("unsupported syslog proxy scheme: %q", u.Scheme)
+	}
+
+	if u.Host == "" {
+		return nil, errors.New("syslog proxy URL has no host")
+	}
+
+	return u, nil
+}
+
+// Returns the address of the proxy server, adding the default port for its
+// scheme if necessary.
+func proxyAddress(u *url.URL) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+
+	port := "1080"
+	if u.Scheme == "http" {
+		port = "80"
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
+
+// Connects to address through the proxy server specified by u, which is
+// reached at proxyAddr using d. The network must be a TCP network.
+func dialProxy(ctx context.Context, d *net.Dialer, u *url.URL, proxyAddr, network, address string) (net.Conn, error) {
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+	default:
+		return nil, fmt.Errorf("cannot use a proxy with network %q", network)
+	}
+
+	c, err := d.DialContext(ctx, "tcp", proxyAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	// Bound the handshake by the context.
+	if deadline, ok := ctx.Deadline(); ok {
+		c.SetDeadline(deadline)
+	}
+	stop, done := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(done)
+		select {
+		case <-ctx.Done():
+			c.SetDeadline(time.Unix(1, 0))
+		case <-stop:
+		}
+	}()
+
+	if u.Scheme == "http" {
+		err = httpConnect(c, u, address)
+	} else {
+		err = socks5Connect(ctx, c, u, network, address)
+	}
+
+	// Wait for the watcher to exit, so that it cannot set the deadline after
+	// it has been cleared below.
+	close(stop)
+	<-done
+	if err == nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		c.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+
+	c.SetDeadline(time.Time{})
+	return c, nil
+}
+
+// Performs an HTTP CONNECT handshake.
+func httpConnect(c net.Conn, u *url.URL, address string) error {
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: address},
+		Host:   address,
+		Header: http.Header{},
+	}
+	if u.User != nil {
+		password, _ := u.User.Password()
+		creds := base64.StdEncoding.EncodeToString([]byte(u.User.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+creds)
+	}
+
+	if err := req.Write(c); err != nil {
+		return err
+	}
+
+	res, err := http.ReadResponse(bufio.NewReader(c), req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("syslog proxy refused connection: %s", res.Status)
+	}
+	return nil
+}
+
+var errSOCKS5 = errors.New("malformed SOCKS5 response")
+
+// Performs a SOCKS5 handshake (RFC 1928), using username/password
+// authentication (RFC 1929) if the URL specifies a username. For the
+// "socks5" scheme, hostnames are resolved locally; for "socks5h", they are
+// resolved by the proxy.
+func socks5Connect(ctx context.Context, c net.Conn, u *url.URL, network, address string) error {
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return err
+	}
+
+	// Method selection
+	method := byte(0x00) // no authentication
+	if u.User != nil {
+		method = 0x02 // username/password
+	}
+	if _, err := c.Write([]byte{5, 1, method}); err != nil {
+		return err
+	}
+
+	var buf [2]byte
+	if _, err := io.ReadFull(c, buf[:]); err != nil {
+		return err
+	}
+	if buf[0] != 5 {
+		return errSOCKS5
+	}
+	if buf[1] != method {
+		return errors.New("SOCKS5 proxy does not support the required authentication method")
+	}
+
+	// Username/password authentication
+	if method == 0x02 {
+		username := u.User.Username()
+		password, _ := u.User.Password()
+		if len(username) > 255 || len(password) > 255 {
+			return errors.New("SOCKS5 username or password too long")
+		}
+
+		req := []byte{1, byte(len(username))}
+		req = append(req, username...)
+		req = append(req, byte(len(password)))
+		req = append(req, password...)
+		if _, err := c.Write(req); err != nil {
+			return err
+		}
+
+		if _, err := io.ReadFull(c, buf[:]); err != nil {
+			return err
+		}
+		if buf[1] != 0 {
+			return errors.New("SOCKS5 proxy authentication failed")
+		}
+	}
+
+	// CONNECT request
+	req := []byte{5, 1, 0}
+	ip := net.ParseIP(host)
+	if ip == nil && u.Scheme == "socks5" {
+		ipNetwork := "ip"
+		switch network {
+		case "tcp4":
+			ipNetwork = "ip4"
+		case "tcp6":
+			ipNetwork = "ip6"
+		}
+
+		ips, err := net.DefaultResolver.LookupIP(ctx, ipNetwork, host)
+		if err != nil {
+			return err
+		}
+		ip = ips[0]
+	}
+
+	switch {
+	case ip == nil:
+		if len(host) > 255 {
+			return errors.New("SOCKS5 hostname too long")
+		}
+		req = append(req, 3, byte(len(host)))
+		req = append(req, host...)
+	case ip.To4() != nil:
+		req = append(req, 1)
+		req = append(req, ip.To4()...)
+	default:
+		req = append(req, 4)
+		req = append(req, ip.To16()...)
+	}
+	req = append(req, byte(port>>8), byte(port))
+	if _, err := c.Write(req); err != nil {
+		return err
+	}
+
+	// Reply: VER REP RSV ATYP BND.ADDR BND.PORT
+	var hdr [4]byte
+	if _, err := io.ReadFull(c, hdr[:]); err != nil {
+		return err
+	}
+	if hdr[0] != 5 {
+		return errSOCKS5
+	}
+	if hdr[1] != 0 {
+		return fmt.Errorf("SOCKS5 proxy refused connection (reply code %d)", hdr[1])
+	}
+
+	var addrLen int
+	switch hdr[3] {
+	case 1:
+		addrLen = net.IPv4len
+	case 4:
+		addrLen = net.IPv6len
+	case 3:
+		if _, err := io.ReadFull(c, buf[:1]); err != nil {
+			return err
+		}
+		addrLen = int(buf[0])
+	default:
+		return errSOCKS5
+	}
+
+	_, err = io.ReadFull(c, make([]byte, addrLen+2))
+	return err
+}
@@ -0,0 +1,161 @@
+package syslog
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// Runs a minimal proxy server, which uses handshake to determine the address
+// to connect to for each connection.
+func runTestProxy(t *testing.T, handshake func(c net.Conn, r *bufio.Reader) (string, error)) net.Addr {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("cannot listen: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer c.Close()
+
+				r := bufio.NewReader(c)
+				address, err := handshake(c, r)
+				if err != nil {
+					t.Errorf("proxy handshake failed: %v", err)
+					return
+				}
+
+				tc, err := net.Dial("tcp", address)
+				if err != nil {
+					t.Errorf("proxy cannot dial: %v", err)
+					return
+				}
+				defer tc.Close()
+
+				io.Copy(tc, r)
+			}()
+		}
+	}()
+
+	return l.Addr()
+}
+
+func socks5Handshake(c net.Conn, r *bufio.Reader) (string, error) {
+	// VER NMETHODS METHODS
+	hdr := make([]byte, 3)
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		return "", err
+	}
+	c.Write([]byte{5, 2})
+
+	// Username/password authentication
+	ver, _ := r.ReadByte()
+	ulen, _ := r.ReadByte()
+	user := make([]byte, ulen)
+	io.ReadFull(r, user)
+	plen, _ := r.ReadByte()
+	pass := make([]byte, plen)
+	io.ReadFull(r, pass)
+	if ver != 1 || string(user) != "user" || string(pass) != "pass" {
+		c.Write([]byte{1, 1})
+		return "", io.ErrUnexpectedEOF
+	}
+	c.Write([]byte{1, 0})
+
+	// Request
+	req := make([]byte, 4)
+	if _, err := io.ReadFull(r, req); err != nil {
+		return "", err
+	}
+	var host string
+	switch req[3] {
+	case 1:
+		ip := make([]byte, 4)
+		io.ReadFull(r, ip)
+		host = net.IP(ip).String()
+	case 3:
+		n, _ := r.ReadByte()
+		name := make([]byte, n)
+		io.ReadFull(r, name)
+		host = string(name)
+	}
+	port := make([]byte, 2)
+	io.ReadFull(r, port)
+
+	c.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+	return net.JoinHostPort(host, strconv.Itoa(int(port[0])<<8|int(port[1]))), nil
+}
+
+func httpConnectHandshake(c net.Conn, r *bufio.Reader) (string, error) {
+	req, err := http.ReadRequest(r)
+	if err != nil {
+		return "", err
+	}
+	if req.Method != http.MethodConnect || req.Header.Get("Proxy-Authorization") != "Basic dXNlcjpwYXNz" {
+		c.Write([]byte("HTTP/1.1 403 Forbidden\r\n\r\n"))
+		return "", io.ErrUnexpectedEOF
+	}
+
+	c.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+	return req.Host, nil
+}
+
+func TestProxy(t *testing.T) {
+	srv := NewServer(ServerConfig{})
+	defer srv.Close()
+
+	addr, err := srv.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("cannot listen: %v", err)
+	}
+	_, port, _ := net.SplitHostPort(addr.String())
+
+	socksAddr := runTestProxy(t, socks5Handshake)
+	httpAddr := runTestProxy(t, httpConnectHandshake)
+
+	for _, proxy := range []string{
+		"socks5://user:pass@" + socksAddr.String(),
+		"socks5h://user:pass@" + socksAddr.String(),
+		"http://user:pass@" + httpAddr.String(),
+	} {
+		log, err := New(Config{
+			Network: "tcp4",
+			Address: "localhost:" + port,
+			Proxy:   proxy,
+		})
+		if err != nil {
+			t.Fatalf("cannot instantiate: %v", err)
+		}
+
+		err = log.Write(context.Background(), Message{Body: proxy})
+		if err != nil {
+			t.Fatalf("%s: cannot write: %v", proxy, err)
+		}
+		log.Close()
+
+		select {
+		case msg := <-srv.Messages():
+			if msg.Body != proxy {
+				t.Errorf("%s: unexpected message: %+v", proxy, msg)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: timed out", proxy)
+		}
+	}
+
+	if _, err := New(Config{Address: "localhost", Proxy: "ftp://example.com"}); err == nil {
+		t.Errorf("expected error for unsupported proxy scheme")
+	}
+}
@@ -0,0 +1,195 @@
+package syslog
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+// Determines what Logger.Write does when the send queue is full. See
+// Config.QueueSize.
+type OverflowPolicy int
+
+const (
+	// Block until there is space in the queue, or the context passed to Write
+	// is done, in which case the context's error is returned.
+	OverflowBlock OverflowPolicy = iota
+
+	// Discard the message being written and return ErrQueueFull.
+	OverflowDropNewest
+
+	// Discard the oldest message in the queue to make space for the message
+	// being written.
+	OverflowDropOldest
+)
+
+// Returned by Logger.Write if the send queue is full and the overflow policy
+// is OverflowDropNewest.
+var ErrQueueFull = errors.New("syslog send queue is full")
+
+// A bounded queue of messages waiting to be written by a background
+// goroutine.
+type sendQueue struct {
+	size     int
+	overflow OverflowPolicy
+	dropped  *atomic.Uint64 // incremented for each message discarded
+
+	mutex   sync.Mutex
+	items   []Message
+	busy    bool          // a message is being written
+	closed  bool          // no more messages may be queued
+	err     error         // first error since the last flush
+	changed chan struct{} // closed and replaced whenever the above change
+	done    chan struct{} // closed when the writer goroutine exits
+}
+
+func newSendQueue(size int, overflow OverflowPolicy, dropped *atomic.Uint64) *sendQueue {
+	return &sendQueue{
+		size:     size,
+		overflow: overflow,
+		dropped:  dropped,
+		changed:  make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Wakes anything waiting for the state of the queue to change. The mutex must
+// be held.
+func (q *sendQueue) broadcast() {
+	close(q.changed)
+	q.changed = make(chan struct{})
+}
+
+// Waits for the state of the queue to change or ctx to be done. The mutex must
+// be held; it is released while waiting.
+func (q *sendQueue) wait(ctx context.Context) error {
+	ch := q.changed
+	q.mutex.Unlock()
+	defer q.mutex.Lock()
+
+	select {
+	case <-ch:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Queues a message, applying the overflow policy if the queue is full.
+func (q *sendQueue) push(ctx context.Context, msg Message) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	for !q.closed && len(q.items) >= q.size {
+		switch q.overflow {
+		case OverflowDropNewest:
+			q.dropped.Add(1)
+			return ErrQueueFull
+		case OverflowDropOldest:
+			q.dropped.Add(1)
+			q.items = q.items[1:]
+		default:
+			if err := q.wait(ctx); err != nil {
+				return err
+			}
+		}
+	}
+
+	if q.closed {
+		return errClosed
+	}
+
+	q.items = append(q.items, msg)
+	q.broadcast()
+	return nil
+}
+
+// Writes queued messages using write until the queue is closed and empty.
+func (q *sendQueue) run(write func(msg Message) error) {
+	defer close(q.done)
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	for {
+		for len(q.items) == 0 && !q.closed {
+			q.wait(context.Background())
+		}
+		if len(q.items) == 0 {
+			return
+		}
+
+		msg := q.items[0]
+		q.items[0] = Message{}
+		q.items = q.items[1:]
+		q.busy = true
+		q.broadcast()
+		q.mutex.Unlock()
+
+		err := write(msg)
+
+		q.mutex.Lock()
+		q.busy = false
+		if err != nil && q.err == nil {
+			q.err = err
+		}
+		q.broadcast()
+	}
+}
+
+// Waits until all queued messages have been written, returning the first error
+// which occurred since the last call to flush.
+func (q *sendQueue) flush(ctx context.Context) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	for len(q.items) > 0 || q.busy {
+		if err := q.wait(ctx); err != nil {
+			return err
+		}
+	}
+
+	err := q.err
+	q.err = nil
+	return err
+}
+
+// Prevents further messages from being queued and waits for the messages
+// already queued to be written. If ctx is done first, the messages not yet
+// written are discarded and abort is called, so that the message being
+// written can be abandoned, before waiting for the writer goroutine to exit.
+// Returns the first error which occurred since the last flush, or the
+// context's error if messages were discarded.
+func (q *sendQueue) close(ctx context.Context, abort func()) error {
+	q.mutex.Lock()
+	if !q.closed {
+		q.closed = true
+		q.broadcast()
+	}
+	q.mutex.Unlock()
+
+	select {
+	case <-q.done:
+	case <-ctx.Done():
+		q.mutex.Lock()
+		discarded := len(q.items) > 0 || q.busy
+		q.dropped.Add(uint64(len(q.items)))
+		q.items = nil
+		q.broadcast()
+		q.mutex.Unlock()
+
+		abort()
+		<-q.done
+		if discarded {
+			return ctx.Err()
+		}
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	err := q.err
+	q.err = nil
+	return err
+}
@@ -0,0 +1,242 @@
+package syslog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestQueue(t *testing.T) {
+	srv := NewServer(ServerConfig{QueueSize: 100})
+	defer srv.Close()
+
+	addr, err := srv.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("cannot listen: %v", err)
+	}
+
+	log, err := New(Config{
+		Network:   "tcp",
+		Address:   addr.String(),
+		QueueSize: 4,
+	})
+	if err != nil {
+		t.Fatalf("cannot instantiate: %v", err)
+	}
+
+	for i := 0; i < 50; i++ {
+		err := log.Write(context.Background(), Message{Body: fmt.Sprintf("message %d", i)})
+		if err != nil {
+			t.Fatalf("cannot write: %v", err)
+		}
+	}
+
+	if err := log.Flush(context.Background()); err != nil {
+		t.Errorf("cannot flush: %v", err)
+	}
+	log.Close()
+
+	for i := 0; i < 50; i++ {
+		select {
+		case msg := <-srv.Messages():
+			if expected := fmt.Sprintf("message %d", i); msg.Body != expected {
+				t.Errorf("expected %q, got %q", expected, msg.Body)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%d: timed out", i)
+		}
+	}
+
+	if err := log.Write(context.Background(), Message{}); err != errClosed {
+		t.Errorf("expected errClosed, got %v", err)
+	}
+}
+
+// A connection which blocks writes until unblocked.
+type blockingConn struct {
+	unblock chan struct{}
+	written chan string
+}
+
+func (c *blockingConn) Write(b []byte) (int, error) {
+	<-c.unblock
+	c.written <- string(b)
+	return len(b), nil
+}
+
+func (c *blockingConn) Close() error {
+	return nil
+}
+
+func TestQueueOverflow(t *testing.T) {
+	for _, overflow := range []OverflowPolicy{OverflowBlock, OverflowDropNewest, OverflowDropOldest} {
+		c := &blockingConn{
+			unblock: make(chan struct{}),
+			written: make(chan string, 10),
+		}
+
+		log, err := New(Config{
+			Network:       "udp",
+			Address:       "192.0.2.1",
+			Protocol:      ProtocolV0Local,
+			QueueSize:     2,
+			QueueOverflow: overflow,
+			DialFunc: func(ctx context.Context, net, addr string) (io.WriteCloser, error) {
+				return c, nil
+			},
+		})
+		if err != nil {
+			t.Fatalf("cannot instantiate: %v", err)
+		}
+
+		// Wait for the first message to be dequeued, so that the writer
+		// goroutine is blocked and the next two messages fill the queue.
+		log.Write(context.Background(), Message{Body: "0"})
+		for {
+			log.queue.mutex.Lock()
+			busy := log.queue.busy
+			log.queue.mutex.Unlock()
+			if busy {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+		log.Write(context.Background(), Message{Body: "1"})
+		log.Write(context.Background(), Message{Body: "2"})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		err = log.Write(ctx, Message{Body: "3"})
+		cancel()
+
+		var expected string
+		var dropped uint64
+		switch overflow {
+		case OverflowBlock:
+			if err != context.DeadlineExceeded {
+				t.Errorf("expected DeadlineExceeded, got %v", err)
+			}
+			expected = "012"
+		case OverflowDropNewest:
+			if err != ErrQueueFull {
+				t.Errorf("expected ErrQueueFull, got %v", err)
+			}
+			expected = "012"
+			dropped = 1
+		case OverflowDropOldest:
+			if err != nil {
+				t.Errorf("expected no error, got %v", err)
+			}
+			expected = "023"
+			dropped = 1
+		}
+
+		close(c.unblock)
+		log.Close()
+		close(c.written)
+
+		var got string
+		for s := range c.written {
+			got += s[len(s)-1:]
+		}
+		if got != expected {
+			t.Errorf("%v: expected %q, got %q", overflow, expected, got)
+		}
+		if got := log.Stats().Dropped; got != dropped {
+			t.Errorf("%v: expected %d dropped, got %d", overflow, dropped, got)
+		}
+	}
+}
+
+func TestDropDuringBackoff(t *testing.T) {
+	errDial := errors.New("dial failed")
+	log, err := New(Config{
+		Network:           "udp",
+		Address:           "192.0.2.1",
+		ConnectBackoff:    &ConstantBackoff{Delay: time.Hour},
+		DropDuringBackoff: true,
+		DialFunc: func(ctx context.Context, net, addr string) (io.WriteCloser, error) {
+			return nil, errDial
+		},
+	})
+	if err != nil {
+		t.Fatalf("cannot instantiate: %v", err)
+	}
+	defer log.Close()
+
+	if err := log.Write(context.Background(), Message{}); err != errDial {
+		t.Errorf("expected dial error, got %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := log.Write(context.Background(), Message{}); err != nil {
+			t.Errorf("expected no error, got %v", err)
+		}
+	}
+	if got := log.Stats().Dropped; got != 3 {
+		t.Errorf("expected 3 dropped, got %d", got)
+	}
+}
+
+func TestCloseContext(t *testing.T) {
+	fail := true
+	log, err := New(Config{
+		Network:        "udp",
+		Address:        "192.0.2.1",
+		QueueSize:      4,
+		ConnectBackoff: &ConstantBackoff{Delay: time.Nanosecond},
+		DialFunc: func(ctx context.Context, net, addr string) (io.WriteCloser, error) {
+			return &flakyConn{fail: &fail}, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("cannot instantiate: %v", err)
+	}
+
+	// The first write fails, and is retried on a new connection; the message
+	// is nonetheless written, so no error is reported.
+	for i := 0; i < 3; i++ {
+		if err := log.Write(context.Background(), Message{}); err != nil {
+			t.Fatalf("cannot write: %v", err)
+		}
+	}
+	if err := log.CloseContext(context.Background()); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	if st := log.Stats(); st.Sent != 3 || st.Dropped != 0 {
+		t.Errorf("unexpected stats: %+v", st)
+	}
+
+	// Connection attempts block until abandoned.
+	log, err = New(Config{
+		Network:   "udp",
+		Address:   "192.0.2.1",
+		QueueSize: 4,
+		DialFunc: func(ctx context.Context, net, addr string) (io.WriteCloser, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		},
+	})
+	if err != nil {
+		t.Fatalf("cannot instantiate: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := log.Write(context.Background(), Message{}); err != nil {
+			t.Fatalf("cannot write: %v", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := log.CloseContext(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+	if st := log.Stats(); st.Sent != 0 || st.Failed != 1 || st.Dropped != 2 {
+		t.Errorf("unexpected stats: %+v", st)
+	}
+	if err := log.Write(context.Background(), Message{}); err != errClosed {
+		t.Errorf("expected errClosed, got %v", err)
+	}
+}
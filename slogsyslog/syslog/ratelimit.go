@@ -0,0 +1,54 @@
+package syslog
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"time"
+)
+
+// Returned by Logger.Write if a message is discarded because the rate limit
+// has been exceeded. See Config.RateLimit.
+var ErrRateLimited = errors.New("syslog rate limit exceeded")
+
+// A token bucket rate limiter.
+type rateLimiter struct {
+	rate  float64 // tokens added per second
+	burst float64 // maximum number of tokens
+
+	mutex  sync.Mutex
+	tokens float64
+	last   time.Time // when tokens was last updated
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	if burst <= 0 {
+		burst = int(math.Max(1, math.Ceil(rate)))
+	}
+
+	return &rateLimiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+	}
+}
+
+// Takes a token if one is available at the given time, returning false if
+// none is.
+func (r *rateLimiter) allow(now time.Time) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if !r.last.IsZero() && now.After(r.last) {
+		r.tokens = math.Min(r.burst, r.tokens+now.Sub(r.last).Seconds()*r.rate)
+	}
+	if r.last.IsZero() || now.After(r.last) {
+		r.last = now
+	}
+
+	if r.tokens < 1 {
+		return false
+	}
+	r.tokens--
+	return true
+}
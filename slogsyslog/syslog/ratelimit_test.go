@@ -0,0 +1,71 @@
+package syslog
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	r := newRateLimiter(2, 3)
+	start := time.Now()
+
+	tests := []struct {
+		Offset  time.Duration
+		Allowed bool
+	}{
+		{0, true},
+		{0, true},
+		{0, true},
+		{0, false},
+		{250 * time.Millisecond, false},
+		{500 * time.Millisecond, true},
+		{500 * time.Millisecond, false},
+		{10 * time.Second, true},
+		{10 * time.Second, true},
+		{10 * time.Second, true},
+		{10 * time.Second, false},
+	}
+	for i, test := range tests {
+		if got := r.allow(start.Add(test.Offset)); got != test.Allowed {
+			t.Errorf("%d: expected %v, got %v", i, test.Allowed, got)
+		}
+	}
+
+	if r := newRateLimiter(0.5, 0); r.burst != 1 {
+		t.Errorf("expected default burst of 1, got %v", r.burst)
+	}
+	if r := newRateLimiter(2.5, 0); r.burst != 3 {
+		t.Errorf("expected default burst of 3, got %v", r.burst)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	log, err := New(Config{
+		Network:   "udp",
+		Address:   "192.0.2.1",
+		RateLimit: 0.001,
+		RateBurst: 3,
+		DialFunc: func(ctx context.Context, net, addr string) (io.WriteCloser, error) {
+			return &recordingConn{}, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("cannot instantiate: %v", err)
+	}
+	defer log.Close()
+
+	for i := 0; i < 5; i++ {
+		err := log.Write(context.Background(), Message{})
+		if i < 3 && err != nil {
+			t.Errorf("%d: expected no error, got %v", i, err)
+		} else if i >= 3 && err != ErrRateLimited {
+			t.Errorf("%d: expected ErrRateLimited, got %v", i, err)
+		}
+	}
+
+	if st := log.Stats(); st.Sent != 3 || st.Dropped != 2 {
+		t.Errorf("unexpected stats: %+v", st)
+	}
+}
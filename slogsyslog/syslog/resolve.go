@@ -0,0 +1,111 @@
+package syslog
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Determines how hostnames in target addresses are resolved. See
+// Config.Resolve.
+type ResolveMode int
+
+const (
+	// Pass hostnames to the dialer, which resolves them whenever a connection
+	// is made and, for UDP, uses only the first address.
+	ResolveNone ResolveMode = iota
+
+	// Resolve each hostname to all of its IPv4 and IPv6 addresses, each of
+	// which is then treated as a separate target, in the order returned by
+	// the resolver.
+	ResolveAll
+
+	// Look up the SRV records for the "syslog" service and the protocol of the
+	// network ("_syslog._udp" or "_syslog._tcp") at each hostname, and treat
+	// each SRV target as a separate target, in order of priority, with targets
+	// of the same priority ordered randomly by weight. The port in the address
+	// is ignored. If there are no SRV records, hostnames are resolved as for
+	// ResolveAll.
+	ResolveSRV
+)
+
+// The default interval at which target hostnames are resolved again. See
+// Config.ResolveInterval.
+const DefaultResolveInterval = 5 * time.Minute
+
+// Returns the targets to connect to, resolving the configured targets again if
+// resolution is enabled and the previous resolution has expired.
+func (l *Logger) currentTargets(ctx context.Context) []connTarget {
+	if l.cfg.Resolve == ResolveNone {
+		return l.connTargets
+	}
+
+	interval := l.cfg.ResolveInterval
+	if interval <= 0 {
+		interval = DefaultResolveInterval
+	}
+	if l.resolvedTargets != nil && time.Since(l.resolvedAt) < interval {
+		return l.resolvedTargets
+	}
+
+	var targets []connTarget
+	for _, t := range l.connTargets {
+		targets = append(targets, l.resolveTarget(ctx, t)...)
+	}
+
+	l.resolvedTargets = targets
+	l.resolvedAt = time.Now()
+	return targets
+}
+
+// Resolves a single target, returning it unchanged if it does not contain a
+// hostname or cannot be resolved.
+func (l *Logger) resolveTarget(ctx context.Context, t connTarget) []connTarget {
+	var proto string
+	switch t.Network {
+	case "udp", "udp4", "udp6":
+		proto = "udp"
+	case "tcp", "tcp4", "tcp6":
+		proto = "tcp"
+	default:
+		return []connTarget{t}
+	}
+
+	host, port, err := net.SplitHostPort(t.Address)
+	if err != nil || net.ParseIP(host) != nil {
+		return []connTarget{t}
+	}
+
+	if l.cfg.Resolve == ResolveSRV {
+		_, srvs, err := net.DefaultResolver.LookupSRV(ctx, "syslog", proto, host)
+		if err == nil && len(srvs) > 0 {
+			targets := make([]connTarget, 0, len(srvs))
+			for _, srv := range srvs {
+				addr := net.JoinHostPort(strings.TrimSuffix(srv.Target, "."), strconv.Itoa(int(srv.Port)))
+				targets = append(targets, connTarget{t.Network, addr})
+			}
+			return targets
+		}
+	}
+
+	ipNetwork := "ip"
+	switch t.Network {
+	case "udp4", "tcp4":
+		ipNetwork = "ip4"
+	case "udp6", "tcp6":
+		ipNetwork = "ip6"
+	}
+
+	ips, err := net.DefaultResolver.LookupIP(ctx, ipNetwork, host)
+	if err != nil || len(ips) == 0 {
+		return []connTarget{t}
+	}
+
+	targets := make([]connTarget, 0, len(ips))
+	for _, ip := range ips {
+		targets = append(targets, connTarget{t.Network, net.JoinHostPort(ip.String(), port)})
+	}
+	return targets
+}
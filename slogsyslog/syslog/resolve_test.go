@@ -0,0 +1,73 @@
+package syslog
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResolveAll(t *testing.T) {
+	var dialed []string
+	fail := false
+	log, err := New(Config{
+		Network:        "udp",
+		Address:        "localhost:1514",
+		Resolve:        ResolveAll,
+		ConnectBackoff: &ConstantBackoff{Delay: time.Nanosecond},
+		DialFunc: func(ctx context.Context, net, addr string) (io.WriteCloser, error) {
+			dialed = append(dialed, addr)
+			return &flakyConn{fail: &fail}, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("cannot instantiate: %v", err)
+	}
+
+	targets := log.currentTargets(context.Background())
+	if len(targets) == 0 {
+		t.Fatalf("no targets")
+	}
+	for _, target := range targets {
+		if !strings.HasSuffix(target.Address, ":1514") || strings.HasPrefix(target.Address, "localhost") {
+			t.Errorf("unexpected resolved target: %v", target)
+		}
+	}
+
+	// After a write fails, a different address is used if there is one.
+	for i := 0; i < 2; i++ {
+		fail = i > 0
+		time.Sleep(time.Millisecond)
+		if err := log.Write(context.Background(), Message{}); err != nil {
+			t.Errorf("cannot write: %v", err)
+		}
+	}
+	log.Close()
+
+	if len(dialed) != 2 || (len(targets) > 1 && dialed[0] == dialed[1]) {
+		t.Errorf("unexpected connections: %q", dialed)
+	}
+}
+
+func TestResolveFailure(t *testing.T) {
+	log, err := New(Config{
+		Network: "udp",
+		Address: "nonexistent.invalid",
+		Resolve: ResolveSRV,
+		DialFunc: func(ctx context.Context, net, addr string) (io.WriteCloser, error) {
+			return nil, errors.New("dial failed")
+		},
+	})
+	if err != nil {
+		t.Fatalf("cannot instantiate: %v", err)
+	}
+	defer log.Close()
+
+	// Targets which cannot be resolved are used unchanged.
+	targets := log.currentTargets(context.Background())
+	if len(targets) != 1 || targets[0].Address != "nonexistent.invalid:514" {
+		t.Errorf("unexpected targets: %v", targets)
+	}
+}
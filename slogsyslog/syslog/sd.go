@@ -0,0 +1,187 @@
+package syslog
+
+import (
+	"errors"
+	"strings"
+)
+
+// Maximum length of an SD-NAME (RFC 5424 §6.3).
+const maxSDNameLen = 32
+
+var (
+	// Returned when an SD-ID is not valid. See ValidSDID.
+	ErrInvalidSDID = errors.New("invalid SD-ID")
+
+	// Returned when a PARAM-NAME is not valid. See ValidSDName.
+	ErrInvalidSDName = errors.New("invalid SD-NAME")
+)
+
+// Returns true iff s is a valid SD-NAME, which is to say that it is between 1
+// and 32 bytes long and consists only of printable US-ASCII characters other
+// than '=', ' ', ']' and '"'.
+func ValidSDName(s string) bool {
+	if s == "" || len(s) > maxSDNameLen {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c <= ' ' || c >= 0x7F || c == '=' || c == ']' || c == '"' {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns true iff s is a valid SD-ID. An SD-ID is an SD-NAME which either
+// contains no '@', in which case it is one of the SD-IDs registered with IANA,
+// such as "timeQuality" or "origin", or has the form "name@PEN", where PEN is
+// a private enterprise number, such as "exampleSDID@32473".
+func ValidSDID(s string) bool {
+	if !ValidSDName(s) {
+		return false
+	}
+
+	i := strings.IndexByte(s, '@')
+	if i < 0 {
+		return true
+	}
+
+	name, pen := s[:i], s[i+1:]
+	if name == "" || pen == "" {
+		return false
+	}
+	for j := 0; j < len(pen); j++ {
+		if c := pen[j]; c != '.' && (c < '0' || c > '9') {
+			return false
+		}
+	}
+	return pen[0] != '.' && pen[len(pen)-1] != '.'
+}
+
+// An SD-PARAM, being a name-value pair within an SD-ELEMENT.
+type SDParam struct {
+	Name  string
+	Value string
+}
+
+// An SD-ELEMENT, consisting of an SD-ID and zero or more SD-PARAMs. Create one
+// using NewSDElement or StructuredData.Element.
+type SDElement struct {
+	id     string
+	params []SDParam
+}
+
+// Creates a new SD-ELEMENT with the given SD-ID. Returns ErrInvalidSDID if the
+// SD-ID is not valid.
+func NewSDElement(id string) (*SDElement, error) {
+	if !ValidSDID(id) {
+		return nil, ErrInvalidSDID
+	}
+	return &SDElement{id: id}, nil
+}
+
+// Returns the SD-ID of the element.
+func (e *SDElement) ID() string {
+	return e.id
+}
+
+// Returns the parameters of the element, in the order in which they were
+// added.
+func (e *SDElement) Params() []SDParam {
+	return e.params
+}
+
+// Adds a parameter to the element. Returns ErrInvalidSDName if the name is not
+// valid. The value may be any string; it is escaped as necessary when the
+// element is encoded. A name may be added more than once.
+func (e *SDElement) AddParam(name, value string) error {
+	if !ValidSDName(name) {
+		return ErrInvalidSDName
+	}
+	e.params = append(e.params, SDParam{Name: name, Value: value})
+	return nil
+}
+
+// Appends the encoded element to buf and returns the extended buffer.
+func (e *SDElement) AppendTo(buf []byte) []byte {
+	buf = append(buf, '[')
+	buf = append(buf, e.id...)
+	for _, p := range e.params {
+		buf = append(buf, ' ')
+		buf = append(buf, p.Name...)
+		buf = append(buf, '=', '"')
+		buf = appendSDParamValue(buf, p.Value)
+		buf = append(buf, '"')
+	}
+	return append(buf, ']')
+}
+
+// Returns the encoded element.
+func (e *SDElement) String() string {
+	return string(e.AppendTo(nil))
+}
+
+// Appends a PARAM-VALUE, escaping '"', '\' and ']' as required by RFC 5424.
+// Invalid UTF-8 sequences are replaced with U+FFFD, since a PARAM-VALUE must be
+// valid UTF-8.
+func appendSDParamValue(buf []byte, s string) []byte {
+	s = strings.ToValidUTF8(s, "\uFFFD")
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"', '\\', ']':
+			buf = append(buf, '\\', c)
+		default:
+			buf = append(buf, c)
+		}
+	}
+	return buf
+}
+
+// SYSLOGv1 structured data, consisting of zero or more SD-ELEMENTs, each with a
+// distinct SD-ID. The zero value is empty and ready to use. For example:
+//
+//	var sd syslog.StructuredData
+//	e, _ := sd.Element("exampleSDID@32473")
+//	e.AddParam("iut", "3")
+//	e.AddParam("eventSource", "Application")
+//	msg.StructuredData = sd.String()
+type StructuredData struct {
+	elements []*SDElement
+}
+
+// Returns the element with the given SD-ID, adding a new, empty element if
+// there is not already one. Returns ErrInvalidSDID if the SD-ID is not valid.
+func (sd *StructuredData) Element(id string) (*SDElement, error) {
+	for _, e := range sd.elements {
+		if e.id == id {
+			return e, nil
+		}
+	}
+
+	e, err := NewSDElement(id)
+	if err != nil {
+		return nil, err
+	}
+
+	sd.elements = append(sd.elements, e)
+	return e, nil
+}
+
+// Returns the elements, in the order in which they were added.
+func (sd *StructuredData) Elements() []*SDElement {
+	return sd.elements
+}
+
+// Appends the encoded structured data to buf and returns the extended buffer.
+// Nothing is appended if there are no elements.
+func (sd *StructuredData) AppendTo(buf []byte) []byte {
+	for _, e := range sd.elements {
+		buf = e.AppendTo(buf)
+	}
+	return buf
+}
+
+// Returns the encoded structured data, suitable for use as
+// Message.StructuredData. Returns "" if there are no elements.
+func (sd *StructuredData) String() string {
+	return string(sd.AppendTo(nil))
+}
@@ -0,0 +1,69 @@
+package syslog
+
+import (
+	"testing"
+)
+
+var sdIDTests = []struct {
+	ID    string
+	Valid bool
+}{
+	{"timeQuality", true},
+	{"exampleSDID@32473", true},
+	{"example@32473.1.2", true},
+	{"", false},
+	{"a b", false},
+	{"a=b", false},
+	{"a]b", false},
+	{"a\"b", false},
+	{"@32473", false},
+	{"example@", false},
+	{"example@abc", false},
+	{"example@1@2", false},
+	{"example@.1", false},
+	{"abcdefghijklmnopqrstuvwxyz@32473", true},
+	{"abcdefghijklmnopqrstuvwxyz@324731", false},
+}
+
+func TestValidSDID(t *testing.T) {
+	for _, test := range sdIDTests {
+		if got := ValidSDID(test.ID); got != test.Valid {
+			t.Errorf("%q: expected %v, got %v", test.ID, test.Valid, got)
+		}
+	}
+}
+
+func TestStructuredData(t *testing.T) {
+	var sd StructuredData
+	if s := sd.String(); s != "" {
+		t.Errorf("expected empty string, got %q", s)
+	}
+
+	e, err := sd.Element("exampleSDID@32473")
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	for _, p := range []SDParam{{"iut", "3"}, {"eventSource", "Application"}, {"esc", `a"b\c]d`}, {"utf8", "\xffé"}} {
+		if err := e.AddParam(p.Name, p.Value); err != nil {
+			t.Errorf("error: %v", err)
+		}
+	}
+	if err := e.AddParam("a=b", "x"); err != ErrInvalidSDName {
+		t.Errorf("expected ErrInvalidSDName, got %v", err)
+	}
+
+	if _, err := sd.Element("examplePriority@32473"); err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	if e2, _ := sd.Element("exampleSDID@32473"); e2 != e {
+		t.Errorf("expected existing element to be returned")
+	}
+	if _, err := sd.Element("bad id"); err != ErrInvalidSDID {
+		t.Errorf("expected ErrInvalidSDID, got %v", err)
+	}
+
+	expected := `[exampleSDID@32473 iut="3" eventSource="Application" esc="a\"b\\c\]d" utf8="` + "\uFFFDé" + `"][examplePriority@32473]`
+	if got := sd.String(); got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+}
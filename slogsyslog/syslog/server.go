@@ -0,0 +1,402 @@
+package syslog
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"sync"
+)
+
+// The default maximum size of a message accepted by a Server.
+const DefaultMaxMessageSize = 64 * 1024
+
+// Server configuration.
+type ServerConfig struct {
+	// If this is non-nil, it is called for each message received. Calls are
+	// made from the goroutine serving the socket or connection the message was
+	// received on, so messages from a single TCP connection are delivered in
+	// order but messages from different sockets and connections may be
+	// delivered concurrently.
+	//
+	// Otherwise, messages are sent on the channel returned by Server.Messages.
+	Handler func(msg *ReceivedMessage)
+
+	// If this is non-nil, it is called for each message which cannot be
+	// parsed, and for errors which cause a stream connection to be closed, such as
+	// a framing error. The address is that of the peer, if known. It is called
+	// in the same manner as Handler.
+	ErrorHandler func(err error, addr net.Addr)
+
+	// The maximum size of a message, in bytes. Larger datagrams are truncated,
+	// and stream connections are closed if a larger message is received on
+	// them. If zero, DefaultMaxMessageSize is used.
+	MaxMessageSize int
+
+	// The framing used on stream-oriented sockets. By default (FramingAuto),
+	// the framing of each message is detected as described for Server. If
+	// FramingDelimiterNUL or FramingDelimiterLF is specified, only that
+	// delimiter terminates messages which are not length framed, so that, for
+	// example, messages sent with NUL framing may contain newlines. If
+	// FramingLength is specified, all messages must be length framed.
+	Framing Framing
+
+	// The capacity of the channel returned by Server.Messages. Defaults to 64.
+	// Unused if Handler is set.
+	QueueSize int
+}
+
+// A SYSLOG protocol server, which receives messages from any number of
+// sockets.
+//
+// For stream-oriented sockets (TCP and "unix"), the framing of each message is
+// detected automatically as RFC 6587 describes: a message beginning with a
+// digit is taken to use explicit length framing (octet counting), and any
+// other message is taken to be terminated by a LF or NUL byte, or the end of
+// the connection. Since a Logger uses NUL framing by default, which permits
+// newlines in messages, such messages are split at any newlines unless
+// ServerConfig.Framing is set to FramingDelimiterNUL. Messages sent without
+// any framing (FramingNone) cannot be separated reliably.
+type Server struct {
+	cfg      ServerConfig
+	messages chan *ReceivedMessage
+	done     chan struct{}
+	wg       sync.WaitGroup
+
+	mutex     sync.Mutex
+	closed    bool
+	listeners []io.Closer
+	conns     map[net.Conn]struct{}
+}
+
+// Returned when using a server which has been closed.
+var ErrServerClosed = errors.New("syslog server closed")
+
+// Creates a new server. It does not receive any messages until Listen, Serve
+// or ServePacket is called.
+func NewServer(cfg ServerConfig) *Server {
+	if cfg.MaxMessageSize == 0 {
+		cfg.MaxMessageSize = DefaultMaxMessageSize
+	}
+	if cfg.QueueSize == 0 {
+		cfg.QueueSize = 64
+	}
+
+	s := &Server{
+		cfg:   cfg,
+		done:  make(chan struct{}),
+		conns: map[net.Conn]struct{}{},
+	}
+	if cfg.Handler == nil {
+		s.messages = make(chan *ReceivedMessage, cfg.QueueSize)
+	}
+	return s
+}
+
+// Returns the channel on which received messages are delivered if no Handler
+// was configured, or nil otherwise. The channel is closed when the server is
+// closed.
+//
+// If messages are not received from the channel promptly, the server stops
+// reading from its sockets, so that TCP peers experience backpressure and UDP
+// messages are dropped.
+func (s *Server) Messages() <-chan *ReceivedMessage {
+	return s.messages
+}
+
+// Listens on the given network and address and serves the resulting socket in
+// the background until the server is closed. Returns the address listened on,
+// which is useful if the address specified a port of zero.
+//
+// Valid networks are "udp", "udp4", "udp6", "unixgram", "tcp", "tcp4", "tcp6"
+// and "unix".
+func (s *Server) Listen(network, address string) (net.Addr, error) {
+	switch network {
+	case "udp", "udp4", "udp6", "unixgram":
+		pc, err := net.ListenPacket(network, address)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.track(pc); err != nil {
+			return nil, err
+		}
+
+		go func() {
+			defer s.wg.Done()
+			s.servePacket(pc)
+		}()
+		return pc.LocalAddr(), nil
+
+	case "tcp", "tcp4", "tcp6", "unix":
+		l, err := net.Listen(network, address)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.track(l); err != nil {
+			return nil, err
+		}
+
+		go func() {
+			defer s.wg.Done()
+			s.serve(l)
+		}()
+		return l.Addr(), nil
+
+	default:
+		return nil, net.UnknownNetworkError(network)
+	}
+}
+
+// Serves a stream-oriented listener, such as a TLS listener, blocking until the
+// listener fails or the server is closed. The listener is closed when the
+// server is closed.
+func (s *Server) Serve(l net.Listener) error {
+	if err := s.track(l); err != nil {
+		return err
+	}
+
+	defer s.wg.Done()
+	return s.serve(l)
+}
+
+// Serves a datagram-oriented socket, blocking until the socket fails or the
+// server is closed. The socket is closed when the server is closed.
+func (s *Server) ServePacket(pc net.PacketConn) error {
+	if err := s.track(pc); err != nil {
+		return err
+	}
+
+	defer s.wg.Done()
+	return s.servePacket(pc)
+}
+
+// Stops receiving messages, closing all sockets and connections, and waits for
+// any calls to Handler or ErrorHandler to return. The channel returned by
+// Messages is then closed. This function is idempotent.
+func (s *Server) Close() error {
+	s.mutex.Lock()
+	if s.closed {
+		s.mutex.Unlock()
+		return nil
+	}
+	s.closed = true
+	close(s.done)
+	for _, l := range s.listeners {
+		l.Close()
+	}
+	for c := range s.conns {
+		c.Close()
+	}
+	s.mutex.Unlock()
+
+	s.wg.Wait()
+	if s.messages != nil {
+		close(s.messages)
+	}
+	return nil
+}
+
+// Registers a socket to be closed when the server is closed, or closes it at
+// once if the server has already been closed. If successful, the caller must
+// call s.wg.Done once it has finished serving the socket.
+func (s *Server) track(c io.Closer) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.closed {
+		c.Close()
+		return ErrServerClosed
+	}
+	s.listeners = append(s.listeners, c)
+	s.wg.Add(1)
+	return nil
+}
+
+func (s *Server) isClosed() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *Server) serve(l net.Listener) error {
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			if s.isClosed() {
+				return ErrServerClosed
+			}
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				continue
+			}
+			return err
+		}
+
+		s.mutex.Lock()
+		if s.closed {
+			s.mutex.Unlock()
+			c.Close()
+			return ErrServerClosed
+		}
+		s.conns[c] = struct{}{}
+		s.wg.Add(1)
+		s.mutex.Unlock()
+
+		go func() {
+			defer s.wg.Done()
+			s.serveConn(c, l.Addr().Network())
+		}()
+	}
+}
+
+func (s *Server) servePacket(pc net.PacketConn) error {
+	network := pc.LocalAddr().Network()
+	buf := make([]byte, s.cfg.MaxMessageSize)
+	for {
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil {
+			if s.isClosed() {
+				return ErrServerClosed
+			}
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				continue
+			}
+			return err
+		}
+
+		s.deliver(buf[:n], network, addr)
+	}
+}
+
+func (s *Server) serveConn(c net.Conn, network string) {
+	defer func() {
+		s.mutex.Lock()
+		delete(s.conns, c)
+		s.mutex.Unlock()
+		c.Close()
+	}()
+
+	r := bufio.NewReader(c)
+	for {
+		frame, err := s.readFrame(r)
+		if len(frame) > 0 {
+			s.deliver(frame, network, c.RemoteAddr())
+		}
+		if err != nil {
+			if err != io.EOF && !s.isClosed() {
+				s.error(err, c.RemoteAddr())
+			}
+			return
+		}
+	}
+}
+
+var (
+	errFrameTooLarge        = errors.New("syslog message exceeds maximum size")
+	errMalformedFrameLength = errors.New("malformed syslog frame length")
+)
+
+func (s *Server) isDelimiter(c byte) bool {
+	switch s.cfg.Framing {
+	case FramingDelimiterNUL:
+		return c == 0
+	case FramingDelimiterLF:
+		return c == '\n'
+	default:
+		return c == 0 || c == '\n'
+	}
+}
+
+// Reads a single message from a stream, detecting the framing used. Returns
+// io.EOF at the end of the stream.
+func (s *Server) readFrame(r *bufio.Reader) ([]byte, error) {
+	c, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	// Octet counting: MSG-LEN SP SYSLOG-MSG
+	if c >= '1' && c <= '9' || s.cfg.Framing == FramingLength {
+		if c < '1' || c > '9' {
+			return nil, errMalformedFrameLength
+		}
+
+		n := int(c - '0')
+		for {
+			c, err = r.ReadByte()
+			if err != nil {
+				return nil, io.ErrUnexpectedEOF
+			}
+			if c == ' ' {
+				break
+			}
+			if c < '0' || c > '9' {
+				return nil, errMalformedFrameLength
+			}
+			n = n*10 + int(c-'0')
+			if n > s.cfg.MaxMessageSize {
+				return nil, errFrameTooLarge
+			}
+		}
+
+		frame := make([]byte, n)
+		if _, err := io.ReadFull(r, frame); err != nil {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return frame, nil
+	}
+
+	// Non-transparent framing: SYSLOG-MSG TRAILER, where the trailer is LF or
+	// NUL. Empty frames, as may arise from a CRLF or LF NUL trailer, are
+	// skipped by the caller.
+	var frame []byte
+	for !s.isDelimiter(c) {
+		if len(frame) >= s.cfg.MaxMessageSize {
+			return nil, errFrameTooLarge
+		}
+		frame = append(frame, c)
+
+		c, err = r.ReadByte()
+		if err == io.EOF {
+			return frame, io.EOF
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	if len(frame) > 0 && frame[len(frame)-1] == '\r' {
+		frame = frame[:len(frame)-1]
+	}
+	return frame, nil
+}
+
+// Parses a message and delivers it to the handler or channel.
+func (s *Server) deliver(b []byte, network string, addr net.Addr) {
+	msg, err := ParseMessage(b)
+	if err != nil {
+		s.error(err, addr)
+		return
+	}
+
+	msg.Network = network
+	msg.RemoteAddr = addr
+
+	if s.cfg.Handler != nil {
+		s.cfg.Handler(msg)
+		return
+	}
+
+	select {
+	case s.messages <- msg:
+	case <-s.done:
+	}
+}
+
+func (s *Server) error(err error, addr net.Addr) {
+	if s.cfg.ErrorHandler != nil {
+		s.cfg.ErrorHandler(err, addr)
+	}
+}
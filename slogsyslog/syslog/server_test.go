@@ -0,0 +1,128 @@
+package syslog
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServer(t *testing.T) {
+	srv := NewServer(ServerConfig{})
+	defer srv.Close()
+
+	// A second server accepts NUL framing only, so that messages may contain
+	// newlines.
+	nulSrv := NewServer(ServerConfig{Framing: FramingDelimiterNUL})
+	defer nulSrv.Close()
+
+	var addrs []net.Addr
+	for _, l := range []struct {
+		srv     *Server
+		network string
+	}{{srv, "udp"}, {srv, "tcp"}, {nulSrv, "tcp"}} {
+		addr, err := l.srv.Listen(l.network, "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("cannot listen: %v", err)
+		}
+		addrs = append(addrs, addr)
+	}
+
+	configs := []Config{
+		{Network: "udp", Address: addrs[0].String()},
+		{Network: "tcp", Address: addrs[1].String(), Framing: FramingLength},
+		{Network: "tcp", Address: addrs[1].String(), Framing: FramingDelimiterLF},
+		{Network: "tcp", Address: addrs[2].String(), Framing: FramingDelimiterNUL, Protocol: ProtocolV0Net},
+	}
+
+	for i, cfg := range configs {
+		cfg.HostName = "host"
+		cfg.ProcName = "app"
+
+		log, err := New(cfg)
+		if err != nil {
+			t.Fatalf("cannot instantiate: %v", err)
+		}
+
+		for j := 0; j < 3; j++ {
+			body := fmt.Sprintf("message %d.%d\n%s", i, j, strings.Repeat("x", j*1000+1))
+			err := log.Write(context.Background(), Message{
+				Severity:       SeverityNotice,
+				Facility:       FacilityLocal0,
+				ID:             "ID",
+				Body:           body,
+				StructuredData: `[a@32473 b="c"]`,
+			})
+			if err != nil {
+				t.Fatalf("cannot write: %v", err)
+			}
+
+			messages := srv.Messages()
+			if cfg.Framing == FramingDelimiterNUL {
+				messages = nulSrv.Messages()
+			}
+
+			var msg *ReceivedMessage
+			select {
+			case msg = <-messages:
+			case <-time.After(5 * time.Second):
+				t.Fatalf("%d.%d: timed out", i, j)
+			}
+
+			if cfg.Framing == FramingDelimiterLF {
+				// The LF in the body is taken to be a delimiter, and the
+				// remainder is discarded as it has no PRI.
+				body = strings.SplitN(body, "\n", 2)[0]
+			}
+
+			expected := body
+			if msg.Protocol == ProtocolV0Net {
+				expected = "ID " + body
+			}
+			if msg.Body != expected || msg.HostName != "host" || msg.ProcName != "app" ||
+				msg.Severity != SeverityNotice || msg.Facility != FacilityLocal0 || msg.Network != cfg.Network {
+				t.Errorf("%d.%d: unexpected message: %+v", i, j, msg)
+			}
+		}
+
+		log.Close()
+	}
+}
+
+func TestServerClose(t *testing.T) {
+	received := make(chan *ReceivedMessage, 1)
+	srv := NewServer(ServerConfig{
+		Handler: func(msg *ReceivedMessage) {
+			received <- msg
+		},
+	})
+
+	addr, err := srv.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("cannot listen: %v", err)
+	}
+
+	c, err := net.Dial("tcp", addr.String())
+	if err != nil {
+		t.Fatalf("cannot dial: %v", err)
+	}
+	defer c.Close()
+
+	fmt.Fprintf(c, "<13>1 - - - - - - hello\n")
+	select {
+	case msg := <-received:
+		if msg.Body != "hello" {
+			t.Errorf("unexpected message: %+v", msg)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out")
+	}
+
+	// Close must not wait for the idle connection.
+	srv.Close()
+	if _, err := srv.Listen("tcp", "127.0.0.1:0"); err != ErrServerClosed {
+		t.Errorf("expected ErrServerClosed, got %v", err)
+	}
+}
@@ -0,0 +1,104 @@
+package syslog
+
+import (
+	"unicode/utf8"
+)
+
+// Determines what happens to a message which exceeds Config.MaxMessageSize.
+type MessageSizePolicy int
+
+const (
+	// Truncate the message body so that the message fits.
+	MessageSizeTruncate MessageSizePolicy = iota
+
+	// Split the message body across as many messages as necessary, each with
+	// the same header fields and structured data.
+	MessageSizeSplit
+)
+
+// The default path of the Linux kernel log device.
+const DefaultKmsgPath = "/dev/kmsg"
+
+// The maximum length of a message accepted by /dev/kmsg (LOG_LINE_MAX).
+const kmsgMaxMessageSize = 992
+
+// Returns the maximum message size to be applied, taking account of
+// Config.BSDCompliance and the limits of the protocol. The connection must
+// have been established, so that the protocol has been determined.
+func (l *Logger) maxMessageSize() int {
+	limit := 0
+	switch {
+	case l.protocol == ProtocolKmsg:
+		limit = kmsgMaxMessageSize
+	case l.bsdCompliant():
+		limit = bsdMaxMessageSize
+	}
+
+	maxSize := l.cfg.MaxMessageSize
+	if limit > 0 && (maxSize <= 0 || maxSize > limit) {
+		maxSize = limit
+	}
+	return maxSize
+}
+
+// Counts the bytes written to it.
+type countingWriter struct {
+	n int
+}
+
+func (w *countingWriter) Write(b []byte) (int, error) {
+	w.n += len(b)
+	return len(b), nil
+}
+
+// Returns the bodies of the messages to be written for msg, taking account of
+// the maximum message size. The connection must have been
+// established, so that the protocol has been determined.
+func (l *Logger) splitBody(msg Message) []string {
+	maxSize := l.maxMessageSize()
+	if maxSize <= 0 {
+		return []string{msg.Body}
+	}
+
+	// Determine the space available for the body by formatting the message
+	// with a one-byte body and no framing.
+	var cw countingWriter
+	pri := makePri(msg.Severity, msg.Facility)
+	l.fmtr.formatTo(&cw, l.protocol, FramingNone, l.bomMode, pri, msg.Time, l.hostName, l.procName, l.cfg.ProcID, msg.ID, "x", msg.StructuredData)
+	room := maxSize - (cw.n - 1)
+
+	if len(msg.Body) <= room {
+		return []string{msg.Body}
+	}
+	if room <= 0 || l.cfg.MessageSizePolicy != MessageSizeSplit {
+		return []string{truncateUTF8(msg.Body, room)}
+	}
+
+	var bodies []string
+	for s := msg.Body; s != ""; {
+		chunk := truncateUTF8(s, room)
+		if chunk == "" {
+			// The space available is smaller than this character.
+			_, n := utf8.DecodeRuneInString(s)
+			chunk = s[:n]
+		}
+		bodies = append(bodies, chunk)
+		s = s[len(chunk):]
+	}
+	return bodies
+}
+
+// Truncates s to at most n bytes without splitting a UTF-8 sequence.
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	if n <= 0 {
+		return ""
+	}
+
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
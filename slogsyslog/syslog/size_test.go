@@ -0,0 +1,77 @@
+package syslog
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// A connection which records the messages written to it.
+type recordingConn struct {
+	written []string
+}
+
+func (c *recordingConn) Write(b []byte) (int, error) {
+	c.written = append(c.written, string(b))
+	return len(b), nil
+}
+
+func (c *recordingConn) Close() error {
+	return nil
+}
+
+func TestMaxMessageSize(t *testing.T) {
+	body := strings.Repeat("abcdé€", 50)
+
+	for _, policy := range []MessageSizePolicy{MessageSizeTruncate, MessageSizeSplit} {
+		c := &recordingConn{}
+		log, err := New(Config{
+			Network:           "udp",
+			Address:           "192.0.2.1",
+			HostName:          "host",
+			ProcName:          "app",
+			MaxMessageSize:    100,
+			MessageSizePolicy: policy,
+			DialFunc: func(ctx context.Context, net, addr string) (io.WriteCloser, error) {
+				return c, nil
+			},
+		})
+		if err != nil {
+			t.Fatalf("cannot instantiate: %v", err)
+		}
+
+		if err := log.Write(context.Background(), Message{ID: "ID", Body: body}); err != nil {
+			t.Fatalf("cannot write: %v", err)
+		}
+		log.Close()
+
+		var bodies []string
+		for _, m := range c.written {
+			if len(m) > 100 {
+				t.Errorf("%v: message exceeds maximum size: %q", policy, m)
+			}
+
+			msg, err := ParseMessage([]byte(m))
+			if err != nil {
+				t.Fatalf("%v: cannot parse %q: %v", policy, m, err)
+			}
+			if !utf8.ValidString(msg.Body) || msg.ID != "ID" {
+				t.Errorf("%v: unexpected message %q", policy, m)
+			}
+			bodies = append(bodies, msg.Body)
+		}
+
+		switch policy {
+		case MessageSizeTruncate:
+			if len(bodies) != 1 || !strings.HasPrefix(body, bodies[0]) || len(bodies[0]) < 20 {
+				t.Errorf("unexpected truncated bodies: %q", bodies)
+			}
+		case MessageSizeSplit:
+			if len(bodies) < 2 || strings.Join(bodies, "") != body {
+				t.Errorf("unexpected split bodies: %q", bodies)
+			}
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package syslog
+
+import (
+	"errors"
+	"expvar"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// Logger statistics. See Logger.Stats.
+type Stats struct {
+	// The number of messages written successfully.
+	Sent uint64
+
+	// The number of messages which could not be written due to an error.
+	Failed uint64
+
+	// The number of messages dropped, because they were written while waiting
+	// to reconnect and Config.DropDuringBackoff is set, because the queue was
+	// full (see Config.QueueOverflow), because they were discarded by
+	// Logger.CloseContext, or because they exceeded Config.RateLimit.
+	Dropped uint64
+
+	// The number of times a connection has been established after the first.
+	Reconnects uint64
+
+	// The number of bytes written to connections, including framing. This
+	// includes any part of a message written before a write failed.
+	BytesSent uint64
+
+	// The number of messages which could not be encoded, for example because
+	// a GELF message was too large to be chunked. These messages are also
+	// counted in Failed.
+	EncodeErrors uint64
+
+	// The number of times writing to a connection failed, causing it to be
+	// discarded. As a failed write is retried once on a new connection, this
+	// may exceed the number of messages counted in Failed.
+	WriteErrors uint64
+
+	// The number of attempts made to establish a connection, successful or
+	// not, including the first. Each attempt may try several targets.
+	ConnectAttempts uint64
+
+	// The total time for which the logger has waited to reconnect after a
+	// connection was lost or could not be established (see
+	// Config.ConnectBackoff).
+	BackoffTime time.Duration
+}
+
+// Returns statistics about the logger. This may be called at any time, even
+// after the logger has been closed.
+func (l *Logger) Stats() Stats {
+	return Stats{
+		Sent:            l.sent.Load(),
+		Failed:          l.failed.Load(),
+		Dropped:         l.dropped.Load(),
+		Reconnects:      l.reconnects.Load(),
+		BytesSent:       l.bytesSent.Load(),
+		EncodeErrors:    l.encodeErrors.Load(),
+		WriteErrors:     l.writeErrors.Load(),
+		ConnectAttempts: l.connectAttempts.Load(),
+		BackoffTime:     time.Duration(l.backoffTime.Load()),
+	}
+}
+
+// Publishes the logger's statistics using expvar. See Config.ExpvarName.
+func (l *Logger) publishStats(name string) error {
+	if expvar.Get(name) != nil {
+		return errors.New("expvar name already in use: " + name)
+	}
+
+	expvar.Publish(name, expvar.Func(func() any {
+		return l.Stats()
+	}))
+	return nil
+}
+
+// Counts the bytes successfully written to the underlying writer.
+type statsWriter struct {
+	w io.Writer
+	n *atomic.Uint64
+}
+
+func (w *statsWriter) Write(b []byte) (int, error) {
+	n, err := w.w.Write(b)
+	w.n.Add(uint64(n))
+	return n, err
+}
@@ -0,0 +1,66 @@
+package syslog
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	// Published names cannot be removed, so a unique name is needed if the test
+	// is run repeatedly.
+	name := fmt.Sprintf("syslog-stats-test-%d", time.Now().UnixNano())
+	fail := false
+	log, err := New(Config{
+		Network:        "udp",
+		Address:        "192.0.2.1",
+		ProcName:       "app",
+		ProcID:         "-",
+		HostName:       "host",
+		Protocol:       ProtocolV0Net,
+		ConnectBackoff: &ConstantBackoff{Delay: time.Hour},
+		ExpvarName:     name,
+		DialFunc: func(ctx context.Context, net, addr string) (io.WriteCloser, error) {
+			return &flakyConn{fail: &fail}, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("cannot instantiate: %v", err)
+	}
+	defer log.Close()
+
+	msg := Message{Time: time.Date(2006, 1, 2, 15, 4, 5, 0, time.Local), Body: "x"}
+	if err := log.Write(context.Background(), msg); err != nil {
+		t.Fatalf("cannot write: %v", err)
+	}
+
+	// The write fails, and as the backoff delay has not elapsed since the
+	// first connection, the logger must wait an hour to reconnect.
+	fail = true
+	if err := log.Write(context.Background(), msg); err == nil {
+		t.Fatalf("expected write to fail")
+	}
+
+	st := log.Stats()
+	n := uint64(len("<0>Jan  2 15:04:05 host app: x"))
+	if st.Sent != 1 || st.Failed != 1 || st.BytesSent != n || st.WriteErrors != 1 ||
+		st.EncodeErrors != 0 || st.ConnectAttempts != 1 || st.BackoffTime < 59*time.Minute {
+		t.Errorf("unexpected stats: %+v", st)
+	}
+
+	var published Stats
+	if err := json.Unmarshal([]byte(expvar.Get(name).String()), &published); err != nil {
+		t.Fatalf("cannot decode published stats: %v", err)
+	}
+	if published != st {
+		t.Errorf("expected published stats %+v, got %+v", st, published)
+	}
+
+	if _, err := New(Config{ExpvarName: name}); err == nil {
+		t.Errorf("expected duplicate expvar name to be rejected")
+	}
+}
@@ -0,0 +1,109 @@
+package syslog
+
+import (
+	"sync"
+	"time"
+)
+
+// The status of a Logger, for example for use in a health check. See
+// Logger.Status.
+type Status struct {
+	// Whether the logger currently has a connection.
+	Connected bool
+
+	// The network and address of the target connected to. These are empty if
+	// the logger is not connected.
+	Network string
+	Address string
+
+	// The protocol, framing and BOM mode used on the connection. Unless they
+	// were specified in the Config, these are determined automatically for
+	// each connection, so they may vary if there are several targets. They
+	// are the zero values if the logger is not connected.
+	Protocol Protocol
+	Framing  Framing
+	BOMMode  BOMMode
+
+	// The last error which occurred connecting or writing, if any, and the time
+	// it occurred. This is not cleared when a connection is reestablished;
+	// compare LastErrorTime to LastWriteTime to determine whether the error is
+	// still relevant.
+	LastError     error
+	LastErrorTime time.Time
+
+	// The time a message was last written successfully, or the zero value if
+	// none has been.
+	LastWriteTime time.Time
+
+	// Message and connection counters.
+	Stats
+}
+
+// Returns the status of the logger. This does not wait for any write in
+// progress, so it may be called at any time, even after the logger has been
+// closed.
+func (l *Logger) Status() Status {
+	st := l.status.get()
+	st.Stats = l.Stats()
+	return st
+}
+
+// Tracks the connection state of a Logger. It has its own mutex so that the
+// status can be retrieved while a write is in progress.
+type loggerStatus struct {
+	mutex         sync.Mutex
+	status        Status
+	everConnected bool
+}
+
+func (s *loggerStatus) get() Status {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.status
+}
+
+// Records that a connection has been established, returning true if this is
+// a reconnection.
+func (s *loggerStatus) setConnected(target connTarget, p Protocol, f Framing, b BOMMode) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.status.Connected = true
+	s.status.Network = target.Network
+	s.status.Address = target.Address
+	s.status.Protocol = p
+	s.status.Framing = f
+	s.status.BOMMode = b
+
+	reconnect := s.everConnected
+	s.everConnected = true
+	return reconnect
+}
+
+func (s *loggerStatus) setDisconnected() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.status.Connected = false
+	s.status.Network = ""
+	s.status.Address = ""
+	s.status.Protocol = ProtocolAuto
+	s.status.Framing = FramingAuto
+	s.status.BOMMode = BOMModeAuto
+}
+
+func (s *loggerStatus) setError(err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.status.LastError = err
+	s.status.LastErrorTime = time.Now()
+}
+
+func (s *loggerStatus) setWritten() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.status.LastWriteTime = time.Now()
+}
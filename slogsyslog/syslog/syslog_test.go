@@ -2,8 +2,14 @@ package syslog
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 // test
@@ -72,3 +78,364 @@ func TestSyslog(t *testing.T) {
 		//time.Sleep(1 * time.Second)
 	}
 }
+
+func TestWriteTimeout(t *testing.T) {
+	// A peer which accepts connections but never reads from them.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("cannot listen: %v", err)
+	}
+	defer l.Close()
+
+	var accepted atomic.Int32
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer c.Close()
+			accepted.Add(1)
+		}
+	}()
+
+	log, err := New(Config{
+		Network:      "tcp",
+		Address:      l.Addr().String(),
+		WriteTimeout: 50 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("cannot instantiate: %v", err)
+	}
+	defer log.Close()
+
+	body := strings.Repeat("x", 256*1024)
+	deadline := time.Now().Add(10 * time.Second)
+	for accepted.Load() < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("write did not time out")
+		}
+		log.Write(context.Background(), Message{Body: body})
+	}
+}
+
+func TestStatus(t *testing.T) {
+	srv := NewServer(ServerConfig{})
+	defer srv.Close()
+
+	addr, err := srv.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("cannot listen: %v", err)
+	}
+
+	log, err := New(Config{
+		Network: "tcp",
+		Address: addr.String(),
+	})
+	if err != nil {
+		t.Fatalf("cannot instantiate: %v", err)
+	}
+
+	if st := log.Status(); st.Connected || st.Sent != 0 || !st.LastWriteTime.IsZero() {
+		t.Errorf("unexpected initial status: %+v", st)
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := log.Write(context.Background(), Message{Body: "x"}); err != nil {
+			t.Fatalf("cannot write: %v", err)
+		}
+	}
+
+	st := log.Status()
+	if !st.Connected || st.Network != "tcp" || st.Address != addr.String() ||
+		st.Sent != 3 || st.Failed != 0 || st.Reconnects != 0 || st.LastWriteTime.IsZero() || st.LastError != nil {
+		t.Errorf("unexpected status: %+v", st)
+	}
+
+	log.Close()
+	if err := log.Write(context.Background(), Message{}); err != errClosed {
+		t.Errorf("expected errClosed, got %v", err)
+	}
+
+	st = log.Status()
+	if st.Connected || st.Network != "" || st.Sent != 3 || st.Failed != 1 {
+		t.Errorf("unexpected status after close: %+v", st)
+	}
+}
+
+// A connection which fails writes on demand.
+type failingConn struct {
+	fail bool
+}
+
+func (c *failingConn) Write(b []byte) (int, error) {
+	if c.fail {
+		return 0, errors.New("write failed")
+	}
+	return len(b), nil
+}
+
+func (c *failingConn) Close() error {
+	return nil
+}
+
+func TestCallbacks(t *testing.T) {
+	var events []string
+	var dialErr error
+	c := &failingConn{}
+
+	var log *Logger
+	log, err := New(Config{
+		Network:        "udp",
+		Address:        "192.0.2.1:514",
+		ConnectBackoff: &ConstantBackoff{Delay: time.Nanosecond},
+		DialFunc: func(ctx context.Context, net, addr string) (io.WriteCloser, error) {
+			if dialErr != nil {
+				return nil, dialErr
+			}
+			return c, nil
+		},
+		OnConnect: func(network, address string) {
+			events = append(events, "connect "+network+" "+address)
+		},
+		OnDisconnect: func(network, address string, err error) {
+			events = append(events, fmt.Sprintf("disconnect %s %s %v", network, address, err))
+
+			// The logger may be used from within callbacks.
+			log.Status()
+		},
+		OnReconnectFailure: func(err error, retryAt time.Time) {
+			events = append(events, fmt.Sprintf("failure %v", err))
+		},
+	})
+	if err != nil {
+		t.Fatalf("cannot instantiate: %v", err)
+	}
+
+	log.Write(context.Background(), Message{})
+	c.fail = true
+	dialErr = errors.New("dial failed")
+	time.Sleep(time.Millisecond)
+	log.Write(context.Background(), Message{})
+	c.fail = false
+	dialErr = nil
+	time.Sleep(time.Millisecond)
+	log.Write(context.Background(), Message{})
+	log.Close()
+
+	expected := []string{
+		"connect udp 192.0.2.1:514",
+		"disconnect udp 192.0.2.1:514 write failed",
+		"failure dial failed",
+		"connect udp 192.0.2.1:514",
+		"disconnect udp 192.0.2.1:514 <nil>",
+	}
+	if strings.Join(events, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected events %q, got %q", expected, events)
+	}
+}
+
+func TestTargets(t *testing.T) {
+	for _, policy := range []TargetPolicy{TargetFailover, TargetRoundRobin} {
+		var dialed []string
+		fail := false
+		log, err := New(Config{
+			Targets: []Target{
+				{"udp", "192.0.2.1"},
+				{"udp", "192.0.2.2:1514"},
+				{"udp", "192.0.2.3"},
+			},
+			TargetPolicy:   policy,
+			ConnectBackoff: &ConstantBackoff{Delay: time.Nanosecond},
+			DialFunc: func(ctx context.Context, net, addr string) (io.WriteCloser, error) {
+				dialed = append(dialed, addr)
+				if addr == "192.0.2.3:514" {
+					return nil, errors.New("dial failed")
+				}
+				return &flakyConn{fail: &fail}, nil
+			},
+		})
+		if err != nil {
+			t.Fatalf("cannot instantiate: %v", err)
+		}
+
+		// Each write after the first fails once, causing a reconnection.
+		for i := 0; i < 3; i++ {
+			fail = i > 0
+			time.Sleep(time.Millisecond)
+			if err := log.Write(context.Background(), Message{}); err != nil {
+				t.Errorf("cannot write: %v", err)
+			}
+		}
+		log.Close()
+
+		expected := "192.0.2.1:514 192.0.2.1:514 192.0.2.1:514"
+		if policy == TargetRoundRobin {
+			expected = "192.0.2.1:514 192.0.2.2:1514 192.0.2.3:514 192.0.2.1:514"
+		}
+		if got := strings.Join(dialed, " "); got != expected {
+			t.Errorf("%v: expected %q, got %q", policy, expected, got)
+		}
+	}
+}
+
+func TestTargetFailover(t *testing.T) {
+	log, err := New(Config{
+		Targets: []Target{{"udp", "192.0.2.1"}, {"udp", "192.0.2.2"}},
+		DialFunc: func(ctx context.Context, net, addr string) (io.WriteCloser, error) {
+			if addr == "192.0.2.1:514" {
+				return nil, errors.New("dial failed")
+			}
+			return &failingConn{}, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("cannot instantiate: %v", err)
+	}
+	defer log.Close()
+
+	if err := log.Write(context.Background(), Message{}); err != nil {
+		t.Errorf("cannot write: %v", err)
+	}
+	if st := log.Status(); st.Address != "192.0.2.2:514" {
+		t.Errorf("expected secondary target to be used, got %q", st.Address)
+	}
+}
+
+func TestPerConnectionProtocol(t *testing.T) {
+	fail := false
+	log, err := New(Config{
+		Targets: []Target{
+			{"unixgram", "/nonexistent/log"},
+			{"udp", "192.0.2.1"},
+		},
+		TargetPolicy:   TargetRoundRobin,
+		ConnectBackoff: &ConstantBackoff{Delay: time.Nanosecond},
+		DialFunc: func(ctx context.Context, net, addr string) (io.WriteCloser, error) {
+			return &flakyConn{fail: &fail}, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("cannot instantiate: %v", err)
+	}
+	defer log.Close()
+
+	// The first write uses the UNIX target; the second fails once, causing a
+	// reconnection to the UDP target.
+	expected := []struct {
+		Network  string
+		Protocol Protocol
+		Framing  Framing
+		BOMMode  BOMMode
+	}{
+		{"unixgram", ProtocolV0Local, FramingNone, BOMModeNever},
+		{"udp", ProtocolV1Net, FramingNone, BOMModeAlways},
+	}
+	for i, e := range expected {
+		fail = i > 0
+		time.Sleep(time.Millisecond)
+		if err := log.Write(context.Background(), Message{}); err != nil {
+			t.Fatalf("cannot write: %v", err)
+		}
+
+		st := log.Status()
+		if st.Network != e.Network || st.Protocol != e.Protocol || st.Framing != e.Framing || st.BOMMode != e.BOMMode {
+			t.Errorf("%d: expected %v, got %+v", i, e, st)
+		}
+	}
+}
+
+// A connection whose next write fails if *fail is set.
+type flakyConn struct {
+	fail *bool
+}
+
+func (c *flakyConn) Write(b []byte) (int, error) {
+	if *c.fail {
+		*c.fail = false
+		return 0, errors.New("write failed")
+	}
+	return len(b), nil
+}
+
+func (c *flakyConn) Close() error {
+	return nil
+}
+
+func TestLocalAddress(t *testing.T) {
+	srv := NewServer(ServerConfig{})
+	defer srv.Close()
+
+	addr, err := srv.Listen("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("cannot listen: %v", err)
+	}
+
+	// Find a free local port.
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("cannot listen: %v", err)
+	}
+	localAddr := pc.LocalAddr().String()
+	pc.Close()
+
+	var loopback string
+	ifs, _ := net.Interfaces()
+	for _, ifi := range ifs {
+		if ifi.Flags&net.FlagLoopback != 0 {
+			loopback = ifi.Name
+			break
+		}
+	}
+
+	configs := []Config{{LocalAddress: localAddr}}
+	if loopback != "" {
+		configs = append(configs, Config{LocalInterface: loopback})
+	}
+
+	for _, cfg := range configs {
+		cfg.Network = "udp"
+		cfg.Address = addr.String()
+
+		log, err := New(cfg)
+		if err != nil {
+			t.Fatalf("cannot instantiate: %v", err)
+		}
+		if err := log.Write(context.Background(), Message{Body: "x"}); err != nil {
+			t.Fatalf("cannot write: %v", err)
+		}
+		log.Close()
+
+		select {
+		case msg := <-srv.Messages():
+			ra := msg.RemoteAddr.(*net.UDPAddr)
+			if !ra.IP.IsLoopback() || (cfg.LocalAddress != "" && ra.String() != localAddr) {
+				t.Errorf("unexpected remote address %v", ra)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out")
+		}
+	}
+
+	_, err = New(Config{Address: "192.0.2.1", LocalAddress: "127.0.0.1", LocalInterface: "lo"})
+	if err == nil {
+		t.Errorf("expected error when specifying both a local address and interface")
+	}
+}
+
+func TestKeepAlive(t *testing.T) {
+	for _, keepAlive := range []time.Duration{0, -1, 30 * time.Second} {
+		log, err := New(Config{Network: "tcp", Address: "192.0.2.1", KeepAlive: keepAlive})
+		if err != nil {
+			t.Fatalf("cannot instantiate: %v", err)
+		}
+
+		d, err := log.dialer("tcp", "192.0.2.1:514")
+		if err != nil {
+			t.Fatalf("cannot create dialer: %v", err)
+		}
+		if d.KeepAlive != keepAlive {
+			t.Errorf("expected keepalive %v, got %v", keepAlive, d.KeepAlive)
+		}
+	}
+}
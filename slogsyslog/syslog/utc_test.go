@@ -0,0 +1,44 @@
+package syslog
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUseUTC(t *testing.T) {
+	ts := time.Date(2021, 10, 11, 9, 25, 0, 0, time.FixedZone("X", 2*3600))
+
+	for _, p := range []Protocol{ProtocolV0Net, ProtocolV1Net} {
+		c := &recordingConn{}
+		log, err := New(Config{
+			Network:  "udp",
+			Address:  "192.0.2.1",
+			Protocol: p,
+			HostName: "host",
+			ProcName: "app",
+			UseUTC:   true,
+			DialFunc: func(ctx context.Context, net, addr string) (io.WriteCloser, error) {
+				return c, nil
+			},
+		})
+		if err != nil {
+			t.Fatalf("cannot instantiate: %v", err)
+		}
+
+		if err := log.Write(context.Background(), Message{Time: ts, Body: "hello"}); err != nil {
+			t.Fatalf("cannot write: %v", err)
+		}
+		log.Close()
+
+		expected := "<0>Oct 11 07:25:00 host"
+		if p == ProtocolV1Net {
+			expected = "<0>1 2021-10-11T07:25:00Z host"
+		}
+		if len(c.written) != 1 || !strings.HasPrefix(c.written[0], expected) {
+			t.Errorf("%v: expected prefix %q, got %q", p, expected, c.written)
+		}
+	}
+}
@@ -16,7 +16,7 @@ func handlerFromFile(f *os.File, format OutputFormat) (slog.Handler, error) {
 
 	if shouldBuffer {
 		bw := bufio.NewWriter(f)
-		w = bw
+		w = bufferedFile{bw, f}
 		flushables = append(flushables, func() {
 			bw.Flush()
 		})
@@ -33,7 +33,6 @@ func handlerFromFile(f *os.File, format OutputFormat) (slog.Handler, error) {
 		ho := &slogwriter.HandlerOptions{
 			AddSource: true,
 			Level:     slog.LevelDebug,
-			NoColor:   shouldInhibitColor,
 		}
 
 		return slogwriter.NewTextHandler(w, ho), nil
@@ -63,19 +62,13 @@ func setupStderr(cfg Config) (slog.Handler, error) {
 	return handlerFromFile(os.Stderr, cfg.StderrFormat)
 }
 
-var shouldInhibitColor = determineShouldInhibitColor()
-
-func determineShouldInhibitColor() bool {
-	v := os.Getenv("NO_COLOR")
-	if v == "force" {
-		return false
-	} else if len(v) > 0 {
-		return true
-	}
-
-	if !isatty.IsTerminal(2) {
-		return true
-	}
+// A buffered writer for a file which reports the file descriptor of the file,
+// so that slogwriter can determine whether it is a terminal.
+type bufferedFile struct {
+	*bufio.Writer
+	f *os.File
+}
 
-	return false
+func (bf bufferedFile) Fd() uintptr {
+	return bf.f.Fd()
 }
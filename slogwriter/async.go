@@ -0,0 +1,154 @@
+package slogwriter
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hlandau/slogkit/slogwriter/internal/buffer"
+	"golang.org/x/exp/slog"
+)
+
+var (
+	// Returned by Handle, and passed to OnError, if a record is dropped because
+	// the queue is full and AsyncDrop is set.
+	ErrQueueFull = errors.New("slogwriter: async queue full, record dropped")
+
+	// Returned by Handle, and passed to OnError, if a record is logged after
+	// the handler has been closed.
+	ErrClosed = errors.New("slogwriter: handler is closed")
+)
+
+// An item queued for writing by the background goroutine.
+type asyncItem struct {
+	h     *commonHandler
+	ctx   context.Context
+	buf   *buffer.Buffer
+	r     slog.Record
+	flush chan struct{} // if non-nil, closed when all earlier items are written
+}
+
+// detachedContext carries the values of a context but not its deadline or
+// cancellation, so that a queued record can still be written after the
+// context passed to Handle has been canceled.
+type detachedContext struct{ parent context.Context }
+
+func (detachedContext) Deadline() (time.Time, bool)         { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}               { return nil }
+func (detachedContext) Err() error                          { return nil }
+func (c detachedContext) Value(key interface{}) interface{} { return c.parent.Value(key) }
+
+// asyncWriter writes formatted records from a bounded queue on a background
+// goroutine. It is shared between a handler and all handlers derived from it.
+type asyncWriter struct {
+	h       *commonHandler
+	ch      chan asyncItem
+	done    chan struct{}
+	dropped uint64 // atomic
+
+	mu     sync.RWMutex // held for reading while sending on ch
+	closed bool
+}
+
+func newAsyncWriter(h *commonHandler) *asyncWriter {
+	aw := &asyncWriter{
+		h:    h,
+		ch:   make(chan asyncItem, h.opts.AsyncQueueSize),
+		done: make(chan struct{}),
+	}
+	go aw.loop()
+	return aw
+}
+
+func (aw *asyncWriter) loop() {
+	defer close(aw.done)
+	for item := range aw.ch {
+		if item.flush != nil {
+			close(item.flush)
+			continue
+		}
+		item.h.write(item.ctx, *item.buf, item.r)
+		item.buf.Free()
+	}
+}
+
+// enqueue queues a formatted record for writing by h, taking ownership of buf.
+func (aw *asyncWriter) enqueue(h *commonHandler, ctx context.Context, buf *buffer.Buffer, r slog.Record) error {
+	err := aw.send(asyncItem{h: h, ctx: detachedContext{ctx}, buf: buf, r: r.Clone()})
+	if err != nil {
+		buf.Free()
+		if h.opts.OnError != nil {
+			h.opts.OnError(err, r)
+		}
+	}
+	return err
+}
+
+func (aw *asyncWriter) send(item asyncItem) error {
+	aw.mu.RLock()
+	defer aw.mu.RUnlock()
+	if aw.closed {
+		return ErrClosed
+	}
+	if !aw.h.opts.AsyncDrop || item.flush != nil {
+		aw.ch <- item
+		return nil
+	}
+	select {
+	case aw.ch <- item:
+		return nil
+	default:
+		atomic.AddUint64(&aw.dropped, 1)
+		return ErrQueueFull
+	}
+}
+
+// flush blocks until all records queued before the call have been written.
+func (aw *asyncWriter) flush() error {
+	ch := make(chan struct{})
+	if err := aw.send(asyncItem{flush: ch}); err != nil {
+		return err
+	}
+	<-ch
+	return nil
+}
+
+// close writes all queued records and stops the background goroutine.
+func (aw *asyncWriter) close() error {
+	aw.mu.Lock()
+	if aw.closed {
+		aw.mu.Unlock()
+		return ErrClosed
+	}
+	aw.closed = true
+	close(aw.ch)
+	aw.mu.Unlock()
+	<-aw.done
+	return nil
+}
+
+// flush implements Flush for TextHandler and JSONHandler.
+func (h *commonHandler) flush() error {
+	if h.async == nil {
+		return nil
+	}
+	return h.async.flush()
+}
+
+// close implements Close for TextHandler and JSONHandler.
+func (h *commonHandler) close() error {
+	if h.async == nil {
+		return nil
+	}
+	return h.async.close()
+}
+
+// dropped implements Dropped for TextHandler and JSONHandler.
+func (h *commonHandler) dropped() uint64 {
+	if h.async == nil {
+		return 0
+	}
+	return atomic.LoadUint64(&h.async.dropped)
+}
@@ -0,0 +1,71 @@
+package slogwriter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+type ctxKey struct{}
+
+func TestAsyncDetachedContext(t *testing.T) {
+	type result struct {
+		err   error
+		value interface{}
+	}
+	results := make(chan result, 1)
+	release := make(chan struct{})
+	h := NewTextHandler(nil, &HandlerOptions{
+		AsyncQueueSize: 4,
+		WriterFunc: func(ctx context.Context, b []byte, r slog.Record) error {
+			<-release
+			results <- result{ctx.Err(), ctx.Value(ctxKey{})}
+			return nil
+		},
+	})
+
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), ctxKey{}, "v"))
+	if err := h.Handle(ctx, slog.NewRecord(time.Now(), slog.LevelInfo, "hello", 0)); err != nil {
+		t.Fatalf("handle: %v", err)
+	}
+	cancel()
+	close(release)
+	if err := h.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	res := <-results
+	if res.err != nil {
+		t.Errorf("writer saw canceled context: %v", res.err)
+	}
+	if res.value != "v" {
+		t.Errorf("context value = %v, want v", res.value)
+	}
+}
+
+func TestAsyncDerivedOnError(t *testing.T) {
+	var parentErrs, childErrs []error
+	h := NewTextHandler(nil, &HandlerOptions{
+		AsyncQueueSize: 1,
+		WriterFunc:     func(ctx context.Context, b []byte, r slog.Record) error { return nil },
+		OnError:        func(err error, r slog.Record) { parentErrs = append(parentErrs, err) },
+	})
+	opts := h.Options()
+	opts.OnError = func(err error, r slog.Record) { childErrs = append(childErrs, err) }
+	h2 := h.WithOptions(&opts)
+
+	if err := h.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if err := h2.Handle(context.Background(), slog.NewRecord(time.Now(), slog.LevelInfo, "hello", 0)); err != ErrClosed {
+		t.Fatalf("handle after close: %v, want ErrClosed", err)
+	}
+	if len(parentErrs) != 0 {
+		t.Errorf("parent OnError called: %v", parentErrs)
+	}
+	if len(childErrs) != 1 || childErrs[0] != ErrClosed {
+		t.Errorf("derived OnError got %v, want [ErrClosed]", childErrs)
+	}
+}
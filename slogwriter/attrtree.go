@@ -0,0 +1,148 @@
+package slogwriter
+
+import (
+	"sort"
+
+	"golang.org/x/exp/slices"
+	"golang.org/x/exp/slog"
+)
+
+// Attributes added using WithAttrs, together with the groups started using
+// WithGroup which were open at the time.
+type GroupedAttrs struct {
+	Groups []string
+	Attrs  []slog.Attr
+}
+
+// An attrNode is a node in a tree of attributes built when handling a record
+// if commonHandler.deferAttrs is true. Attributes in groups with the same name
+// are merged into a single group node.
+type attrNode struct {
+	key      string
+	value    slog.Value  // for leaves
+	group    bool        // whether this is a group node
+	children []*attrNode // for groups
+}
+
+// deferAttrs reports whether attributes added using WithAttrs must be kept
+// until a record is handled, rather than being preformatted, so that they can
+// be sorted or deduplicated together with the attributes of the record.
+func (h *commonHandler) deferAttrs() bool {
+	return h.opts.SortAttrs || h.opts.DedupeAttrs
+}
+
+// child returns the group child node with the given key, creating it if
+// necessary. If dedupe is set, a non-group child with the same key is
+// replaced.
+func (n *attrNode) child(key string, dedupe bool) *attrNode {
+	for i, c := range n.children {
+		if c.key != key {
+			continue
+		}
+		if c.group {
+			return c
+		}
+		if dedupe {
+			c = &attrNode{key: key, group: true}
+			n.children[i] = c
+			return c
+		}
+	}
+	c := &attrNode{key: key, group: true}
+	n.children = append(n.children, c)
+	return c
+}
+
+// path returns the descendant group node with the given path, creating nodes
+// as necessary.
+func (n *attrNode) path(groups []string, dedupe bool) *attrNode {
+	for _, g := range groups {
+		n = n.child(g, dedupe)
+	}
+	return n
+}
+
+// add adds an attribute to the group node n, which has the given path. If
+// DedupeAttrs is set, any existing child with the same key is replaced,
+// retaining its position. Groups are passed to ReplaceGroup, if set.
+func (n *attrNode) add(a slog.Attr, path []string, opts *HandlerOptions) {
+	dedupe := opts.DedupeAttrs
+	a.Value = a.Value.Resolve()
+	if rg := opts.ReplaceGroup; rg != nil && a.Value.Kind() == slog.KindGroup && a.Key != "" {
+		a = rg(path, a)
+		if a.Key == "" {
+			return
+		}
+		a.Value = a.Value.Resolve()
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		g := n
+		if a.Key != "" {
+			g = n.child(a.Key, dedupe)
+			path = append(path[:len(path):len(path)], a.Key)
+		}
+		for _, aa := range a.Value.Group() {
+			g.add(aa, path, opts)
+		}
+		return
+	}
+	leaf := &attrNode{key: a.Key, value: a.Value}
+	if dedupe {
+		for i, c := range n.children {
+			if c.key == a.Key {
+				n.children[i] = leaf
+				return
+			}
+		}
+	}
+	n.children = append(n.children, leaf)
+}
+
+// appendAttrTree appends the attributes added using WithAttrs and the
+// attributes of the record, after building them into a tree. This is used
+// instead of preformatted attributes if commonHandler.deferAttrs is true.
+func (s *handleState) appendAttrTree(r slog.Record) {
+	var root attrNode
+	opts := &s.h.opts
+	dedupe := opts.DedupeAttrs
+	for _, ga := range s.h.attrs {
+		g := root.path(ga.Groups, dedupe)
+		for _, a := range ga.Attrs {
+			g.add(a, ga.Groups, opts)
+		}
+	}
+	g := root.path(s.h.groups, dedupe)
+	n := 0
+	r.Attrs(func(a slog.Attr) bool {
+		if max := s.h.opts.MaxAttrCount; max > 0 && n >= max {
+			s.truncated = true
+			return false
+		}
+		g.add(a, s.h.groups, opts)
+		n++
+		return true
+	})
+	s.appendAttrNodes(root.children)
+}
+
+func (s *handleState) appendAttrNodes(nodes []*attrNode) {
+	if s.h.opts.SortAttrs {
+		nodes = slices.Clone(nodes)
+		sort.SliceStable(nodes, func(i, j int) bool {
+			return nodes[i].key < nodes[j].key
+		})
+	}
+	for _, n := range nodes {
+		if !n.group {
+			s.appendAttr(slog.Attr{Key: n.key, Value: n.value})
+			continue
+		}
+		// Output only non-empty groups.
+		if len(n.children) == 0 {
+			continue
+		}
+		s.openGroup(n.key)
+		s.appendAttrNodes(n.children)
+		s.closeGroup(n.key)
+	}
+}
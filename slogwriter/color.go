@@ -0,0 +1,56 @@
+package slogwriter
+
+import (
+	"io"
+	"os"
+
+	"github.com/mattn/go-isatty"
+)
+
+// Determines whether output is coloured using ANSI escape sequences.
+type ColorMode int
+
+const (
+	// Colour output unless the NO_COLOR environment variable is set to a
+	// non-empty value, or the writer is a file (or has an Fd method) which is
+	// not a terminal. Writers which are not files are assumed to support
+	// colour. If NO_COLOR is set to "force", output is always coloured.
+	ColorAuto ColorMode = iota
+
+	// Always colour output.
+	ColorAlways
+
+	// Never colour output. This is equivalent to setting NoColor.
+	ColorNever
+)
+
+// detectColor reports whether output to w should be coloured if ColorMode is
+// ColorAuto.
+func detectColor(w io.Writer) bool {
+	switch v := os.Getenv("NO_COLOR"); v {
+	case "force":
+		return true
+	case "":
+	default:
+		return false
+	}
+
+	f, ok := w.(hasFd)
+	if !ok {
+		return true
+	}
+	return isatty.IsTerminal(f.Fd()) || isatty.IsCygwinTerminal(f.Fd())
+}
+
+// wantColor determines whether output to w should be coloured according to
+// the options, preparing w for coloured output if necessary.
+func (h *commonHandler) wantColor(w io.Writer) bool {
+	switch {
+	case h.opts.NoColor || h.opts.ColorMode == ColorNever:
+		return false
+	case h.opts.ColorMode == ColorAuto && !detectColor(w):
+		return false
+	default:
+		return enableConsoleColor(w) || h.opts.ColorMode == ColorAlways
+	}
+}
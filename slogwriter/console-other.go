@@ -0,0 +1,12 @@
+//go:build !windows
+// +build !windows
+
+package slogwriter
+
+import "io"
+
+// enableConsoleColor prepares w for the output of ANSI escape sequences and
+// reports whether they can be used. Nothing needs to be done on this platform.
+func enableConsoleColor(w io.Writer) bool {
+	return true
+}
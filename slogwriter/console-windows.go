@@ -0,0 +1,46 @@
+//go:build windows
+// +build windows
+
+package slogwriter
+
+import (
+	"io"
+	"syscall"
+)
+
+var (
+	kernel32           = syscall.NewLazyDLL("kernel32.dll")
+	procSetConsoleMode = kernel32.NewProc("SetConsoleMode")
+)
+
+const enableVirtualTerminalProcessing = 0x0004
+
+// enableConsoleColor prepares w for the output of ANSI escape sequences and
+// reports whether they can be used.
+//
+// Legacy Windows consoles print ANSI escape sequences literally unless Virtual
+// Terminal Processing is enabled on the console handle. If w is not a console
+// (for example, a file or a pipe), escape sequences are passed through
+// unchanged and it is up to the consumer to interpret them.
+func enableConsoleColor(w io.Writer) bool {
+	f, ok := w.(hasFd)
+	if !ok {
+		return true
+	}
+
+	h := syscall.Handle(f.Fd())
+	var mode uint32
+	if err := syscall.GetConsoleMode(h, &mode); err != nil {
+		// Not a console.
+		return true
+	}
+
+	if mode&enableVirtualTerminalProcessing != 0 {
+		return true
+	}
+
+	// Fails on versions of Windows older than Windows 10, which do not support
+	// Virtual Terminal Processing at all.
+	r, _, _ := procSetConsoleMode.Call(uintptr(h), uintptr(mode|enableVirtualTerminalProcessing))
+	return r != 0
+}
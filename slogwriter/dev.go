@@ -0,0 +1,94 @@
+package slogwriter
+
+import (
+	"io"
+	"math"
+	"strconv"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+// The time at which the package was initialised, used as an approximation of
+// the process start time by RelativeTime.
+var processStart = time.Now()
+
+// appendRelativeTime appends the time elapsed between process start and t in
+// seconds, e.g. "+12.345s".
+func appendRelativeTime(dst []byte, t time.Time) []byte {
+	d := t.Sub(processStart)
+	if d >= 0 {
+		dst = append(dst, '+')
+	}
+	dst = strconv.AppendFloat(dst, d.Seconds(), 'f', 3, 64)
+	return append(dst, 's')
+}
+
+// The theme used by NewDevHandler. Attributes are dimmed so that the message
+// stands out.
+var DevTheme = Theme{
+	Time: "\x1b[90m",
+	Levels: []LevelStyle{
+		{slog.LevelError + 4, "\x1b[1;91m"},
+		{slog.LevelError, "\x1b[91m"},
+		{slog.LevelWarn, "\x1b[93m"},
+		{slog.LevelInfo, "\x1b[94m"},
+		{math.MinInt, "\x1b[90m"},
+	},
+	Message:       "\x1b[1m",
+	Key:           "\x1b[2m",
+	Value:         "\x1b[2m",
+	Source:        "\x1b[90m",
+	NumberValue:   "\x1b[2;36m",
+	BoolValue:     "\x1b[2;35m",
+	DurationValue: "\x1b[2;34m",
+	TimeValue:     "\x1b[2;32m",
+	ErrorValue:    "\x1b[31m",
+}
+
+// devLevelIcon returns the icon used by NewDevHandler for a level.
+func devLevelIcon(l slog.Level) string {
+	switch {
+	case l > slog.LevelError:
+		return "‼"
+	case l >= slog.LevelError:
+		return "✖"
+	case l >= slog.LevelWarn:
+		return "⚠"
+	case l >= slog.LevelInfo:
+		return "ℹ"
+	case l >= slog.LevelDebug:
+		return "•"
+	default:
+		return "·"
+	}
+}
+
+// DevHandlerOptions returns the options used by NewDevHandler. They can be
+// modified before being passed to NewTextHandler to customise the preset.
+func DevHandlerOptions() *HandlerOptions {
+	return &HandlerOptions{
+		Level:           slog.LevelDebug,
+		LevelString:     devLevelIcon,
+		Theme:           &DevTheme,
+		ColorValues:     true,
+		FormatTemplate:  "{level} {msg} {attrs} {source} {time}",
+		QuoteMode:       QuoteModeNever,
+		RelativeTime:    true,
+		MultiLine:       true,
+		MultiLineErrors: true,
+	}
+}
+
+// NewDevHandler returns a TextHandler with a preset configuration intended
+// for local development. Records are output with the message first, preceded
+// by an icon indicating the level, followed by dimmed attributes, with values
+// coloured according to their type, and the time elapsed since the process
+// started. Values are not quoted. Errors and values containing newlines are
+// written on their own lines after the record. Debug records are included.
+//
+// The configuration can be customised by modifying the result of
+// DevHandlerOptions and passing it to NewTextHandler.
+func NewDevHandler(w io.Writer) *TextHandler {
+	return NewTextHandler(w, DevHandlerOptions())
+}
@@ -6,4 +6,12 @@
 //   - Support for coloured output using ANSI escape codes
 //
 //   - Support for using a callback function to output log data including record context data
+//
+//   - Support for writing records asynchronously using a bounded queue
+//
+//   - A preset configuration for local development (see NewDevHandler)
+//
+// The handlers in this package implement the golang.org/x/exp/slog Handler
+// interface. For variants implementing the standard library log/slog Handler
+// interface, see the stdslog subpackage.
 package slogwriter
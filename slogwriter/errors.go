@@ -0,0 +1,45 @@
+package slogwriter
+
+import (
+	"fmt"
+	"strconv"
+
+	"golang.org/x/exp/slog"
+)
+
+// Maximum depth of error chains rendered when ErrorChain is set. This guards
+// against pathological (e.g. cyclic) Unwrap implementations.
+const maxErrorDepth = 16
+
+// errorValue converts an error to a group value for rendering when ErrorChain
+// or ErrorTypes is set.
+//
+// The group contains the error message under the key "msg", the error type
+// under the key "type" if ErrorTypes is set, and, if ErrorChain is set, the
+// wrapped error under the key "cause" or, for errors wrapping multiple errors,
+// a group of wrapped errors under the key "causes".
+func (h *commonHandler) errorValue(err error, depth int) slog.Value {
+	as := []slog.Attr{slog.String("msg", err.Error())}
+	if h.opts.ErrorTypes {
+		as = append(as, slog.String("type", fmt.Sprintf("%T", err)))
+	}
+	if h.opts.ErrorChain && depth < maxErrorDepth {
+		switch e := err.(type) {
+		case interface{ Unwrap() error }:
+			if cause := e.Unwrap(); cause != nil {
+				as = append(as, slog.Attr{Key: "cause", Value: h.errorValue(cause, depth+1)})
+			}
+		case interface{ Unwrap() []error }:
+			var causes []slog.Attr
+			for i, cause := range e.Unwrap() {
+				if cause != nil {
+					causes = append(causes, slog.Attr{Key: strconv.Itoa(i), Value: h.errorValue(cause, depth+1)})
+				}
+			}
+			if len(causes) > 0 {
+				as = append(as, slog.Attr{Key: "causes", Value: slog.GroupValue(causes...)})
+			}
+		}
+	}
+	return slog.GroupValue(as...)
+}
@@ -0,0 +1,97 @@
+package slogwriter
+
+import (
+	"reflect"
+	"sync"
+
+	"golang.org/x/exp/slog"
+)
+
+// A ValueFormatter converts a value of a particular type to the slog.Value
+// which should be output in its place. For example, it may return a string
+// value containing a purpose-built rendering of the value, or a group value
+// exposing its fields.
+type ValueFormatter func(v any) slog.Value
+
+// A FormatterRegistry maps Go types to ValueFormatters. It can be set in
+// HandlerOptions.Formatters to customise how values of particular types are
+// rendered, rather than having them formatted using fmt or encoding/json.
+//
+// The zero value is an empty registry. A FormatterRegistry is safe for
+// concurrent use.
+type FormatterRegistry struct {
+	mu       sync.RWMutex
+	types    map[reflect.Type]ValueFormatter
+	ifaces   []ifaceFormatter
+	resolved map[reflect.Type]ValueFormatter // cache of lookups; nil for no match
+}
+
+type ifaceFormatter struct {
+	t reflect.Type
+	f ValueFormatter
+}
+
+// Registers a formatter for values of type t. If t is an interface type, the
+// formatter is used for any value implementing the interface for which no
+// formatter is registered for its concrete type. Interface formatters are
+// tried in the order they were registered.
+func (fr *FormatterRegistry) Register(t reflect.Type, f ValueFormatter) {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+
+	if t.Kind() == reflect.Interface {
+		fr.ifaces = append(fr.ifaces, ifaceFormatter{t, f})
+	} else {
+		if fr.types == nil {
+			fr.types = map[reflect.Type]ValueFormatter{}
+		}
+		fr.types[t] = f
+	}
+	fr.resolved = nil
+}
+
+// Registers a formatter for values of type T, which may be an interface type.
+// For example:
+//
+//	var fr slogwriter.FormatterRegistry
+//	slogwriter.RegisterFormatter(&fr, func(ip net.IP) slog.Value {
+//		return slog.StringValue(ip.String())
+//	})
+func RegisterFormatter[T any](fr *FormatterRegistry, f func(v T) slog.Value) {
+	fr.Register(reflect.TypeOf((*T)(nil)).Elem(), func(v any) slog.Value {
+		return f(v.(T))
+	})
+}
+
+// lookup returns the formatter for the given value, or nil if there is none.
+func (fr *FormatterRegistry) lookup(v any) ValueFormatter {
+	t := reflect.TypeOf(v)
+	if t == nil {
+		return nil
+	}
+
+	fr.mu.RLock()
+	f, ok := fr.resolved[t]
+	fr.mu.RUnlock()
+	if ok {
+		return f
+	}
+
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+
+	f, ok = fr.types[t]
+	if !ok {
+		for _, iff := range fr.ifaces {
+			if t.Implements(iff.t) {
+				f = iff.f
+				break
+			}
+		}
+	}
+	if fr.resolved == nil {
+		fr.resolved = map[reflect.Type]ValueFormatter{}
+	}
+	fr.resolved[t] = f
+	return f
+}
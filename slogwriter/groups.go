@@ -0,0 +1,146 @@
+package slogwriter
+
+import (
+	"strings"
+
+	"github.com/hlandau/slogkit/slogwriter/internal/buffer"
+	"golang.org/x/exp/slog"
+)
+
+// Specifies how attributes in groups are rendered in text output.
+type GroupStyle int
+
+const (
+	// Prefix keys with the names of the groups containing them, separated by
+	// GroupSeparator, e.g. "http.status=200".
+	GroupStyleDotted GroupStyle = iota
+
+	// Write the path of the groups containing the following attributes in
+	// brackets, e.g. "[http] status=200 method=GET", whenever it changes.
+	// Top-level attributes following attributes in a group are preceded by
+	// "[]".
+	GroupStyleBracketed
+
+	// Write attributes in groups after the rest of the record, as indented
+	// blocks headed by the group name, e.g.
+	//
+	//     INF request a=1
+	//       http:
+	//         status=200
+	//
+	// Top-level attributes are written as usual.
+	GroupStyleNested
+
+	// Omit group names entirely, e.g. "status=200". Keys may be ambiguous.
+	GroupStyleFlatten
+)
+
+// Separator for group names in the key prefix when the prefix is not output
+// directly.
+const internalGroupSep = "\x00"
+
+// groupSep returns the separator written after each group name in the key
+// prefix, for text output.
+func (h *commonHandler) groupSep() string {
+	switch h.opts.GroupStyle {
+	case GroupStyleBracketed, GroupStyleNested:
+		return internalGroupSep
+	case GroupStyleFlatten:
+		return ""
+	default:
+		if h.opts.GroupSeparator != "" {
+			return h.opts.GroupSeparator
+		}
+		return string(keyComponentSep)
+	}
+}
+
+// groupPathComponents returns the group names in a key prefix using
+// internalGroupSep.
+func groupPathComponents(prefix string) []string {
+	if prefix == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(prefix, internalGroupSep), internalGroupSep)
+}
+
+// dottedPrefix returns a key prefix using internalGroupSep with the group
+// names separated by dots instead.
+func dottedPrefix(prefix string) string {
+	return strings.ReplaceAll(prefix, internalGroupSep, string(keyComponentSep))
+}
+
+// appendPrefixedKey appends the key with the current key prefix for text
+// output, according to GroupStyle.
+func (s *handleState) appendPrefixedKey(key string) {
+	prefix := string(*s.prefix)
+	switch s.h.opts.GroupStyle {
+	case GroupStyleBracketed:
+		if s.buf == s.lines {
+			// Multi-line values are written with the full key.
+			s.appendString(dottedPrefix(prefix) + key)
+			return
+		}
+		if prefix != s.groupPath {
+			s.buf.WriteByte('[')
+			s.buf.WriteString(strings.TrimSuffix(dottedPrefix(prefix), string(keyComponentSep)))
+			s.buf.WriteString("] ")
+			s.groupPath = prefix
+		}
+		s.appendString(key)
+	case GroupStyleNested:
+		s.appendString(dottedPrefix(prefix) + key)
+	default:
+		// TODO: optimize by avoiding allocation.
+		s.appendString(prefix + key)
+	}
+}
+
+// wantNested reports whether an attribute should be written as part of a
+// nested block.
+func (s *handleState) wantNested() bool {
+	return s.h.opts.GroupStyle == GroupStyleNested && !s.h.json && s.prefix != nil && len(*s.prefix) > 0
+}
+
+// Indentation per level of nesting for GroupStyleNested.
+const nestedIndent = "  "
+
+// appendNested writes an attribute in a group to s.lines for GroupStyleNested,
+// writing headers for any groups not written by the previous nested attribute.
+func (s *handleState) appendNested(key string, v slog.Value, keyStyle, valueStyle string) {
+	if s.lines == nil {
+		s.lines = buffer.New()
+	}
+	buf, sep := s.buf, s.sep
+	s.buf = s.lines
+	defer func() {
+		s.buf, s.sep = buf, sep
+	}()
+
+	path := string(*s.prefix)
+	groups := groupPathComponents(path)
+	last := groupPathComponents(s.groupPath)
+	n := 0
+	for n < len(groups) && n < len(last) && groups[n] == last[n] {
+		n++
+	}
+	for i := n; i < len(groups); i++ {
+		s.buf.WriteByte('\n')
+		s.buf.WriteString(strings.Repeat(nestedIndent, i+1))
+		st := s.startStyle(keyStyle)
+		s.appendString(groups[i])
+		s.buf.WriteByte(':')
+		s.endStyle(st)
+	}
+	s.groupPath = path
+
+	s.buf.WriteByte('\n')
+	s.buf.WriteString(strings.Repeat(nestedIndent, len(groups)+1))
+	st := s.startStyle(keyStyle)
+	s.appendString(key)
+	s.buf.WriteByte('=')
+	s.endStyle(st)
+	st = s.startStyle(valueStyle)
+	s.appendValue(v)
+	s.endStyle(st)
+}
@@ -5,14 +5,16 @@
 package slogwriter
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
-	"path/filepath"
+	"runtime"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
-	_ "unsafe"
+	"unicode/utf8"
 
 	"github.com/hlandau/slogkit/slogwriter/internal/buffer"
 	"golang.org/x/exp/slices"
@@ -62,25 +64,68 @@ func (h *defaultHandler) WithGroup(name string) slog.Handler {
 
 type commonHandler struct {
 	json              bool // true => output JSON; false => output text
+	noColor           bool // whether colour is disabled by NoColor or ColorMode
 	opts              HandlerOptions
 	preformattedAttrs []byte
-	groupPrefix       string   // for text: prefix of groups opened in preformatting
-	groups            []string // all groups started from WithGroup
-	nOpenGroups       int      // the number of groups opened in preformattedAttrs
-	mu                sync.Mutex
-	w                 io.Writer
+	preformattedLines []byte         // for text: multi-line values from preformatting
+	groupPrefix       string         // for text: prefix of groups opened in preformatting
+	groups            []string       // all groups started from WithGroup
+	nOpenGroups       int            // the number of groups opened in preformattedAttrs
+	layout            []layoutItem   // for text: parsed FormatTemplate, or nil
+	attrs             []GroupedAttrs // attrs from WithAttrs
+	async             *asyncWriter   // if AsyncQueueSize is set
+	wrapWidthCache    *wrapWidthCache
+
+	preformattedTruncated bool                // whether any values in preformattedAttrs were truncated
+	preformattedSet       map[string]struct{} // for SkipDuplicateAttrs: fingerprints of preformatted attrs; read-only once set
+	preformattedGroupPath string              // for text: handleState.groupPath after preformatting
+	mu                    sync.Mutex
+	w                     io.Writer
+}
+
+// newCommonHandler returns a commonHandler writing to w using a copy of opts,
+// without any attributes or groups.
+func newCommonHandler(json bool, w io.Writer, opts *HandlerOptions) *commonHandler {
+	h := &commonHandler{
+		json: json,
+		w:    w,
+		opts: *opts,
+	}
+	if !json || h.opts.ColorJSON {
+		h.noColor = !h.wantColor(w)
+	}
+	if !json && h.opts.FormatTemplate != "" {
+		h.layout = parseLayout(h.opts.FormatTemplate)
+	}
+	if h.opts.AsyncQueueSize > 0 {
+		h.async = newAsyncWriter(h)
+	}
+	if h.opts.Wrap && h.opts.WrapWidth <= 0 {
+		h.wrapWidthCache = &wrapWidthCache{}
+	}
+	return h
 }
 
 func (h *commonHandler) clone() *commonHandler {
 	// We can't use assignment because we can't copy the mutex.
 	return &commonHandler{
 		json:              h.json,
+		noColor:           h.noColor,
 		opts:              h.opts,
 		preformattedAttrs: slices.Clip(h.preformattedAttrs),
+		preformattedLines: slices.Clip(h.preformattedLines),
 		groupPrefix:       h.groupPrefix,
 		groups:            slices.Clip(h.groups),
 		nOpenGroups:       h.nOpenGroups,
-		w:                 h.w,
+		layout:            h.layout,
+		attrs:             slices.Clip(h.attrs),
+		async:             h.async,
+		wrapWidthCache:    h.wrapWidthCache,
+
+		preformattedTruncated: h.preformattedTruncated,
+		preformattedSet:       h.preformattedSet,
+		preformattedGroupPath: h.preformattedGroupPath,
+		w:                     h.w,
 	}
 }
 
@@ -94,30 +139,56 @@ func (h *commonHandler) enabled(l slog.Level) bool {
 	return l >= minLevel
 }
 
-//go:linkname recordSource golang.org/x/exp/slog.Record.source
-func recordSource(r slog.Record) *slog.Source
-
-func recordSourceEx(r slog.Record) *slog.Source {
-	s := recordSource(r)
-	s.File = filepath.Base(s.File)
-	return s
+// recordSource returns the source location of the record, or nil if the
+// record has no PC.
+func recordSource(r slog.Record) *slog.Source {
+	if r.PC == 0 {
+		return nil
+	}
+	fs := runtime.CallersFrames([]uintptr{r.PC})
+	f, _ := fs.Next()
+	return &slog.Source{
+		Function: f.Function,
+		File:     f.File,
+		Line:     f.Line,
+	}
 }
 
 func (h *commonHandler) withAttrs(as []slog.Attr) *commonHandler {
 	h2 := h.clone()
+	h2.attrs = append(h2.attrs, GroupedAttrs{
+		Groups: slices.Clip(h.groups),
+		Attrs:  slices.Clone(as),
+	})
+	if h.deferAttrs() {
+		return h2
+	}
 	// Pre-format the attributes as an optimization.
 	prefix := buffer.New()
 	defer prefix.Free()
 	prefix.WriteString(h.groupPrefix)
 	state := h2.newHandleState((*buffer.Buffer)(&h2.preformattedAttrs), false, "", prefix)
+	state.lines = (*buffer.Buffer)(&h2.preformattedLines)
 	defer state.free()
 	if len(h2.preformattedAttrs) > 0 {
 		state.sep = h.attrSep()
 	}
 	state.openGroups()
+	if h.opts.SkipDuplicateAttrs {
+		h2.preformattedSet = make(map[string]struct{}, len(h.preformattedSet)+len(as))
+		for k := range h.preformattedSet {
+			h2.preformattedSet[k] = struct{}{}
+		}
+	}
 	for _, a := range as {
-		state.appendAttr(a)
+		if h.opts.SkipDuplicateAttrs {
+			h2.appendPreformattedAttrOnce(&state, a)
+		} else {
+			state.appendAttr(a)
+		}
 	}
+	h2.preformattedTruncated = h2.preformattedTruncated || state.truncated
+	h2.preformattedGroupPath = state.groupPath
 	// Remember the new prefix for later keys.
 	h2.groupPrefix = state.prefix.String()
 	// Remember how many opened groups are in preformattedAttrs,
@@ -126,6 +197,26 @@ func (h *commonHandler) withAttrs(as []slog.Attr) *commonHandler {
 	return h2
 }
 
+// appendPreformattedAttrOnce appends a to the preformatted attributes using
+// s, unless an identical attribute in the same groups has already been
+// preformatted. Multi-line values are always appended.
+func (h *commonHandler) appendPreformattedAttrOnce(s *handleState, a slog.Attr) {
+	start, sep, nLines := len(*s.buf), s.sep, len(*s.lines)
+	s.appendAttr(a)
+	formatted := (*s.buf)[start:]
+	if len(*s.lines) != nLines || len(formatted) <= len(sep) {
+		return
+	}
+	formatted = formatted[len(sep):]
+	fingerprint := strings.Join(h.groups, "\x00") + "\x00" + string(formatted)
+	if _, ok := h.preformattedSet[fingerprint]; ok {
+		*s.buf = (*s.buf)[:start]
+		s.sep = sep
+		return
+	}
+	h.preformattedSet[fingerprint] = struct{}{}
+}
+
 func (h *commonHandler) withGroup(name string) *commonHandler {
 	if name == "" {
 		return h
@@ -135,97 +226,326 @@ func (h *commonHandler) withGroup(name string) *commonHandler {
 	return h2
 }
 
+// withOptions returns a commonHandler writing to the same writer using opts,
+// with the attributes and groups of h. The attributes are formatted again
+// according to opts. The asynchronous queue is shared with h unless the
+// options for it differ.
+func (h *commonHandler) withOptions(opts *HandlerOptions) *commonHandler {
+	o := *opts
+	async := h.async != nil && o.AsyncQueueSize == h.opts.AsyncQueueSize && o.AsyncDrop == h.opts.AsyncDrop
+	if async {
+		o.AsyncQueueSize = 0
+	}
+	h2 := newCommonHandler(h.json, h.w, &o)
+	if async {
+		h2.opts.AsyncQueueSize = h.opts.AsyncQueueSize
+		h2.async = h.async
+	}
+	for _, ga := range h.attrs {
+		for _, g := range ga.Groups[len(h2.groups):] {
+			h2 = h2.withGroup(g)
+		}
+		h2 = h2.withAttrs(ga.Attrs)
+	}
+	for _, g := range h.groups[len(h2.groups):] {
+		h2 = h2.withGroup(g)
+	}
+	return h2
+}
+
 func (h *commonHandler) handle(ctx context.Context, r slog.Record) error {
 	state := h.newHandleState(buffer.New(), true, "", nil)
 	defer state.free()
 	if h.json {
 		state.buf.WriteByte('{')
 	}
-	// Built-in attributes. They are not in a group.
-	stateGroups := state.groups
-	state.groups = nil // So ReplaceAttrs sees no groups instead of the pre groups.
-	rep := h.opts.ReplaceAttr
-	// time
-	if !r.Time.IsZero() {
-		key := slog.TimeKey
-		val := r.Time.Round(0) // strip monotonic to match Attr behavior
-		if rep == nil {
-			if !h.opts.NoColor {
-				state.buf.WriteString("\x1b[90m")
-			}
-			state.appendTime(val)
-			if !h.opts.NoColor {
-				state.buf.WriteString("\x1b[0m")
-			}
-		} else {
-			state.appendAttrEx(slog.Time(key, val), 1)
+	if h.layout != nil && !h.json {
+		state.appendLayout(r, h.layout)
+	} else {
+		state.appendStandardLayout(r)
+	}
+	if h.opts.Wrap && !h.json && state.attrsStart >= 0 {
+		wrap(state.buf, state.attrsStart, h.wrapWidth())
+	}
+	// multi-line values
+	state.buf.Write(h.preformattedLines)
+	if state.lines != nil {
+		state.buf.Write(*state.lines)
+	}
+	state.buf.WriteByte('\n')
+
+	if h.async != nil {
+		buf := buffer.New()
+		buf.Write(*state.buf)
+		return h.async.enqueue(h, ctx, buf, r)
+	}
+	return h.write(ctx, *state.buf, r)
+}
+
+// write writes a formatted record using RecordWriterFunc, WriterFunc or the
+// io.Writer.
+func (h *commonHandler) write(ctx context.Context, b []byte, r slog.Record) error {
+	h.mu.Lock()
+	var err error
+	if h.opts.RecordWriterFunc != nil {
+		err = h.opts.RecordWriterFunc(ctx, b, &RecordInfo{
+			Record:    r,
+			LevelName: h.levelName(r.Level, false),
+			Attrs:     slices.Clip(h.attrs),
+			Groups:    slices.Clip(h.groups),
+		})
+	} else if h.opts.WriterFunc != nil {
+		err = h.opts.WriterFunc(ctx, b, r)
+	} else {
+		_, err = h.w.Write(b)
+	}
+	h.mu.Unlock()
+	if err != nil && h.opts.OnError != nil {
+		h.opts.OnError(err, r)
+	}
+	return err
+}
+
+// appendStandardLayout appends the fields of a record in the standard order.
+func (s *handleState) appendStandardLayout(r slog.Record) {
+	// For text, no space is written before the first field.
+	s.lead = ""
+	nextField := func() {
+		if len(*s.buf) > 0 {
+			s.lead = " "
 		}
 	}
-	// level
-	key := slog.LevelKey
-	val := r.Level
-	if rep == nil {
-		state.buf.WriteString(" ")
-		if !h.opts.NoColor {
-			if val >= slog.LevelError {
-				state.buf.WriteString("\x1b[91m")
-			} else if val >= slog.LevelWarn {
-				state.buf.WriteString("\x1b[93m")
-			} else {
-				state.buf.WriteString("\x1b[0m")
-			}
+	// Built-in attributes. They are not in a group.
+	if s.h.wantTime(r) {
+		s.appendTimeField(r.Time.Round(0)) // strip monotonic to match Attr behavior
+		nextField()
+	}
+	align := s.h.opts.AlignColumns && !s.h.json
+	if !s.h.opts.OmitLevel {
+		start, width := len(*s.buf), len(s.lead)+s.h.levelWidth()
+		s.appendLevelField(r.Level)
+		if align {
+			s.pad(start, width)
 		}
-		state.appendString(val.String()[0:3])
-	} else {
-		if !h.opts.NoColor {
-			state.buf.WriteString("\x1b[1m")
+		nextField()
+	}
+	if s.h.wantMessage(r) {
+		start, width := len(*s.buf), len(s.lead)+s.h.messageWidth()
+		s.appendMessageField(r.Message)
+		if align {
+			s.pad(start, width)
 		}
-		state.appendAttrEx(slog.Any(key, val), 2)
+		nextField()
 	}
-	if !h.opts.NoColor {
-		state.buf.WriteString("\x1b[0m")
+	var src *slog.Source
+	if s.h.wantSource() {
+		src = recordSource(r)
 	}
-	key = slog.MessageKey
-	msg := r.Message
-	if rep == nil {
-		state.buf.WriteString(" ")
-		if !h.opts.NoColor {
-			state.buf.WriteString("\x1b[1m")
+	if src != nil && (s.h.json || align) {
+		// For JSON, the source must be written before any groups are opened.
+		start, width := len(*s.buf), len(s.lead)+s.h.sourceWidth()
+		s.appendSourceField(src)
+		if align {
+			s.pad(start, width)
 		}
-		state.appendString(msg)
-		if !h.opts.NoColor {
-			state.buf.WriteString("\x1b[0m")
+		nextField()
+	}
+	s.sep = s.lead
+	if s.h.json {
+		s.sep = ""
+		if len(*s.buf) > 1 {
+			s.sep = s.h.attrSep()
 		}
+	}
+	start := len(*s.buf)
+	s.appendNonBuiltIns(r)
+	if src != nil && !s.h.json && !align {
+		s.appendSourceField(src)
+	}
+	if align && len(*s.buf) == start {
+		// No attributes; remove any trailing padding.
+		*s.buf = bytes.TrimRight(*s.buf, " ")
+	}
+}
+
+// wantTime reports whether the time of the record should be output.
+func (h *commonHandler) wantTime(r slog.Record) bool {
+	return !r.Time.IsZero() && !h.opts.OmitTime
+}
+
+// wantMessage reports whether the message of the record should be output.
+func (h *commonHandler) wantMessage(r slog.Record) bool {
+	return r.Message != "" || !h.opts.OmitMessageKey
+}
+
+// wantSource reports whether the source location should be output.
+func (h *commonHandler) wantSource() bool {
+	return h.opts.AddSource && !h.opts.OmitSource
+}
+
+// appendBuiltIn appends a built-in attribute using appendAttrEx with the
+// given flag, styled using the given style.
+func (s *handleState) appendBuiltIn(a slog.Attr, style string, flag int) {
+	st := s.startStyle(style)
+	groups, quoteMode := s.groups, s.quoteMode
+	s.groups = nil // So ReplaceAttr sees no groups for built-in attributes.
+	if flag != 3 {
+		// QuoteMode applies only to the message and attribute values.
+		s.quoteMode = QuoteModeAuto
+	}
+	// MaxValueLength applies only to attribute values.
+	s.builtIn = flag != 0
+	s.appendAttrEx(a, flag)
+	s.builtIn = false
+	s.groups, s.quoteMode = groups, quoteMode
+	s.endStyle(st)
+}
+
+func (s *handleState) appendTimeField(t time.Time) {
+	if loc := s.h.opts.TimeLocation; loc != nil {
+		t = t.In(loc)
+	}
+	style := s.h.theme().Time
+	if s.h.json {
+		s.appendBuiltIn(slog.Time(slog.TimeKey, t), style, 4)
+	} else if s.h.opts.ReplaceAttr == nil {
+		st := s.startStyle(style)
+		if s.h.opts.RelativeTime {
+			*s.buf = appendRelativeTime(*s.buf, t)
+		} else {
+			s.appendTime(t)
+		}
+		s.endStyle(st)
 	} else {
-		state.appendAttrEx(slog.String(key, msg), 3)
+		s.appendBuiltIn(slog.Time(slog.TimeKey, t), style, 1)
 	}
-	state.groups = stateGroups // Restore groups passed to ReplaceAttrs.
-	state.sep = h.attrSep()
-	state.appendNonBuiltIns(r)
-	// source
-	if h.opts.AddSource {
-		if !h.opts.NoColor {
-			state.buf.WriteString("\x1b[90m")
+}
+
+func (s *handleState) appendLevelField(l slog.Level) {
+	style := s.h.theme().levelStyle(l)
+	if s.h.json {
+		s.appendBuiltIn(slog.Any(slog.LevelKey, l), style, 4)
+	} else if s.h.opts.ReplaceAttr == nil {
+		s.buf.WriteString(s.lead)
+		st := s.startStyle(style)
+		s.appendString(s.h.levelName(l, true))
+		s.endStyle(st)
+	} else {
+		s.appendBuiltIn(slog.Any(slog.LevelKey, l), style, 2)
+	}
+}
+
+func (s *handleState) appendMessageField(msg string) {
+	style := s.h.theme().Message
+	if s.h.json {
+		s.appendBuiltIn(slog.String(slog.MessageKey, msg), style, 4)
+	} else if s.h.opts.ReplaceAttr == nil {
+		s.buf.WriteString(s.lead)
+		st := s.startStyle(style)
+		s.appendStringValue(sanitize(msg, s.h.opts.Sanitize))
+		s.endStyle(st)
+	} else {
+		s.appendBuiltIn(slog.String(slog.MessageKey, msg), style, 3)
+	}
+}
+
+// appendSourceField appends the source location. src must contain the full
+// path of the source file.
+func (s *handleState) appendSourceField(src *slog.Source) {
+	flag := 2
+	if s.h.json {
+		flag = 4
+	}
+	link := s.h.opts.SourceLinks && !s.h.json && s.h.color()
+	if link {
+		s.buf.WriteString(s.lead)
+		s.buf.WriteString(osc8Start)
+		s.buf.WriteString(s.h.sourceLink(src))
+		s.buf.WriteString(osc8End)
+	}
+	src = s.h.formatSource(src)
+	if link {
+		lead := s.lead
+		s.lead = ""
+		s.appendBuiltIn(slog.Any(slog.SourceKey, src), s.h.theme().Source, flag)
+		s.lead = lead
+		s.buf.WriteString(osc8Start)
+		s.buf.WriteString(osc8End)
+	} else {
+		s.appendBuiltIn(slog.Any(slog.SourceKey, src), s.h.theme().Source, flag)
+	}
+}
+
+// pad writes spaces so that the visible width of the output written since
+// start is at least width.
+func (s *handleState) pad(start, width int) {
+	for n := visibleWidth((*s.buf)[start:]); n < width; n++ {
+		s.buf.WriteByte(' ')
+	}
+}
+
+// visibleWidth returns the number of characters in b, excluding ANSI escape
+// sequences.
+func visibleWidth(b []byte) int {
+	n := 0
+	for i := 0; i < len(b); {
+		if b[i] == '\x1b' && i+1 < len(b) && b[i+1] == '[' {
+			// Skip CSI sequence up to and including the final byte.
+			i += 2
+			for i < len(b) && (b[i] < 0x40 || b[i] > 0x7E) {
+				i++
+			}
+			i++
+			continue
 		}
-		state.appendAttrEx(slog.Any(slog.SourceKey, recordSourceEx(r)), 2)
-		if !h.opts.NoColor {
-			state.buf.WriteString("\x1b[0m")
+		if b[i] == '\x1b' && i+1 < len(b) && b[i+1] == ']' {
+			// Skip OSC sequence up to and including the string terminator.
+			i += 2
+			for i < len(b) && b[i] != '\a' && !(b[i] == '\x1b' && i+1 < len(b) && b[i+1] == '\\') {
+				i++
+			}
+			if i < len(b) && b[i] == '\x1b' {
+				i++
+			}
+			i++
+			continue
 		}
+		_, size := utf8.DecodeRune(b[i:])
+		i += size
+		n++
 	}
-	state.buf.WriteByte('\n')
+	return n
+}
 
-	h.mu.Lock()
-	defer h.mu.Unlock()
-	var err error
-	if h.opts.WriterFunc != nil {
-		err = h.opts.WriterFunc(ctx, *state.buf, r)
+func (s *handleState) appendNonBuiltIns(r slog.Record) {
+	s.attrsStart = len(*s.buf)
+	s.prefix = buffer.New()
+	defer s.prefix.Free()
+	if s.h.deferAttrs() {
+		s.appendAttrTree(r)
 	} else {
-		_, err = h.w.Write(*state.buf)
+		s.appendPreformattedAndRecordAttrs(r)
+	}
+	// The stack trace and truncation marker are not in any group.
+	s.prefix.Reset()
+	if s.h.wantStack(r.Level) {
+		groups := s.groups
+		s.groups = nil
+		s.appendAttr(slog.String(stackKey, recordStack(r)))
+		s.groups = groups
+	}
+	if s.truncated || s.h.preformattedTruncated {
+		s.buf.WriteString(s.sep)
+		s.appendKey(truncatedKey)
+		*s.buf = strconv.AppendBool(*s.buf, true)
+	}
+	if s.h.json {
+		// Close the top-level object.
+		s.buf.WriteByte('}')
 	}
-	return err
 }
 
-func (s *handleState) appendNonBuiltIns(r slog.Record) {
+func (s *handleState) appendPreformattedAndRecordAttrs(r slog.Record) {
 	// preformatted Attrs
 	if len(s.h.preformattedAttrs) > 0 {
 		s.buf.WriteString(s.sep)
@@ -234,12 +554,16 @@ func (s *handleState) appendNonBuiltIns(r slog.Record) {
 	}
 	// Attrs in Record -- unlike the built-in ones, they are in groups started
 	// from WithGroup.
-	s.prefix = buffer.New()
-	defer s.prefix.Free()
 	s.prefix.WriteString(s.h.groupPrefix)
 	s.openGroups()
+	n := 0
 	r.Attrs(func(a slog.Attr) bool {
+		if max := s.h.opts.MaxAttrCount; max > 0 && n >= max {
+			s.truncated = true
+			return false
+		}
 		s.appendAttr(a)
+		n++
 		return true
 	})
 	if s.h.json {
@@ -247,11 +571,104 @@ func (s *handleState) appendNonBuiltIns(r slog.Record) {
 		for range s.h.groups {
 			s.buf.WriteByte('}')
 		}
-		// Close the top-level object.
-		s.buf.WriteByte('}')
 	}
 }
 
+// Key of the attribute added to records which have had values or attributes
+// omitted due to MaxValueLength or MaxAttrCount.
+const truncatedKey = "truncated"
+
+// stringValue prepares a string value for output by sanitizing and truncating
+// it according to Sanitize and MaxValueLength.
+func (s *handleState) stringValue(str string) string {
+	return s.truncateValue(sanitize(str, s.h.opts.Sanitize))
+}
+
+// truncateValue truncates a string value to MaxValueLength characters, if set.
+// Values of built-in attributes are not truncated.
+func (s *handleState) truncateValue(str string) string {
+	max := s.h.opts.MaxValueLength
+	if max <= 0 || len(str) <= max || s.builtIn {
+		return str
+	}
+	i := 0
+	for n := 0; n < max && i < len(str); n++ {
+		_, size := utf8.DecodeRuneInString(str[i:])
+		i += size
+	}
+	if i >= len(str) {
+		return str
+	}
+	s.truncated = true
+	return str[:i] + "…"
+}
+
+// levelName returns the name to be output for the given level. If short is
+// set, names not configured via LevelNames or LevelString are abbreviated to
+// three characters.
+func (h *commonHandler) levelName(l slog.Level, short bool) string {
+	if name, ok := h.opts.LevelNames[l]; ok {
+		return name
+	}
+	if h.opts.LevelString != nil {
+		return h.opts.LevelString(l)
+	}
+	name := l.String()
+	if short {
+		return name[0:3]
+	}
+	return name
+}
+
+// Default column widths used when AlignColumns is set.
+const (
+	defaultMessageWidth = 40
+	defaultSourceWidth  = 20
+)
+
+// levelWidth returns the width of the level column when aligning columns.
+func (h *commonHandler) levelWidth() int {
+	w := 3
+	for _, name := range h.opts.LevelNames {
+		if n := utf8.RuneCountInString(name); n > w {
+			w = n
+		}
+	}
+	return w
+}
+
+// messageWidth returns the width of the message column when aligning columns.
+func (h *commonHandler) messageWidth() int {
+	if h.opts.MessageWidth > 0 {
+		return h.opts.MessageWidth
+	}
+	return defaultMessageWidth
+}
+
+// sourceWidth returns the width of the source column when aligning columns.
+func (h *commonHandler) sourceWidth() int {
+	if h.opts.SourceWidth > 0 {
+		return h.opts.SourceWidth
+	}
+	return defaultSourceWidth
+}
+
+// theme returns the theme to use for coloured output.
+func (h *commonHandler) theme() *Theme {
+	if h.opts.Theme != nil {
+		return h.opts.Theme
+	}
+	if h.json {
+		return &DefaultJSONTheme
+	}
+	return &DefaultTheme
+}
+
+// color reports whether ANSI escape sequences should be written.
+func (h *commonHandler) color() bool {
+	return !h.noColor && (!h.json || h.opts.ColorJSON)
+}
+
 // attrSep returns the separator between attributes.
 func (h *commonHandler) attrSep() string {
 	if h.json {
@@ -260,6 +677,24 @@ func (h *commonHandler) attrSep() string {
 	return " "
 }
 
+// Information about a record passed to RecordWriterFunc.
+type RecordInfo struct {
+	// The record being written.
+	Record slog.Record
+
+	// The name of the record's level, as determined by LevelNames and
+	// LevelString, if set. Names are not abbreviated.
+	LevelName string
+
+	// The attributes added to the handler using WithAttrs, in the order they
+	// were added, together with the groups open when they were added.
+	Attrs []GroupedAttrs
+
+	// The groups started using WithGroup, which contain the record's
+	// attributes.
+	Groups []string
+}
+
 // handleState holds state for a single call to commonHandler.handle.
 // The initial value of sep determines whether to emit a separator
 // before the next key, after which it stays true.
@@ -267,9 +702,18 @@ type handleState struct {
 	h       *commonHandler
 	buf     *buffer.Buffer
 	freeBuf bool           // should buf be freed?
+	lead    string         // for text: written before built-in fields other than time
+	lines   *buffer.Buffer // for text: multi-line values, written after the record
 	sep     string         // separator to write before next key
 	prefix  *buffer.Buffer // for text: key prefix
 	groups  *[]string      // pool-allocated slice of active groups, for ReplaceAttr
+
+	quoteMode  QuoteMode // for text: quoting of values
+	attrsStart int       // for text: offset in buf of the attributes, or -1
+	groupPath  string    // for text: key prefix of the last attribute, for GroupStyleBracketed and GroupStyleNested
+
+	truncated bool // whether any values were truncated
+	builtIn   bool // a built-in attribute is being appended, so values are not truncated
 }
 
 var groupPool = sync.Pool{New: func() any {
@@ -282,10 +726,15 @@ func (h *commonHandler) newHandleState(buf *buffer.Buffer, freeBuf bool, sep str
 		h:       h,
 		buf:     buf,
 		freeBuf: freeBuf,
+		lead:    " ",
 		sep:     sep,
 		prefix:  prefix,
+
+		quoteMode:  h.opts.QuoteMode,
+		attrsStart: -1,
+		groupPath:  h.preformattedGroupPath,
 	}
-	if h.opts.ReplaceAttr != nil {
+	if h.opts.ReplaceAttr != nil || h.opts.ReplaceGroup != nil {
 		s.groups = groupPool.Get().(*[]string)
 		*s.groups = append(*s.groups, h.groups[:h.nOpenGroups]...)
 	}
@@ -295,6 +744,9 @@ func (h *commonHandler) newHandleState(buf *buffer.Buffer, freeBuf bool, sep str
 func (s *handleState) free() {
 	if s.freeBuf {
 		s.buf.Free()
+		if s.lines != nil {
+			s.lines.Free()
+		}
 	}
 	if gs := s.groups; gs != nil {
 		*gs = (*gs)[:0]
@@ -302,6 +754,24 @@ func (s *handleState) free() {
 	}
 }
 
+// startStyle writes the given ANSI escape sequence if coloured output is
+// enabled and reports whether it did so. The result should be passed to
+// endStyle.
+func (s *handleState) startStyle(style string) bool {
+	if style == "" || !s.h.color() {
+		return false
+	}
+	s.buf.WriteString(style)
+	return true
+}
+
+// endStyle resets styling if startStyle wrote a style.
+func (s *handleState) endStyle(started bool) {
+	if started {
+		s.buf.WriteString(ansiReset)
+	}
+}
+
 func (s *handleState) openGroups() {
 	for _, n := range s.h.groups[s.h.nOpenGroups:] {
 		s.openGroup(n)
@@ -315,12 +785,13 @@ const keyComponentSep = '.'
 // with the given name.
 func (s *handleState) openGroup(name string) {
 	if s.h.json {
+		s.buf.WriteString(s.sep)
 		s.appendKey(name)
 		s.buf.WriteByte('{')
 		s.sep = ""
-	} else {
+	} else if sep := s.h.groupSep(); sep != "" {
 		s.prefix.WriteString(name)
-		s.prefix.WriteByte(keyComponentSep)
+		s.prefix.WriteString(sep)
 	}
 	// Collect group names for ReplaceAttr.
 	if s.groups != nil {
@@ -332,8 +803,8 @@ func (s *handleState) openGroup(name string) {
 func (s *handleState) closeGroup(name string) {
 	if s.h.json {
 		s.buf.WriteByte('}')
-	} else {
-		(*s.prefix) = (*s.prefix)[:len(*s.prefix)-len(name)-1 /* for keyComponentSep */]
+	} else if sep := s.h.groupSep(); sep != "" {
+		(*s.prefix) = (*s.prefix)[:len(*s.prefix)-len(name)-len(sep)]
 	}
 	s.sep = s.h.attrSep()
 	if s.groups != nil {
@@ -367,11 +838,22 @@ func (s *handleState) appendAttr(a slog.Attr) {
 }
 
 func (s *handleState) appendAttrEx(a slog.Attr, flag int) {
-	if rep := s.h.opts.ReplaceAttr; rep != nil && a.Value.Kind() != slog.KindGroup {
-		var gs []string
-		if s.groups != nil {
-			gs = *s.groups
+	var gs []string
+	if s.groups != nil {
+		gs = *s.groups
+	}
+	if rg := s.h.opts.ReplaceGroup; rg != nil && a.Key != "" {
+		// Resolve before checking the kind, so that LogValuers returning groups
+		// are passed to ReplaceGroup.
+		a.Value = a.Value.Resolve()
+		if a.Value.Kind() == slog.KindGroup {
+			a = rg(gs, a)
+			if a.Key == "" {
+				return
+			}
 		}
+	}
+	if rep := s.h.opts.ReplaceAttr; rep != nil && a.Value.Kind() != slog.KindGroup {
 		// Resolve before calling ReplaceAttr, so the user doesn't have to.
 		a.Value = a.Value.Resolve()
 		a = rep(gs, a)
@@ -381,16 +863,49 @@ func (s *handleState) appendAttrEx(a slog.Attr, flag int) {
 	if attrIsEmpty(a) {
 		return
 	}
+	// Special case: Level, for built-in attributes.
+	if v := a.Value; v.Kind() == slog.KindAny && flag != 0 {
+		if l, ok := v.Any().(slog.Level); ok {
+			a.Value = slog.StringValue(s.h.levelName(l, false))
+		}
+	}
+	// Special case: relative time, for the built-in time attribute.
+	if v := a.Value; v.Kind() == slog.KindTime && flag == 1 && s.h.opts.RelativeTime {
+		a.Value = slog.StringValue(string(appendRelativeTime(nil, v.Time())))
+	}
 	// Special case: Source.
 	if v := a.Value; v.Kind() == slog.KindAny {
 		if src, ok := v.Any().(*slog.Source); ok {
 			if s.h.json {
 				a.Value = sourceGroup(src)
+			} else if src.File == "" {
+				// SourceFormatFunction.
+				a.Value = slog.StringValue(fmt.Sprintf("%s:%d", src.Function, src.Line))
 			} else {
 				a.Value = slog.StringValue(fmt.Sprintf("%s:%d", src.File, src.Line))
 			}
 		}
 	}
+	// Custom formatters.
+	if v := a.Value; v.Kind() == slog.KindAny && s.h.opts.Formatters != nil {
+		if f := s.h.opts.Formatters.lookup(v.Any()); f != nil {
+			a.Value = f(v.Any()).Resolve()
+		}
+	}
+	// Special case: multi-line errors.
+	if v := a.Value; v.Kind() == slog.KindAny && flag == 0 && s.h.opts.MultiLineErrors && !s.h.json {
+		if err, ok := v.Any().(error); ok {
+			keyStyle, valueStyle := s.h.theme().attrStyles(a, s.h.opts.ColorValues && !s.h.json)
+			s.appendMultiLine(a.Key, err.Error(), keyStyle, valueStyle)
+			return
+		}
+	}
+	// Special case: errors.
+	if v := a.Value; v.Kind() == slog.KindAny && flag == 0 && (s.h.opts.ErrorChain || s.h.opts.ErrorTypes) {
+		if err, ok := v.Any().(error); ok {
+			a.Value = s.h.errorValue(err, 0)
+		}
+	}
 	if a.Value.Kind() == slog.KindGroup {
 		attrs := a.Value.Group()
 		// Output only non-empty groups.
@@ -408,11 +923,37 @@ func (s *handleState) appendAttrEx(a slog.Attr, flag int) {
 		}
 	} else {
 		if flag == 0 {
+			keyStyle, valueStyle := s.h.theme().attrStyles(a, s.h.opts.ColorValues && !s.h.json)
+			if s.appendJSONDocument(a.Key, a.Value, keyStyle) {
+				return
+			}
+			if s.isMultiLine(a.Value) {
+				s.appendMultiLine(a.Key, a.Value.String(), keyStyle, valueStyle)
+				return
+			}
+			if s.wantNested() {
+				s.appendNested(a.Key, a.Value, keyStyle, valueStyle)
+				return
+			}
+			s.buf.WriteString(s.sep)
+			st := s.startStyle(keyStyle)
 			s.appendKey(a.Key)
-		} else if flag == 2 {
-			s.buf.WriteString(" <")
-		} else {
-			s.buf.WriteString(" ")
+			s.endStyle(st)
+			st = s.startStyle(valueStyle)
+			s.appendValue(a.Value)
+			s.endStyle(st)
+			return
+		}
+		if flag == 4 {
+			// Built-in attribute in JSON output; styled by the caller.
+			s.buf.WriteString(s.sep)
+			s.appendKey(a.Key)
+			s.appendValue(a.Value)
+			return
+		}
+		s.buf.WriteString(s.lead)
+		if flag == 2 {
+			s.buf.WriteString("<")
 		}
 		s.appendValue(a.Value)
 		if flag == 2 {
@@ -421,13 +962,67 @@ func (s *handleState) appendAttrEx(a slog.Attr, flag int) {
 	}
 }
 
+// isMultiLine reports whether v should be written as a multi-line value.
+func (s *handleState) isMultiLine(v slog.Value) bool {
+	return s.h.opts.MultiLine && !s.h.json && v.Kind() == slog.KindString &&
+		strings.IndexByte(v.String(), '\n') >= 0
+}
+
+// Indentation used for multi-line values.
+const (
+	multiLineKeyIndent   = "  "
+	multiLineValueIndent = "    "
+)
+
+// appendMultiLine writes a multi-line value to s.lines. The key is written on
+// its own line, followed by each line of the value, indented.
+func (s *handleState) appendMultiLine(key, value, keyStyle, valueStyle string) {
+	value = s.stringValue(value)
+	s.appendMultiLineFunc(key, value, keyStyle, func(line string) {
+		st := s.startStyle(valueStyle)
+		s.buf.WriteString(line)
+		s.endStyle(st)
+	})
+}
+
+// appendMultiLineFunc is like appendMultiLine, but calls appendLine to write
+// each line of the value to s.buf. The value is written as-is.
+func (s *handleState) appendMultiLineFunc(key, value, keyStyle string, appendLine func(line string)) {
+	if s.lines == nil {
+		s.lines = buffer.New()
+	}
+	buf, sep := s.buf, s.sep
+	s.buf = s.lines
+	defer func() {
+		s.buf, s.sep = buf, sep
+	}()
+
+	if s.h.opts.GroupStyle == GroupStyleNested {
+		// Subsequent nested attributes must repeat their group headers.
+		s.groupPath = ""
+	}
+	s.buf.WriteByte('\n')
+	s.buf.WriteString(multiLineKeyIndent)
+	st := s.startStyle(keyStyle)
+	s.appendKey(key)
+	s.endStyle(st)
+	for _, line := range strings.Split(strings.TrimRight(value, "\n"), "\n") {
+		s.buf.WriteByte('\n')
+		s.buf.WriteString(multiLineValueIndent)
+		appendLine(line)
+	}
+}
+
 func (s *handleState) appendError(err error) {
 	s.appendString(fmt.Sprintf("!ERROR:%v", err))
 }
 
+// appendKey appends the key and the key-value separator. The caller is
+// responsible for writing s.sep beforehand.
 func (s *handleState) appendKey(key string) {
-	s.buf.WriteString(s.sep)
-	if s.prefix != nil {
+	if s.prefix != nil && !s.h.json {
+		s.appendPrefixedKey(key)
+	} else if s.prefix != nil {
 		// TODO: optimize by avoiding allocation.
 		s.appendString(string(*s.prefix) + key)
 	} else {
@@ -469,15 +1064,53 @@ func (s *handleState) appendValue(v slog.Value) {
 }
 
 func (s *handleState) appendTime(t time.Time) {
+	if loc := s.h.opts.TimeLocation; loc != nil {
+		t = t.In(loc)
+	}
 	if s.h.json {
 		appendJSONTime(s, t)
 	} else {
-		writeTimeRFC3339Millis(s.buf, t)
+		writeTimeRFC3339(s.buf, t, s.h.opts.TimePrecision.digits())
+	}
+}
+
+// Specifies the precision of times in text output.
+type TimePrecision int
+
+const (
+	// Output times with millisecond precision.
+	TimePrecisionMillisecond TimePrecision = iota
+
+	// Output times with second precision.
+	TimePrecisionSecond
+
+	// Output times with microsecond precision.
+	TimePrecisionMicrosecond
+
+	// Output times with nanosecond precision.
+	TimePrecisionNanosecond
+)
+
+// digits returns the number of fractional digits of a second to output.
+func (p TimePrecision) digits() int {
+	switch p {
+	case TimePrecisionSecond:
+		return 0
+	case TimePrecisionMicrosecond:
+		return 6
+	case TimePrecisionNanosecond:
+		return 9
+	default:
+		return 3
 	}
 }
 
+// writeTimeRFC3339 writes t in RFC 3339 format with the given number of
+// fractional digits of a second, which must be 0, 3, 6 or 9. Fractional
+// seconds are truncated, not rounded.
+//
 // This takes half the time of Time.AppendFormat.
-func writeTimeRFC3339Millis(buf *buffer.Buffer, t time.Time) {
+func writeTimeRFC3339(buf *buffer.Buffer, t time.Time, digits int) {
 	year, month, day := t.Date()
 	buf.WritePosIntWidth(year, 4)
 	buf.WriteByte('-')
@@ -491,9 +1124,14 @@ func writeTimeRFC3339Millis(buf *buffer.Buffer, t time.Time) {
 	buf.WritePosIntWidth(min, 2)
 	buf.WriteByte(':')
 	buf.WritePosIntWidth(sec, 2)
-	ns := t.Nanosecond()
-	buf.WriteByte('.')
-	buf.WritePosIntWidth(ns/1e6, 3)
+	if digits > 0 {
+		ns := t.Nanosecond()
+		for i := digits; i < 9; i++ {
+			ns /= 10
+		}
+		buf.WriteByte('.')
+		buf.WritePosIntWidth(ns, digits)
+	}
 	_, offsetSeconds := t.Zone()
 	if offsetSeconds == 0 {
 		buf.WriteByte('Z')
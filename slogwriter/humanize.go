@@ -0,0 +1,85 @@
+package slogwriter
+
+import (
+	"strconv"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+// A ByteSize is a number of bytes. If HandlerOptions.HumanByteSizes is set,
+// TextHandler renders values of this type using binary (IEC) units, for
+// example "4.2 MiB". Otherwise, and always for JSONHandler, the raw number is
+// output.
+type ByteSize int64
+
+// Returns an Attr for a size in bytes. See ByteSize.
+func Size(key string, n int64) slog.Attr {
+	return slog.Any(key, ByteSize(n))
+}
+
+var byteSizeUnits = []string{"KiB", "MiB", "GiB", "TiB", "PiB", "EiB"}
+
+// appendHumanByteSize appends a human-readable representation of a byte size.
+func appendHumanByteSize(dst []byte, n ByteSize) []byte {
+	if n < 0 {
+		dst = append(dst, '-')
+		if n == -n {
+			// Minimum int64; cannot be negated.
+			return append(dst, "8.0 EiB"...)
+		}
+		n = -n
+	}
+	if n < 1024 {
+		dst = strconv.AppendInt(dst, int64(n), 10)
+		return append(dst, " B"...)
+	}
+	f := float64(n) / 1024
+	i := 0
+	for f >= 1024 && i < len(byteSizeUnits)-1 {
+		f /= 1024
+		i++
+	}
+	dst = strconv.AppendFloat(dst, f, 'f', 1, 64)
+	dst = append(dst, ' ')
+	return append(dst, byteSizeUnits[i]...)
+}
+
+// appendHumanDuration appends a human-readable representation of a duration,
+// such as "350ms" or "1.2s". Durations of a minute or more are rounded to the
+// nearest second.
+func appendHumanDuration(dst []byte, d time.Duration) []byte {
+	if d < 0 {
+		dst = append(dst, '-')
+		d = -d
+	}
+	var unit time.Duration
+	var suffix string
+	switch {
+	case d < 0:
+		// Minimum int64; cannot be negated.
+		return append(dst, (-d).String()[1:]...)
+	case d >= time.Minute:
+		return append(dst, d.Round(time.Second).String()...)
+	case d >= time.Second:
+		unit, suffix = time.Second, "s"
+	case d >= time.Millisecond:
+		unit, suffix = time.Millisecond, "ms"
+	case d >= time.Microsecond:
+		unit, suffix = time.Microsecond, "µs"
+	default:
+		dst = strconv.AppendInt(dst, int64(d), 10)
+		return append(dst, "ns"...)
+	}
+	f := float64(d) / float64(unit)
+	prec := 1
+	if f >= 100 {
+		prec = 0
+	}
+	dst = strconv.AppendFloat(dst, f, 'f', prec, 64)
+	if prec > 0 && dst[len(dst)-1] == '0' {
+		// "2.0s" -> "2s"
+		dst = dst[:len(dst)-2]
+	}
+	return append(dst, suffix...)
+}
@@ -14,7 +14,6 @@ import (
 	"strconv"
 	"time"
 	"unicode/utf8"
-	_ "unsafe"
 
 	"github.com/hlandau/slogkit/slogwriter/internal/buffer"
 	"golang.org/x/exp/slog"
@@ -22,6 +21,11 @@ import (
 
 // JSONHandler is a Handler that writes Records to an io.Writer as
 // line-delimited JSON objects.
+//
+// It is configured using the same HandlerOptions as TextHandler. Options which
+// only make sense for text output are ignored. Colouring of output is disabled
+// by default, but can be enabled for development use by setting
+// HandlerOptions.ColorJSON.
 type JSONHandler struct {
 	*commonHandler
 }
@@ -33,13 +37,7 @@ func NewJSONHandler(w io.Writer, opts *HandlerOptions) *JSONHandler {
 	if opts == nil {
 		opts = &HandlerOptions{}
 	}
-	return &JSONHandler{
-		&commonHandler{
-			json: true,
-			w:    w,
-			opts: *opts,
-		},
-	}
+	return &JSONHandler{newCommonHandler(true, w, opts)}
 }
 
 // Enabled reports whether the handler handles records at the given level.
@@ -58,6 +56,44 @@ func (h *JSONHandler) WithGroup(name string) slog.Handler {
 	return &JSONHandler{commonHandler: h.commonHandler.withGroup(name)}
 }
 
+// Options returns the options used by the handler.
+func (h *JSONHandler) Options() HandlerOptions {
+	return h.opts
+}
+
+// WithOptions returns a new JSONHandler writing to the same io.Writer as h
+// using the given options, with the attributes and groups added to h. If opts
+// is nil, the default options are used. The new handler shares the queue used
+// if AsyncQueueSize is set unless AsyncQueueSize or AsyncDrop is changed.
+func (h *JSONHandler) WithOptions(opts *HandlerOptions) *JSONHandler {
+	if opts == nil {
+		opts = &HandlerOptions{}
+	}
+	return &JSONHandler{h.commonHandler.withOptions(opts)}
+}
+
+// Flush blocks until all records handled so far have been written. It does
+// nothing unless AsyncQueueSize is set.
+func (h *JSONHandler) Flush() error {
+	return h.commonHandler.flush()
+}
+
+// Close writes any queued records and stops the background goroutine used if
+// AsyncQueueSize is set. Records handled after Close are discarded with
+// ErrClosed. This affects the handler and all handlers derived from it. The
+// underlying io.Writer is not closed. If AsyncQueueSize is not set, Close does
+// nothing.
+func (h *JSONHandler) Close() error {
+	return h.commonHandler.close()
+}
+
+// Dropped returns the number of records dropped because the queue was full,
+// if AsyncQueueSize and AsyncDrop are set. The count includes records handled
+// by the handler and all handlers derived from it.
+func (h *JSONHandler) Dropped() uint64 {
+	return h.commonHandler.dropped()
+}
+
 // Handle formats its argument Record as a JSON object on a single line.
 //
 // If the Record's time is zero, the time is omitted.
@@ -70,7 +106,8 @@ func (h *JSONHandler) WithGroup(name string) slog.Handler {
 //
 // If the AddSource option is set and source information is available,
 // the key is "source"
-// and the value is output as "FILE:LINE".
+// and the value is output as an object with "function", "file" and "line"
+// fields.
 //
 // The message's key is "msg".
 //
@@ -105,13 +142,10 @@ func appendJSONTime(s *handleState, t time.Time) {
 	s.buf.WriteByte('"')
 }
 
-//go:linkname valueStr golang.org/x/exp/slog.Value.str
-func valueStr(v slog.Value) string
-
 func appendJSONValue(s *handleState, v slog.Value) error {
 	switch v.Kind() {
 	case slog.KindString:
-		s.appendString(valueStr(v))
+		s.appendString(s.stringValue(v.String()))
 	case slog.KindInt64:
 		*s.buf = strconv.AppendInt(*s.buf, v.Int64(), 10)
 	case slog.KindUint64:
@@ -134,7 +168,7 @@ func appendJSONValue(s *handleState, v slog.Value) error {
 		a := v.Any()
 		_, jm := a.(json.Marshaler)
 		if err, ok := a.(error); ok && !jm {
-			s.appendString(err.Error())
+			s.appendString(s.stringValue(err.Error()))
 		} else {
 			return appendJSONMarshal(s.buf, a)
 		}
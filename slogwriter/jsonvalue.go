@@ -0,0 +1,102 @@
+package slogwriter
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/exp/slog"
+)
+
+// appendJSONDocument appends an attribute whose value is a string containing
+// a JSON object or array, if DetectJSONValues is set, and reports whether it
+// did so. The JSON is written unquoted and highlighted if coloured output is
+// enabled. If MultiLine is set, it is indented and written as a multi-line
+// value; otherwise, it is compacted onto one line.
+func (s *handleState) appendJSONDocument(key string, v slog.Value, keyStyle string) bool {
+	if !s.h.opts.DetectJSONValues || s.h.json || v.Kind() != slog.KindString {
+		return false
+	}
+
+	str := strings.TrimSpace(v.String())
+	if len(str) < 2 || (str[0] != '{' && str[0] != '[') || !json.Valid([]byte(str)) {
+		return false
+	}
+
+	var b bytes.Buffer
+	if s.h.opts.MultiLine {
+		if err := json.Indent(&b, []byte(str), "", "  "); err != nil {
+			return false
+		}
+	} else if err := json.Compact(&b, []byte(str)); err != nil {
+		return false
+	}
+	if max := s.h.opts.MaxValueLength; max > 0 && utf8.RuneCount(b.Bytes()) > max {
+		// Truncating would produce invalid JSON; output it as a string.
+		return false
+	}
+
+	if s.h.opts.MultiLine {
+		s.appendMultiLineFunc(key, b.String(), keyStyle, s.appendHighlightedJSON)
+		return true
+	}
+
+	s.buf.WriteString(s.sep)
+	st := s.startStyle(keyStyle)
+	s.appendKey(key)
+	s.endStyle(st)
+	s.appendHighlightedJSON(b.String())
+	return true
+}
+
+// appendHighlightedJSON appends valid JSON text, or a line of valid indented
+// JSON text, styling object keys, strings, numbers and literals using the
+// theme if coloured output is enabled.
+func (s *handleState) appendHighlightedJSON(j string) {
+	t := s.h.theme()
+	for i := 0; i < len(j); {
+		c := j[i]
+		var end int
+		var style string
+		switch {
+		case c == '"':
+			end = i + 1
+			for end < len(j) && j[end] != '"' {
+				if j[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			end++
+			if end > len(j) {
+				end = len(j)
+			}
+			style = t.StringValue
+			if k := strings.TrimLeft(j[end:], " "); strings.HasPrefix(k, ":") {
+				style = t.Key
+			}
+		case c == '-' || (c >= '0' && c <= '9'):
+			end = i + 1
+			for end < len(j) && strings.IndexByte("+-.eE0123456789", j[end]) >= 0 {
+				end++
+			}
+			style = t.NumberValue
+		case c >= 'a' && c <= 'z':
+			// true, false or null.
+			end = i + 1
+			for end < len(j) && j[end] >= 'a' && j[end] <= 'z' {
+				end++
+			}
+			style = t.BoolValue
+		default:
+			s.buf.WriteByte(c)
+			i++
+			continue
+		}
+		st := s.startStyle(style)
+		s.buf.WriteString(j[i:end])
+		s.endStyle(st)
+		i = end
+	}
+}
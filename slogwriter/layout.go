@@ -0,0 +1,129 @@
+package slogwriter
+
+import (
+	"strings"
+
+	"golang.org/x/exp/slog"
+)
+
+// A field of a FormatTemplate.
+type layoutField int
+
+const (
+	layoutLiteral layoutField = iota
+	layoutTime
+	layoutLevel
+	layoutMessage
+	layoutAttrs
+	layoutSource
+)
+
+var layoutFieldNames = map[string]layoutField{
+	"time":   layoutTime,
+	"level":  layoutLevel,
+	"msg":    layoutMessage,
+	"attrs":  layoutAttrs,
+	"source": layoutSource,
+}
+
+type layoutItem struct {
+	field   layoutField
+	literal string // for layoutLiteral
+}
+
+// parseLayout parses a FormatTemplate. Unknown placeholders are treated as
+// literal text.
+func parseLayout(tmpl string) []layoutItem {
+	var items []layoutItem
+	addLiteral := func(s string) {
+		if s == "" {
+			return
+		}
+		if n := len(items); n > 0 && items[n-1].field == layoutLiteral {
+			items[n-1].literal += s
+			return
+		}
+		items = append(items, layoutItem{field: layoutLiteral, literal: s})
+	}
+
+	for tmpl != "" {
+		i := strings.IndexByte(tmpl, '{')
+		if i < 0 {
+			addLiteral(tmpl)
+			break
+		}
+		j := strings.IndexByte(tmpl[i:], '}')
+		if j < 0 {
+			addLiteral(tmpl)
+			break
+		}
+		j += i
+		addLiteral(tmpl[:i])
+		if f, ok := layoutFieldNames[tmpl[i+1:j]]; ok {
+			items = append(items, layoutItem{field: f})
+		} else {
+			addLiteral(tmpl[i : j+1])
+		}
+		tmpl = tmpl[j+1:]
+	}
+
+	return items
+}
+
+// appendLayout appends the fields of a record in the order specified by a
+// parsed FormatTemplate.
+//
+// Literal text immediately preceding a field is omitted if the field turns out
+// to be empty, so that, for example, a missing time does not result in leading
+// whitespace.
+func (s *handleState) appendLayout(r slog.Record, layout []layoutItem) {
+	s.lead = ""
+	align := s.h.opts.AlignColumns
+	litStart := -1
+	for _, item := range layout {
+		if item.field == layoutLiteral {
+			litStart = len(*s.buf)
+			s.buf.WriteString(item.literal)
+			continue
+		}
+
+		start := len(*s.buf)
+		switch item.field {
+		case layoutTime:
+			if s.h.wantTime(r) {
+				s.appendTimeField(r.Time.Round(0)) // strip monotonic to match Attr behavior
+			}
+		case layoutLevel:
+			if !s.h.opts.OmitLevel {
+				s.appendLevelField(r.Level)
+				if align {
+					s.pad(start, s.h.levelWidth())
+				}
+			}
+		case layoutMessage:
+			if s.h.wantMessage(r) {
+				s.appendMessageField(r.Message)
+				if align {
+					s.pad(start, s.h.messageWidth())
+				}
+			}
+		case layoutAttrs:
+			s.sep = ""
+			s.appendNonBuiltIns(r)
+		case layoutSource:
+			if s.h.wantSource() {
+				if src := recordSource(r); src != nil {
+					s.appendSourceField(src)
+					if align {
+						s.pad(start, s.h.sourceWidth())
+					}
+				}
+			}
+		}
+
+		if len(*s.buf) == start && litStart >= 0 {
+			*s.buf = (*s.buf)[:litStart]
+		}
+		litStart = -1
+	}
+}
@@ -0,0 +1,125 @@
+package slogwriter
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Specifies how untrusted text in messages and values is sanitized before
+// output, to prevent hostile input from injecting terminal escape sequences or
+// otherwise corrupting the log.
+type SanitizeMode int
+
+const (
+	// Do not sanitize. Text output relies on quoting to escape control
+	// characters; values written unquoted (for example, when MultiLine is set)
+	// are written as-is.
+	SanitizeNone SanitizeMode = iota
+
+	// Replace control characters other than tab and newline with the
+	// corresponding Unicode control pictures (for example, ESC is replaced with
+	// "␛"), so that escape sequences are visible but have no effect. C1
+	// control characters and invalid UTF-8 sequences are replaced with U+FFFD.
+	SanitizeEscape
+
+	// Remove ANSI escape sequences and control characters other than tab and
+	// newline. Invalid UTF-8 sequences are replaced with U+FFFD.
+	SanitizeStrip
+)
+
+// sanitize sanitizes str according to the given mode.
+func sanitize(str string, mode SanitizeMode) string {
+	if mode == SanitizeNone {
+		return str
+	}
+
+	var b strings.Builder
+	clean := 0 // str[:clean] has been checked and found clean
+	for i := 0; i < len(str); {
+		c := str[i]
+		r, size := rune(c), 1
+		if c >= utf8.RuneSelf {
+			r, size = utf8.DecodeRuneInString(str[i:])
+		}
+		if !needsSanitizing(r, size) {
+			i += size
+			continue
+		}
+
+		if b.Len() == 0 {
+			b.Grow(len(str))
+		}
+		b.WriteString(str[clean:i])
+		switch {
+		case r == utf8.RuneError:
+			b.WriteRune(utf8.RuneError)
+		case mode == SanitizeStrip:
+			if r == '\x1b' {
+				size = escapeSequenceLen(str[i:])
+			}
+		case r < 0x20:
+			b.WriteRune(0x2400 + r)
+		case r == 0x7f:
+			b.WriteRune(0x2421)
+		default:
+			b.WriteRune(utf8.RuneError)
+		}
+		i += size
+		clean = i
+	}
+	if clean == 0 {
+		return str
+	}
+	b.WriteString(str[clean:])
+	return b.String()
+}
+
+// needsSanitizing reports whether a rune, decoded from size bytes, must be
+// replaced or removed by sanitize.
+func needsSanitizing(r rune, size int) bool {
+	switch {
+	case r == utf8.RuneError && size == 1:
+		return true // invalid UTF-8
+	case r == '\t' || r == '\n':
+		return false
+	case r < 0x20 || r == 0x7f:
+		return true
+	case r >= 0x80 && r < 0xa0:
+		return true // C1 control characters
+	default:
+		return false
+	}
+}
+
+// escapeSequenceLen returns the length of the ANSI escape sequence at the start
+// of str, which must begin with ESC. Unterminated sequences extend to the end
+// of str.
+func escapeSequenceLen(str string) int {
+	if len(str) < 2 {
+		return len(str)
+	}
+	switch str[1] {
+	case '[':
+		// CSI: parameter and intermediate bytes followed by a final byte.
+		for i := 2; i < len(str); i++ {
+			if str[i] >= 0x40 && str[i] <= 0x7e {
+				return i + 1
+			}
+		}
+		return len(str)
+	case ']', 'P', '_', '^', 'X':
+		// OSC and other string sequences: terminated by BEL or ST (ESC \).
+		for i := 2; i < len(str); i++ {
+			if str[i] == '\a' {
+				return i + 1
+			}
+			if str[i] == '\x1b' && i+1 < len(str) && str[i+1] == '\\' {
+				return i + 2
+			}
+		}
+		return len(str)
+	default:
+		// Two-byte sequence.
+		return 2
+	}
+}
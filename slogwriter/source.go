@@ -0,0 +1,139 @@
+package slogwriter
+
+import (
+	"net/url"
+	"path/filepath"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/exp/slog"
+)
+
+// Specifies how source locations are formatted when AddSource is set.
+type SourceFormat int
+
+const (
+	// Output the file name and line number, e.g. "handler.go:42".
+	SourceFormatShort SourceFormat = iota
+
+	// Output the full path of the source file and line number, e.g.
+	// "/home/user/src/project/pkg/handler.go:42".
+	SourceFormatFull
+
+	// Output the path of the source file relative to the root of the main
+	// module and line number, e.g. "pkg/handler.go:42". Files in packages
+	// outside the main module are output with the import path of the package,
+	// e.g. "example.com/other/pkg/handler.go:42".
+	SourceFormatRelative
+
+	// Output the package-qualified function name and line number, e.g.
+	// "pkg.(*Handler).Handle:42".
+	SourceFormatFunction
+)
+
+// formatSource returns a copy of src formatted according to SourceFormat. src
+// must contain the full path of the source file.
+func (h *commonHandler) formatSource(src *slog.Source) *slog.Source {
+	src2 := *src
+	switch h.opts.SourceFormat {
+	case SourceFormatFull:
+	case SourceFormatRelative:
+		src2.File = relativeSourcePath(src)
+	case SourceFormatFunction:
+		if src2.Function != "" {
+			src2.File = ""
+			src2.Function = shortFunction(src2.Function)
+			break
+		}
+		fallthrough
+	default:
+		src2.File = filepath.Base(src2.File)
+	}
+	return &src2
+}
+
+// shortFunction returns a function name qualified only with the last element
+// of its package path, e.g. "b.(*T).M" for "example.com/a/b.(*T).M".
+func shortFunction(function string) string {
+	return function[strings.LastIndexByte(function, '/')+1:]
+}
+
+// OSC 8 escape sequences which start and end a hyperlink.
+const (
+	osc8Start = "\x1b]8;;"
+	osc8End   = "\x1b\\"
+)
+
+// sourceLink returns the URL to which the source location should be linked
+// when SourceLinks is set.
+func (h *commonHandler) sourceLink(src *slog.Source) string {
+	if tmpl := h.opts.SourceURLTemplate; tmpl != "" {
+		return strings.NewReplacer(
+			"{file}", filepath.ToSlash(src.File),
+			"{relfile}", relativeSourcePath(src),
+			"{line}", strconv.Itoa(src.Line),
+		).Replace(tmpl)
+	}
+	p := filepath.ToSlash(src.File)
+	if !strings.HasPrefix(p, "/") {
+		// Windows path, e.g. "C:/foo".
+		p = "/" + p
+	}
+	return (&url.URL{Scheme: "file", Path: p}).String()
+}
+
+var (
+	mainModuleOnce sync.Once
+	mainModulePath string
+)
+
+// mainModule returns the module path of the main module, or "" if it is not
+// known.
+func mainModule() string {
+	mainModuleOnce.Do(func() {
+		if bi, ok := debug.ReadBuildInfo(); ok {
+			mainModulePath = bi.Main.Path
+		}
+	})
+	return mainModulePath
+}
+
+// packagePath returns the import path of the package containing the given
+// fully-qualified function name, e.g. "example.com/a/b" for
+// "example.com/a/b.(*T).M".
+func packagePath(function string) string {
+	lastSlash := strings.LastIndexByte(function, '/')
+	if lastSlash < 0 {
+		lastSlash = 0
+	}
+	if i := strings.IndexByte(function[lastSlash:], '.'); i >= 0 {
+		function = function[:lastSlash+i]
+	}
+	// External test packages live in the same directory as the package under
+	// test.
+	return strings.TrimSuffix(function, "_test")
+}
+
+// relativeSourcePath returns the path of a source file relative to the root
+// of the main module, using forward slashes. The path is derived from the
+// package path of the function; if the package is not in the main module, its
+// full import path is used instead. If the package path cannot be determined
+// (for example, for package main), only the file name is returned.
+func relativeSourcePath(src *slog.Source) string {
+	base := filepath.Base(src.File)
+	pkg := packagePath(src.Function)
+	if pkg == "" || pkg == "main" {
+		return base
+	}
+	if mod := mainModule(); mod != "" {
+		if pkg == mod {
+			return base
+		}
+		if strings.HasPrefix(pkg, mod+"/") {
+			pkg = pkg[len(mod)+1:]
+		}
+	}
+	return pkg + "/" + base
+}
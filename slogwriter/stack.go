@@ -0,0 +1,73 @@
+package slogwriter
+
+import (
+	"runtime"
+	"strconv"
+	"strings"
+
+	"golang.org/x/exp/slog"
+)
+
+// Key of the attribute added to records by AddStackOnError.
+const stackKey = "stack"
+
+// Maximum number of frames captured by AddStackOnError.
+const maxStackDepth = 64
+
+// wantStack reports whether a stack trace should be added to a record with
+// the given level.
+func (h *commonHandler) wantStack(l slog.Level) bool {
+	if !h.opts.AddStackOnError {
+		return false
+	}
+	minLevel := slog.LevelError
+	if h.opts.StackLevel != nil {
+		minLevel = h.opts.StackLevel.Level()
+	}
+	return l >= minLevel
+}
+
+// recordStack returns a formatted stack trace of the calling goroutine. It is
+// formatted similarly to the output of runtime.Stack, with one line for the
+// function name and one indented line for the file and line number of each
+// frame.
+//
+// Frames above the frame which logged the record (i.e., those belonging to
+// slog and this package) are omitted if that frame can be identified using the
+// record's PC.
+func recordStack(r slog.Record) string {
+	pcs := make([]uintptr, maxStackDepth)
+	n := runtime.Callers(2, pcs)
+
+	var origin runtime.Frame
+	if r.PC != 0 {
+		origin, _ = runtime.CallersFrames([]uintptr{r.PC}).Next()
+	}
+
+	var frames []runtime.Frame
+	fs := runtime.CallersFrames(pcs[:n])
+	for {
+		f, more := fs.Next()
+		if origin.Function != "" && f.Function == origin.Function && f.Line == origin.Line {
+			// Discard all frames above the logging frame.
+			frames = frames[:0]
+		}
+		frames = append(frames, f)
+		if !more {
+			break
+		}
+	}
+
+	var b strings.Builder
+	for i, f := range frames {
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+		b.WriteString(f.Function)
+		b.WriteString("\n\t")
+		b.WriteString(f.File)
+		b.WriteByte(':')
+		b.WriteString(strconv.Itoa(f.Line))
+	}
+	return b.String()
+}
@@ -0,0 +1,102 @@
+//go:build go1.21
+// +build go1.21
+
+// Package stdslog provides variants of the slogwriter handlers which
+// implement the standard library log/slog Handler interface rather than that
+// of golang.org/x/exp/slog.
+//
+// The handlers are configured using slogwriter.HandlerOptions as usual. Note
+// that callbacks in the options (such as ReplaceAttr and WriterFunc) continue
+// to receive golang.org/x/exp/slog types; records and attributes are converted
+// before they are passed to the underlying slogwriter handler.
+package stdslog
+
+import (
+	"context"
+	"io"
+	"log/slog"
+
+	"github.com/hlandau/slogkit/slogwriter"
+	xslog "golang.org/x/exp/slog"
+)
+
+// Creates a log/slog Handler which writes records to w in the format of
+// slogwriter.TextHandler.
+func NewTextHandler(w io.Writer, opts *slogwriter.HandlerOptions) slog.Handler {
+	return Adapt(slogwriter.NewTextHandler(w, opts))
+}
+
+// Creates a log/slog Handler which writes records to w in the format of
+// slogwriter.JSONHandler.
+func NewJSONHandler(w io.Writer, opts *slogwriter.HandlerOptions) slog.Handler {
+	return Adapt(slogwriter.NewJSONHandler(w, opts))
+}
+
+// Wraps an arbitrary golang.org/x/exp/slog Handler so that it can be used as a
+// log/slog Handler.
+func Adapt(h xslog.Handler) slog.Handler {
+	return &handler{h}
+}
+
+type handler struct {
+	h xslog.Handler
+}
+
+func (h *handler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.h.Enabled(ctx, xslog.Level(level))
+}
+
+func (h *handler) Handle(ctx context.Context, r slog.Record) error {
+	xr := xslog.NewRecord(r.Time, xslog.Level(r.Level), r.Message, r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		xr.AddAttrs(convertAttr(a))
+		return true
+	})
+	return h.h.Handle(ctx, xr)
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &handler{h.h.WithAttrs(convertAttrs(attrs))}
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	return &handler{h.h.WithGroup(name)}
+}
+
+func convertAttrs(attrs []slog.Attr) []xslog.Attr {
+	xattrs := make([]xslog.Attr, len(attrs))
+	for i, a := range attrs {
+		xattrs[i] = convertAttr(a)
+	}
+	return xattrs
+}
+
+func convertAttr(a slog.Attr) xslog.Attr {
+	return xslog.Attr{Key: a.Key, Value: convertValue(a.Value)}
+}
+
+func convertValue(v slog.Value) xslog.Value {
+	// LogValuers are resolved here as the interface types differ between the two
+	// packages.
+	v = v.Resolve()
+	switch v.Kind() {
+	case slog.KindString:
+		return xslog.StringValue(v.String())
+	case slog.KindInt64:
+		return xslog.Int64Value(v.Int64())
+	case slog.KindUint64:
+		return xslog.Uint64Value(v.Uint64())
+	case slog.KindFloat64:
+		return xslog.Float64Value(v.Float64())
+	case slog.KindBool:
+		return xslog.BoolValue(v.Bool())
+	case slog.KindDuration:
+		return xslog.DurationValue(v.Duration())
+	case slog.KindTime:
+		return xslog.TimeValue(v.Time())
+	case slog.KindGroup:
+		return xslog.GroupValue(convertAttrs(v.Group())...)
+	default:
+		return xslog.AnyValue(v.Any())
+	}
+}
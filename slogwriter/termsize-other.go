@@ -0,0 +1,12 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !dragonfly && !windows
+// +build !linux,!darwin,!freebsd,!netbsd,!dragonfly,!windows
+
+package slogwriter
+
+import "io"
+
+// terminalWidth returns the width of the terminal w writes to, or 0 if w is
+// not a terminal or the width cannot be determined on this platform.
+func terminalWidth(w io.Writer) int {
+	return 0
+}
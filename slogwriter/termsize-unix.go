@@ -0,0 +1,31 @@
+//go:build linux || darwin || freebsd || netbsd || dragonfly
+// +build linux darwin freebsd netbsd dragonfly
+
+package slogwriter
+
+import (
+	"io"
+	"syscall"
+	"unsafe"
+)
+
+type winsize struct {
+	Row, Col, Xpixel, Ypixel uint16
+}
+
+// terminalWidth returns the width of the terminal w writes to, or 0 if w is
+// not a terminal.
+func terminalWidth(w io.Writer) int {
+	f, ok := w.(hasFd)
+	if !ok {
+		return 0
+	}
+
+	var ws winsize
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), uintptr(syscall.TIOCGWINSZ), uintptr(unsafe.Pointer(&ws)))
+	if errno != 0 {
+		return 0
+	}
+
+	return int(ws.Col)
+}
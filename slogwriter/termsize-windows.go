@@ -0,0 +1,36 @@
+//go:build windows
+// +build windows
+
+package slogwriter
+
+import (
+	"io"
+	"unsafe"
+)
+
+var procGetConsoleScreenBufferInfo = kernel32.NewProc("GetConsoleScreenBufferInfo")
+
+type consoleScreenBufferInfo struct {
+	Size              [2]int16
+	CursorPosition    [2]int16
+	Attributes        uint16
+	Window            [4]int16 // left, top, right, bottom
+	MaximumWindowSize [2]int16
+}
+
+// terminalWidth returns the width of the console w writes to, or 0 if w is
+// not a console.
+func terminalWidth(w io.Writer) int {
+	f, ok := w.(hasFd)
+	if !ok {
+		return 0
+	}
+
+	var info consoleScreenBufferInfo
+	r, _, _ := procGetConsoleScreenBufferInfo.Call(f.Fd(), uintptr(unsafe.Pointer(&info)))
+	if r == 0 {
+		return 0
+	}
+
+	return int(info.Window[2]-info.Window[0]) + 1
+}
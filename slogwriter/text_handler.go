@@ -14,16 +14,49 @@ import (
 	"time"
 	"unicode"
 	"unicode/utf8"
-	_ "unsafe"
 
 	"golang.org/x/exp/slog"
 )
 
+// Options for a TextHandler or JSONHandler. A zero HandlerOptions consists
+// entirely of default values.
 type HandlerOptions struct {
 	// AddSource causes the handler to compute the source code position
 	// of the log statement and add a SourceKey attribute to the output.
 	AddSource bool
 
+	// Determines how the source location is formatted if AddSource is set. By
+	// default, only the file name and line number are output.
+	SourceFormat SourceFormat
+
+	// If set, and coloured output is enabled, TextHandler writes the source
+	// location as an OSC 8 hyperlink, which terminals supporting OSC 8 allow to
+	// be opened by clicking it. Terminals which do not support OSC 8 usually
+	// ignore the escape sequences, but this is not guaranteed, so this is not
+	// enabled by default. The link target is determined by SourceURLTemplate.
+	SourceLinks bool
+
+	// The URL to which source locations are linked if SourceLinks is set. The
+	// placeholders "{file}", "{relfile}" and "{line}" are replaced with the
+	// absolute path of the source file, the path of the source file relative to
+	// the root of the main module, and the line number respectively. For
+	// example:
+	//
+	//     "https://github.com/example/project/blob/master/{relfile}#L{line}"
+	//
+	// If empty, a file:// URL for the source file is used.
+	SourceURLTemplate string
+
+	// AddStackOnError causes the handler to capture a stack trace of the
+	// goroutine logging a record and add it to the record as the top-level
+	// attribute "stack", if the record's level is at or above StackLevel.
+	// Consider using MultiLine to make the stack trace readable in text output.
+	AddStackOnError bool
+
+	// The minimum level of records to which AddStackOnError adds a stack
+	// trace. If nil, LevelError is assumed.
+	StackLevel slog.Leveler
+
 	// Level reports the minimum record level that will be logged.
 	// The handler discards records with lower levels.
 	// If Level is nil, the handler assumes LevelInfo.
@@ -58,11 +91,279 @@ type HandlerOptions struct {
 	// remove attributes from the output.
 	ReplaceAttr func(groups []string, a slog.Attr) slog.Attr
 
-	// Force disable coloured output.
+	// ReplaceGroup is called to rewrite each group attribute with a non-empty
+	// key before its contents are logged. The attribute's value has been
+	// resolved and is of kind KindGroup. The first argument is as for
+	// ReplaceAttr.
+	//
+	// If ReplaceGroup returns an Attr with Key == "", the group is discarded.
+	// Otherwise, the returned Attr is logged in place of the group and, like
+	// any other attribute, is passed to ReplaceAttr if it is not a group. For
+	// example, a group containing credentials can be redacted wholesale:
+	//
+	//     func(groups []string, a slog.Attr) slog.Attr {
+	//         if a.Key == "credentials" {
+	//             return slog.String(a.Key, "REDACTED")
+	//         }
+	//         return a
+	//     }
+	//
+	// ReplaceGroup is not called for groups started using WithGroup.
+	ReplaceGroup func(groups []string, a slog.Attr) slog.Attr
+
+	// Names to be output for specific levels, for example to support custom
+	// levels such as TRACE or FATAL. Levels not listed here are named using
+	// LevelString, if set.
+	LevelNames map[slog.Level]string
+
+	// If non-nil, called to determine the name to be output for a level not
+	// listed in LevelNames. If nil, slog.Level.String is used; TextHandler
+	// abbreviates such names to three characters.
+	LevelString func(l slog.Level) string
+
+	// Force disable coloured output. This has no effect on JSONHandler unless
+	// ColorJSON is set.
 	NoColor bool
 
+	// Determines whether output is coloured if NoColor is not set. By
+	// default, colour is disabled if the NO_COLOR environment variable is set
+	// or the writer is a file which is not a terminal.
+	//
+	// On Windows, coloured output is disabled unless ColorMode is ColorAlways
+	// if the writer is a console which does not support ANSI escape sequences.
+	ColorMode ColorMode
+
+	// If set, the output of JSONHandler is coloured using ANSI escape
+	// sequences, unless NoColor is also set. This is intended for viewing JSON
+	// output on a terminal during development; the output is not valid JSON.
+	ColorJSON bool
+
+	// If set, attribute values are coloured according to their kind (for
+	// example, numbers, booleans or errors), using the corresponding styles of
+	// the theme. This affects text output only.
+	ColorValues bool
+
+	// The theme used for coloured output. If nil, DefaultTheme is used for
+	// TextHandler and DefaultJSONTheme is used for JSONHandler.
+	Theme *Theme
+
+	// If non-empty, determines the layout of text output. The template is
+	// literal text containing the placeholders "{time}", "{level}", "{msg}",
+	// "{attrs}" and "{source}", which are replaced with the corresponding parts
+	// of the record. Built-in fields can be reordered or omitted by changing
+	// the template. For example:
+	//
+	//     "{level} {msg} {attrs} ({time})"
+	//
+	// Literal text immediately preceding a placeholder which expands to nothing
+	// (for example, "{source}" if AddSource is not set) is omitted. Any other
+	// text in braces is output literally. If empty, the standard layout, which
+	// is equivalent to "{time} {level} {msg} {attrs} {source}", is used. This
+	// affects text output only.
+	FormatTemplate string
+
+	// If set, the time of each record is omitted from the output. This is
+	// useful if the output is consumed by something which records its own
+	// timestamps, such as systemd or a container runtime.
+	OmitTime bool
+
+	// If set, the level of each record is omitted from the output.
+	OmitLevel bool
+
+	// If set, the source location is omitted from the output even if AddSource
+	// is set. This is useful where options come from a preset or shared
+	// configuration.
+	OmitSource bool
+
+	// If set, the message is omitted from the output if it is empty, rather
+	// than being output as an empty string.
+	OmitMessageKey bool
+
+	// If non-nil, the time of each record, and time values, are converted to
+	// this location before being output. For example, time.UTC can be used so
+	// that output from hosts in different time zones can be easily correlated.
+	// ReplaceAttr, if set, receives the converted time. If nil, times are
+	// output in the location they were created in, which is usually
+	// time.Local.
+	TimeLocation *time.Location
+
+	// The precision with which times are output. By default, times are output
+	// with millisecond precision. This affects text output only; JSON output
+	// always uses nanosecond precision.
+	TimePrecision TimePrecision
+
+	// If set, the time of each record is output as the number of seconds
+	// elapsed since the process started, for example "+12.345s", rather than
+	// as an absolute time. ReplaceAttr, if set, still receives the time as a
+	// time.Time. This affects text output only.
+	RelativeTime bool
+
+	// If set, the level, message and source columns are padded to fixed widths
+	// so that the output of consecutive records lines up vertically. The source
+	// is written after the message rather than at the end of the record. This
+	// affects text output only.
+	AlignColumns bool
+
+	// The width of the message column if AlignColumns is set. Longer messages
+	// are not truncated. If zero, a default is used.
+	MessageWidth int
+
+	// The width of the source column if AlignColumns is set. If zero, a default
+	// is used.
+	SourceWidth int
+
+	// If positive, string values longer than this many characters are
+	// truncated and an ellipsis appended. Values formatted from arbitrary types
+	// are truncated after formatting as a string; this does not apply to values
+	// marshalled as JSON objects or arrays.
+	//
+	// If any value or attribute of a record is omitted due to MaxValueLength or
+	// MaxAttrCount, the top-level attribute "truncated=true" is added to the
+	// record.
+	MaxValueLength int
+
+	// If positive, at most this many attributes of a record are output. This
+	// does not include attributes added using WithAttrs.
+	MaxAttrCount int
+
+	// If set, attributes are output in order of their keys, rather than the
+	// order in which they were added. Attributes are sorted within each group,
+	// and attributes added using WithAttrs are sorted together with those of
+	// the record, making output deterministic and suitable for comparison.
+	// Groups with the same name at the same level are merged. Attribute keys
+	// are compared before ReplaceAttr is called.
+	SortAttrs bool
+
+	// If set, where an attribute has the same key as an earlier attribute in
+	// the same group, including attributes added using WithAttrs, only the
+	// last value is output, in the position of the first. Groups with the same
+	// name at the same level are merged, and an attribute replaces a group with
+	// the same key and vice versa. Attribute keys are compared before
+	// ReplaceAttr is called.
+	DedupeAttrs bool
+
+	// If set, an attribute added using WithAttrs is omitted if an identical
+	// attribute (with the same key and formatted value, in the same groups) has
+	// already been added to the handler or a handler it was derived from. This
+	// avoids repeated attributes when WithAttrs is applied repeatedly with the
+	// same attributes, for example by layered middleware. Unlike DedupeAttrs,
+	// attributes with the same key but different values are all output, and
+	// attributes of the record itself are not affected.
+	SkipDuplicateAttrs bool
+
+	// Determines how attributes in groups are rendered in text output. By
+	// default, keys are prefixed with the names of the groups containing them.
+	GroupStyle GroupStyle
+
+	// The separator between group names and keys if GroupStyle is
+	// GroupStyleDotted. If empty, "." is used.
+	GroupSeparator string
+
+	// If non-nil, values of types registered in the registry are converted
+	// using the registered formatter before being output. This takes precedence
+	// over ErrorChain and ErrorTypes, as well as the default rendering of types
+	// implementing encoding.TextMarshaler or json.Marshaler.
+	Formatters *FormatterRegistry
+
+	// If set, error values are rendered as a group containing the error
+	// message under the key "msg" and the error it wraps, if any, under the key
+	// "cause", recursively. Errors which wrap multiple errors (such as those
+	// created by errors.Join) have their wrapped errors rendered in a group
+	// under the key "causes".
+	ErrorChain bool
+
+	// If set, error values are rendered as a group containing the error
+	// message under the key "msg" and the Go type of the error under the key
+	// "type". This can be combined with ErrorChain.
+	ErrorTypes bool
+
+	// Determines when values, including the message, are quoted in text
+	// output. By default, values are quoted only where necessary.
+	QuoteMode QuoteMode
+
+	// Determines how the message and string values are sanitized to prevent
+	// hostile input from injecting terminal escape sequences or control
+	// characters into the output. This does not apply to byte slices, which
+	// are always quoted in text output, or to values marshalled as JSON.
+	Sanitize SanitizeMode
+
+	// If set, string values containing a JSON object or array are written
+	// unquoted and, if coloured output is enabled, with syntax highlighting,
+	// rather than as a quoted and escaped string. If MultiLine is also set, the
+	// JSON is indented and written on multiple lines; otherwise, it is
+	// compacted onto a single line. Output containing such values may not be
+	// parseable as key=value pairs. This affects text output only.
+	DetectJSONValues bool
+
+	// If set, time.Duration values are rendered in a compact human-readable
+	// form with at most one decimal place, such as "350ms" or "1.2s". This
+	// affects text output only; JSON output always uses integer nanoseconds.
+	HumanDurations bool
+
+	// If set, ByteSize values are rendered using binary units, such as
+	// "4.2 MiB". This affects text output only; JSON output always uses the
+	// raw number of bytes.
+	HumanByteSizes bool
+
+	// If set, text output wider than WrapWidth is wrapped onto multiple lines.
+	// Lines are broken only between attributes, and continuation lines are
+	// indented. A single attribute wider than WrapWidth is not broken.
+	Wrap bool
+
+	// The width at which output is wrapped if Wrap is set. If zero, the width
+	// of the terminal being written to is used, if known; otherwise, the
+	// COLUMNS environment variable is used, if set, or a default of 80. The
+	// width is determined at most once per second, so a resized terminal is
+	// noticed shortly afterwards.
+	WrapWidth int
+
+	// If set, string values which contain newlines (for example, stack traces or
+	// SQL queries) are written after the rest of the record, one line at a time
+	// and indented, rather than being quoted and escaped on a single line. This
+	// affects text output only.
+	MultiLine bool
+
+	// If set, error values are written after the rest of the record, in the
+	// same way as multi-line string values when MultiLine is set, rather than
+	// on a single line. This takes precedence over ErrorChain and ErrorTypes.
+	// This affects text output only.
+	MultiLineErrors bool
+
 	// If non-nil, log text is written by calling this instead of using a standard io.Writer sink.
 	WriterFunc func(ctx context.Context, b []byte, r slog.Record) error
+
+	// If non-nil, log text is written by calling this instead of using a
+	// standard io.Writer sink or WriterFunc. In addition to the formatted
+	// record, it receives information about the record and the state of the
+	// handler, such as attributes added using WithAttrs, so that routing
+	// decisions can be made without parsing the formatted output. The contents
+	// of info must not be modified or retained after the call returns.
+	RecordWriterFunc func(ctx context.Context, b []byte, info *RecordInfo) error
+
+	// If non-nil, called when writing a record fails, with the error returned
+	// by the io.Writer or WriterFunc and the record which was not written. The
+	// error is still returned from Handle, but slog.Logger discards it, so this
+	// can be used to count dropped records or switch to another sink. OnError
+	// is called without any lock held and may be called concurrently.
+	OnError func(err error, r slog.Record)
+
+	// If positive, records are formatted by Handle but written by a background
+	// goroutine, using a queue which can hold this many records, so that
+	// logging does not block on a slow writer. Errors occurring when writing
+	// are reported only via OnError. The handler's Flush method can be used to
+	// wait until queued records have been written, and Close to stop the
+	// background goroutine. The context passed to WriterFunc or
+	// RecordWriterFunc carries the values of the context passed to Handle, but
+	// not its deadline or cancellation. OnError is called on the background
+	// goroutine, and must not log using this handler or any handler derived
+	// from it, as this can deadlock when the queue is full.
+	AsyncQueueSize int
+
+	// If set, and AsyncQueueSize is positive, records handled when the queue is
+	// full are dropped, rather than Handle blocking until there is space in the
+	// queue. Handle returns ErrQueueFull for dropped records, which are also
+	// counted by the handler's Dropped method.
+	AsyncDrop bool
 }
 
 // TextHandler is a Handler that writes Records to an io.Writer as a
@@ -78,13 +379,12 @@ func NewTextHandler(w io.Writer, opts *HandlerOptions) *TextHandler {
 	if opts == nil {
 		opts = &HandlerOptions{}
 	}
-	return &TextHandler{
-		&commonHandler{
-			json: false,
-			w:    w,
-			opts: *opts,
-		},
-	}
+	return &TextHandler{newCommonHandler(false, w, opts)}
+}
+
+// Implemented by *os.File.
+type hasFd interface {
+	Fd() uintptr
 }
 
 // Enabled reports whether the handler handles records at the given level.
@@ -103,6 +403,51 @@ func (h *TextHandler) WithGroup(name string) slog.Handler {
 	return &TextHandler{commonHandler: h.commonHandler.withGroup(name)}
 }
 
+// Options returns the options used by the handler.
+func (h *TextHandler) Options() HandlerOptions {
+	return h.opts
+}
+
+// WithOptions returns a new TextHandler writing to the same io.Writer as h
+// using the given options, with the attributes and groups added to h. For
+// example, to derive a handler which does not use colour:
+//
+//	opts := h.Options()
+//	opts.NoColor = true
+//	h2 := h.WithOptions(&opts)
+//
+// If opts is nil, the default options are used. The new handler shares the
+// queue used if AsyncQueueSize is set unless AsyncQueueSize or AsyncDrop is
+// changed.
+func (h *TextHandler) WithOptions(opts *HandlerOptions) *TextHandler {
+	if opts == nil {
+		opts = &HandlerOptions{}
+	}
+	return &TextHandler{h.commonHandler.withOptions(opts)}
+}
+
+// Flush blocks until all records handled so far have been written. It does
+// nothing unless AsyncQueueSize is set.
+func (h *TextHandler) Flush() error {
+	return h.commonHandler.flush()
+}
+
+// Close writes any queued records and stops the background goroutine used if
+// AsyncQueueSize is set. Records handled after Close are discarded with
+// ErrClosed. This affects the handler and all handlers derived from it. The
+// underlying io.Writer is not closed. If AsyncQueueSize is not set, Close does
+// nothing.
+func (h *TextHandler) Close() error {
+	return h.commonHandler.close()
+}
+
+// Dropped returns the number of records dropped because the queue was full,
+// if AsyncQueueSize and AsyncDrop are set. The count includes records handled
+// by the handler and all handlers derived from it.
+func (h *TextHandler) Dropped() uint64 {
+	return h.commonHandler.dropped()
+}
+
 // Handle formats its argument Record as a single line of space-separated
 // key=value items.
 //
@@ -126,7 +471,8 @@ func (h *TextHandler) WithGroup(name string) slog.Handler {
 // written. Otherwise, the result of fmt.Sprint is written.
 //
 // Keys and values are quoted with [strconv.Quote] if they contain Unicode space
-// characters, non-printing characters, '"' or '='.
+// characters, non-printing characters, '"' or '='. The quoting of values can
+// be changed using [HandlerOptions.QuoteMode].
 //
 // Keys inside groups consist of components (keys or group names) separated by
 // dots. No further escaping is performed.
@@ -143,40 +489,159 @@ func (h *TextHandler) Handle(ctx context.Context, r slog.Record) error {
 	return h.commonHandler.handle(ctx, r)
 }
 
-//go:linkname valueTime golang.org/x/exp/slog.Value.time
-func valueTime(v slog.Value) time.Time
-
-//go:linkname valueAppend golang.org/x/exp/slog.Value.append
-func valueAppend(v slog.Value, dst []byte) []byte
-
 func appendTextValue(s *handleState, v slog.Value) error {
 	switch v.Kind() {
 	case slog.KindString:
-		s.appendString(valueStr(v))
+		s.appendStringValue(s.stringValue(v.String()))
 	case slog.KindTime:
-		s.appendTime(valueTime(v))
+		s.quoteAlways(func() { s.appendTime(v.Time()) })
+	case slog.KindDuration:
+		if s.h.opts.HumanDurations {
+			s.quoteAlways(func() { *s.buf = appendHumanDuration(*s.buf, v.Duration()) })
+		} else {
+			s.quoteAlways(func() { *s.buf = appendScalarValue(*s.buf, v) })
+		}
 	case slog.KindAny:
+		if n, ok := v.Any().(ByteSize); ok && s.h.opts.HumanByteSizes {
+			s.appendStringValue(string(appendHumanByteSize(nil, n)))
+			return nil
+		}
 		if tm, ok := v.Any().(encoding.TextMarshaler); ok {
 			data, err := tm.MarshalText()
 			if err != nil {
 				return err
 			}
 			// TODO: avoid the conversion to string.
-			s.appendString(string(data))
+			s.appendStringValue(s.stringValue(string(data)))
 			return nil
 		}
 		if bs, ok := byteSlice(v.Any()); ok {
+			if s.quoteMode == QuoteModeNever {
+				*s.buf = appendEscapedText(*s.buf, s.truncateValue(string(bs)))
+				return nil
+			}
 			// As of Go 1.19, this only allocates for strings longer than 32 bytes.
-			s.buf.WriteString(strconv.Quote(string(bs)))
+			s.buf.WriteString(strconv.Quote(s.truncateValue(string(bs))))
 			return nil
 		}
-		s.appendString(fmt.Sprintf("%+v", v.Any()))
+		var f func() string
+		var method string
+		switch x := v.Any().(type) {
+		case error:
+			f, method = x.Error, "Error"
+		case fmt.Stringer:
+			f, method = x.String, "String"
+		}
+		if f != nil {
+			str, err := callStringMethod(v.Any(), method, f)
+			if err != nil {
+				return err
+			}
+			s.appendStringValue(s.stringValue(str))
+			return nil
+		}
+		s.appendStringValue(s.stringValue(fmt.Sprintf("%+v", v.Any())))
 	default:
-		*s.buf = valueAppend(v, *s.buf)
+		s.quoteAlways(func() { *s.buf = appendScalarValue(*s.buf, v) })
 	}
 	return nil
 }
 
+// Specifies when values are quoted in text output.
+type QuoteMode int
+
+const (
+	// Quote values only where necessary, i.e. if they are empty or contain
+	// spaces, non-printing characters, '"' or '='.
+	QuoteModeAuto QuoteMode = iota
+
+	// Always quote values, including numbers, booleans and times.
+	QuoteModeAlways
+
+	// Never quote values. Non-printing characters and '"' are escaped as they
+	// would be inside quotes, but spaces and '=' are written as-is, so output
+	// may be ambiguous.
+	QuoteModeNever
+)
+
+// appendStringValue appends a string value, quoting it according to
+// QuoteMode.
+func (s *handleState) appendStringValue(str string) {
+	if s.h.json {
+		s.appendString(str)
+		return
+	}
+	switch s.quoteMode {
+	case QuoteModeAlways:
+		*s.buf = strconv.AppendQuote(*s.buf, str)
+	case QuoteModeNever:
+		if needsQuoting(str) {
+			*s.buf = appendEscapedText(*s.buf, str)
+		} else {
+			s.buf.WriteString(str)
+		}
+	default:
+		s.appendString(str)
+	}
+}
+
+// quoteAlways calls f, surrounding what it appends with quotes if QuoteMode is
+// QuoteModeAlways. f must not append anything which requires escaping.
+func (s *handleState) quoteAlways(f func()) {
+	quote := s.quoteMode == QuoteModeAlways
+	if quote {
+		s.buf.WriteByte('"')
+	}
+	f()
+	if quote {
+		s.buf.WriteByte('"')
+	}
+}
+
+// appendEscapedText appends str escaped as by strconv.Quote, but without the
+// surrounding quotes.
+func appendEscapedText(dst []byte, str string) []byte {
+	start := len(dst)
+	dst = strconv.AppendQuote(dst, str)
+	n := copy(dst[start:], dst[start+1:len(dst)-1])
+	return dst[:start+n]
+}
+
+// callStringMethod calls f, which is the named Error or String method of a,
+// and returns its result. If the method panics, an error is returned, except
+// that, as with fmt, "<nil>" is returned if a is a nil pointer.
+func callStringMethod(a any, method string, f func() string) (str string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if v := reflect.ValueOf(a); v.Kind() == reflect.Pointer && v.IsNil() {
+				str, err = "<nil>", nil
+				return
+			}
+			err = fmt.Errorf("panic in %s method of %T: %v", method, a, r)
+		}
+	}()
+	return f(), nil
+}
+
+// appendScalarValue appends the text representation of a value which is not
+// a string, time or arbitrary value, as done by slog.Value.String.
+func appendScalarValue(dst []byte, v slog.Value) []byte {
+	switch v.Kind() {
+	case slog.KindInt64:
+		return strconv.AppendInt(dst, v.Int64(), 10)
+	case slog.KindUint64:
+		return strconv.AppendUint(dst, v.Uint64(), 10)
+	case slog.KindFloat64:
+		return strconv.AppendFloat(dst, v.Float64(), 'g', -1, 64)
+	case slog.KindBool:
+		return strconv.AppendBool(dst, v.Bool())
+	case slog.KindDuration:
+		return append(dst, v.Duration().String()...)
+	default:
+		return append(dst, v.String()...)
+	}
+}
+
 // byteSlice returns its argument as a []byte if the argument's
 // underlying type is []byte, along with a second return value of true.
 // Otherwise it returns nil, false.
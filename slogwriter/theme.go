@@ -0,0 +1,145 @@
+package slogwriter
+
+import (
+	"math"
+
+	"golang.org/x/exp/slog"
+)
+
+// ANSI escape sequence which resets all styling.
+const ansiReset = "\x1b[0m"
+
+// A Theme determines the ANSI escape sequences used when writing coloured
+// output. Each field is an escape sequence (for example, "\x1b[90m") which is
+// written before the corresponding element; a reset sequence is written after
+// it. An empty string means that the element is not styled.
+type Theme struct {
+	// Style for the record timestamp.
+	Time string
+
+	// Styles for the record level. The list is examined in order and the first
+	// entry whose Level is less than or equal to the record level is used. If
+	// no entry matches, the level is not styled. Custom levels are styled
+	// according to the range they fall in; for example, in the default theme,
+	// levels above LevelError+4 (e.g. FATAL) are bold and levels below
+	// LevelDebug (e.g. TRACE) are dimmed.
+	Levels []LevelStyle
+
+	// Style for the record message.
+	Message string
+
+	// Style for attribute keys, including the '=' separator.
+	Key string
+
+	// Style for attribute values.
+	Value string
+
+	// Style for the source location, if AddSource is set.
+	Source string
+
+	// Styles for attribute values of particular kinds, used instead of Value
+	// if HandlerOptions.ColorValues is set. NumberValue is used for integers,
+	// floating-point numbers and ByteSize values. StringValue is used for
+	// strings and values of other types formatted as strings. An empty string
+	// means that Value is used for that kind.
+	NumberValue, BoolValue, DurationValue, TimeValue, StringValue, ErrorValue string
+
+	// Per-key style overrides. If an attribute's key is present in this map,
+	// the corresponding style is used for both the key and value of that
+	// attribute instead of Key and Value. This can be used to dim attributes of
+	// low importance.
+	Attrs map[string]string
+}
+
+// Associates a style with all levels greater than or equal to Level.
+type LevelStyle struct {
+	Level slog.Level
+	Style string
+}
+
+// The theme used if HandlerOptions.Theme is nil.
+var DefaultTheme = Theme{
+	Time: "\x1b[90m",
+	Levels: []LevelStyle{
+		{slog.LevelError + 4, "\x1b[1;91m"},
+		{slog.LevelError, "\x1b[91m"},
+		{slog.LevelWarn, "\x1b[93m"},
+		{slog.LevelDebug, ""},
+		{math.MinInt, "\x1b[90m"},
+	},
+	Message:       "\x1b[1m",
+	Source:        "\x1b[90m",
+	NumberValue:   "\x1b[36m",
+	BoolValue:     "\x1b[35m",
+	DurationValue: "\x1b[34m",
+	TimeValue:     "\x1b[32m",
+	ErrorValue:    "\x1b[31m",
+}
+
+// The theme used by JSONHandler if HandlerOptions.Theme is nil and
+// HandlerOptions.ColorJSON is set.
+var DefaultJSONTheme = Theme{
+	Time: "\x1b[90m",
+	Levels: []LevelStyle{
+		{slog.LevelError + 4, "\x1b[1;91m"},
+		{slog.LevelError, "\x1b[91m"},
+		{slog.LevelWarn, "\x1b[93m"},
+		{slog.LevelDebug, ""},
+		{math.MinInt, "\x1b[90m"},
+	},
+	Message: "\x1b[1m",
+	Key:     "\x1b[36m",
+	Source:  "\x1b[90m",
+}
+
+// Returns the style to be used for the given level.
+func (t *Theme) levelStyle(level slog.Level) string {
+	for _, ls := range t.Levels {
+		if level >= ls.Level {
+			return ls.Style
+		}
+	}
+	return ""
+}
+
+// Returns the key and value styles to be used for an attribute. If byKind is
+// set, the value style is chosen according to the kind of the value.
+func (t *Theme) attrStyles(a slog.Attr, byKind bool) (keyStyle, valueStyle string) {
+	if style, ok := t.Attrs[a.Key]; ok {
+		return style, style
+	}
+	if byKind {
+		if style := t.kindStyle(a.Value); style != "" {
+			return t.Key, style
+		}
+	}
+	return t.Key, t.Value
+}
+
+// Returns the style to be used for a value according to its kind, or "" if
+// there is none.
+func (t *Theme) kindStyle(v slog.Value) string {
+	switch v.Kind() {
+	case slog.KindInt64, slog.KindUint64, slog.KindFloat64:
+		return t.NumberValue
+	case slog.KindBool:
+		return t.BoolValue
+	case slog.KindDuration:
+		return t.DurationValue
+	case slog.KindTime:
+		return t.TimeValue
+	case slog.KindString:
+		return t.StringValue
+	case slog.KindAny:
+		switch v.Any().(type) {
+		case error:
+			return t.ErrorValue
+		case ByteSize:
+			return t.NumberValue
+		default:
+			return t.StringValue
+		}
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,57 @@
+package slogwriter
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+func TestMaxValueLength(t *testing.T) {
+	keep := func(groups []string, a slog.Attr) slog.Attr { return a }
+
+	tests := []struct {
+		Name     string
+		JSON     bool
+		Replace  bool
+		Expected []string
+	}{
+		{"text", false, false, []string{"WAR", "hello", "k=abc…", "truncated=true"}},
+		{"text+ReplaceAttr", false, true, []string{"<WARN>", "hello", "k=abc…", "truncated=true"}},
+		{"json", true, false, []string{`"level":"WARN"`, `"msg":"hello"`, `"k":"abc…"`, `"truncated":true`}},
+		{"json+ReplaceAttr", true, true, []string{`"level":"WARN"`, `"msg":"hello"`, `"k":"abc…"`, `"truncated":true`}},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		opts := &HandlerOptions{MaxValueLength: 3, AddSource: true}
+		if test.Replace {
+			opts.ReplaceAttr = keep
+		}
+
+		var h slog.Handler
+		if test.JSON {
+			h = NewJSONHandler(&buf, opts)
+		} else {
+			h = NewTextHandler(&buf, opts)
+		}
+
+		r := slog.NewRecord(time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC), slog.LevelWarn, "hello", 0)
+		r.AddAttrs(slog.String("k", "abcdef"))
+		if err := h.Handle(context.Background(), r); err != nil {
+			t.Fatalf("%s: cannot handle: %v", test.Name, err)
+		}
+
+		out := buf.String()
+		for _, e := range test.Expected {
+			if !strings.Contains(out, e) {
+				t.Errorf("%s: expected %q in %q", test.Name, e, out)
+			}
+		}
+		if !strings.Contains(out, "2006-01-02") || strings.Contains(out, "hel…") {
+			t.Errorf("%s: expected untruncated built-in values in %q", test.Name, out)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package slogwriter
+
+import (
+	"io"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/hlandau/slogkit/slogwriter/internal/buffer"
+)
+
+// Width assumed if Wrap is set but the width cannot be determined.
+const defaultWrapWidth = 80
+
+// Indentation of continuation lines when wrapping.
+const wrapIndent = "    "
+
+// How long the width determined when WrapWidth is zero is used before it is
+// determined again, so that a resized terminal is noticed without querying
+// the terminal for every record.
+const wrapWidthInterval = time.Second
+
+// wrapWidthCache holds the width determined when WrapWidth is zero. It is
+// shared between a handler and all handlers derived from it.
+type wrapWidthCache struct {
+	width   int64 // atomic
+	expires int64 // atomic; in Unix nanoseconds
+}
+
+// wrapWidth returns the width at which to wrap text output if Wrap is set.
+func (h *commonHandler) wrapWidth() int {
+	if h.opts.WrapWidth > 0 {
+		return h.opts.WrapWidth
+	}
+	c := h.wrapWidthCache
+	now := time.Now().UnixNano()
+	if now < atomic.LoadInt64(&c.expires) {
+		return int(atomic.LoadInt64(&c.width))
+	}
+	w := detectWrapWidth(h.w)
+	atomic.StoreInt64(&c.width, int64(w))
+	atomic.StoreInt64(&c.expires, now+int64(wrapWidthInterval))
+	return w
+}
+
+// detectWrapWidth returns the width of the terminal w writes to, or the width
+// given by the COLUMNS environment variable, or a default.
+func detectWrapWidth(w io.Writer) int {
+	if w := terminalWidth(w); w > 0 {
+		return w
+	}
+	if w, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && w > 0 {
+		return w
+	}
+	return defaultWrapWidth
+}
+
+// wrap wraps the line in buf so that no line is wider than width, if
+// possible. Lines are only broken at spaces between attributes, that is,
+// spaces at or after the offset from which are not inside quotes.
+// Continuation lines are indented.
+func wrap(buf *buffer.Buffer, from, width int) {
+	b := *buf
+	if visibleWidth(b) <= width || from >= len(b) {
+		return
+	}
+
+	out := buffer.New()
+	defer out.Free()
+	out.Write(b[:from])
+	lineWidth := visibleWidth(b[:from])
+
+	// Split the remainder into tokens at unquoted spaces.
+	rest := b[from:]
+	first := true
+	for len(rest) > 0 {
+		i := tokenEnd(rest)
+		tok := rest[:i]
+		tokWidth := visibleWidth(tok)
+		switch {
+		case first:
+			// Nothing precedes the first token. This is empty if the attributes
+			// begin with a space.
+		case lineWidth+1+tokWidth > width && lineWidth > len(wrapIndent):
+			out.WriteByte('\n')
+			out.WriteString(wrapIndent)
+			lineWidth = len(wrapIndent)
+		default:
+			out.WriteByte(' ')
+			lineWidth++
+		}
+		out.Write(tok)
+		lineWidth += tokWidth
+		first = false
+		rest = rest[i:]
+		if len(rest) > 0 {
+			rest = rest[1:] // skip space
+		}
+	}
+
+	*buf = append((*buf)[:0], *out...)
+}
+
+// tokenEnd returns the index of the first space in b which is not inside
+// quotes, or len(b).
+func tokenEnd(b []byte) int {
+	inQuote := false
+	for i := 0; i < len(b); i++ {
+		switch b[i] {
+		case '\\':
+			if inQuote {
+				i++
+			}
+		case '"':
+			inQuote = !inQuote
+		case ' ':
+			if !inQuote {
+				return i
+			}
+		}
+	}
+	return len(b)
+}
@@ -0,0 +1,31 @@
+package slogwriter
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+func TestWrapWidthCached(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewTextHandler(&buf, &HandlerOptions{Wrap: true})
+	r := slog.NewRecord(time.Time{}, slog.LevelInfo, "hello", 0)
+	r.AddAttrs(slog.String("a", strings.Repeat("x", 20)), slog.String("b", strings.Repeat("y", 20)))
+
+	t.Setenv("COLUMNS", "40")
+	if err := h.Handle(context.Background(), r); err != nil {
+		t.Fatalf("handle: %v", err)
+	}
+	// The width determined for the first record is used until it expires.
+	t.Setenv("COLUMNS", "200")
+	if err := h.WithAttrs(nil).Handle(context.Background(), r); err != nil {
+		t.Fatalf("handle: %v", err)
+	}
+	if n := strings.Count(buf.String(), "\n"); n != 4 {
+		t.Errorf("expected both records to be wrapped onto two lines, got:\n%s", buf.String())
+	}
+}